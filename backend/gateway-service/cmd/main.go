@@ -9,10 +9,7 @@ import (
 	"time"
 
 	"github.com/ecommerce/gateway-service/pkg/config"
-	"github.com/ecommerce/gateway-service/pkg/handler"
-	"github.com/ecommerce/gateway-service/pkg/middleware"
-	"github.com/ecommerce/gateway-service/pkg/router"
-	"github.com/gin-gonic/gin"
+	"github.com/ecommerce/gateway-service/pkg/server"
 	"github.com/sirupsen/logrus"
 )
 
@@ -28,26 +25,24 @@ func main() {
 		logrus.Fatalf("Falha ao carregar configurações: %v", err)
 	}
 
-	// Inicializar o router Gin
-	engine := gin.New()
-	engine.Use(gin.Recovery())
-	engine.Use(middleware.Logger())
-	engine.Use(middleware.Cors(cfg))
-	engine.Use(middleware.Metrics())
-
-	// Configurar handlers
-	handlers := handler.NewHandlers(cfg)
+	// Montar o gateway (middlewares, handlers e rotas)
+	gateway, err := server.New(cfg)
+	if err != nil {
+		logrus.Fatalf("Falha ao registrar rotas: %v", err)
+	}
 
-	// Configurar rotas
-	router.SetupRoutes(engine, handlers, cfg)
+	// Recarregar configuração e rotas quando o config.yaml for alterado
+	if err := config.Watch(gateway.Reload); err != nil {
+		logrus.Warnf("Recarga automática de configuração desativada: %v", err)
+	}
 
 	// Configurar servidor HTTP
 	srv := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
-		Handler:      engine,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Handler:      gateway,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
 	// Iniciar o servidor em uma goroutine
@@ -71,6 +66,7 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		logrus.Fatalf("Falha ao desligar servidor: %v", err)
 	}
+	gateway.Close()
 
 	logrus.Info("Servidor encerrado com sucesso")
 }
@@ -2,12 +2,13 @@ package api
 
 import (
 	"fmt"
-	"io"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
+	"time"
 
 	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
+	"github.com/ecommerce/gateway-service/pkg/resilience"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -21,85 +22,92 @@ func healthCheck(c *gin.Context) {
 }
 
 // createProxyHandler cria um handler de proxy para encaminhar requisições para os microserviços
-func createProxyHandler(targetURL string) gin.HandlerFunc {
-	target, err := url.Parse(targetURL)
-	if err != nil {
-		logrus.WithError(err).Errorf("Failed to parse target URL: %s", targetURL)
-		return func(c *gin.Context) {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create proxy"})
-		}
-	}
-
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
-	// Configurar o handler de erro do proxy
-	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
-		logrus.WithError(err).Errorf("Proxy error: %s", target.String())
-		rw.WriteHeader(http.StatusBadGateway)
-		io.WriteString(rw, fmt.Sprintf("Service unavailable: %s", err.Error()))
-	}
-
+// retry, quando não é nil, e timeout, quando positivo, substituem as políticas do serviço;
+// priority define a ordem de descarte sob sobrecarga
+func createProxyHandler(upstream *proxy.Upstream, target *proxy.Target, identity *auth.IdentitySigner, retry *resilience.RetryPolicy, timeout time.Duration,
+	priority resilience.Priority) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Preservar o contexto original
-		originalPath := c.Request.URL.Path
 		originalHost := c.Request.Host
 
-		// Obter informações do usuário do contexto, se existirem
-		userId, exists := c.Get("user_id")
-		if exists {
-			c.Request.Header.Set("X-User-ID", userId.(string))
+		// Repassar o usuário autenticado como asserção assinada; os cabeçalhos de identidade
+		// enviados pelo cliente nunca são repassados
+		principal, _ := auth.PrincipalFrom(c)
+		if err := identity.Apply(c.Request, principal, upstream.Name()); err != nil {
+			logrus.WithError(err).Error("Failed to sign identity assertion")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build upstream request"})
+			return
+		}
+		if principal != nil {
+			c.Request = c.Request.WithContext(proxy.WithUserID(c.Request.Context(), principal.UserID))
 		}
 
-		// Modificar o caminho da requisição para o serviço de destino
-		c.Request.URL.Path = originalPath
-		c.Request.Host = target.Host
+		// Reescrever caminho e query string para o serviço de destino
+		upstreamURL, err := target.Rewrite(c.Request.URL, c.Params)
+		if err != nil {
+			logrus.WithError(err).Errorf("Failed to rewrite request path: %s", c.Request.URL.Path)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build upstream request"})
+			return
+		}
+
+		c.Request.URL.Path = upstreamURL.Path
+		c.Request.URL.RawPath = upstreamURL.RawPath
+		c.Request.URL.RawQuery = upstreamURL.RawQuery
 		c.Request.Header.Set("X-Forwarded-Host", originalHost)
 		c.Request.Header.Set("X-Real-IP", c.ClientIP())
 
-		// Encaminhar a requisição
-		proxy.ServeHTTP(c.Writer, c.Request)
-	}
-}
-
-// proxyToService cria um handler para encaminhar requisições para um serviço específico
-func proxyToService(cfg *config.Config, serviceName, host, port, path string) gin.HandlerFunc {
-	// Montar URL de destino
-	targetURL := fmt.Sprintf("http://%s:%s%s", host, port, path)
-	logrus.Infof("Creating proxy to %s: %s", serviceName, targetURL)
-	return createProxyHandler(targetURL)
-}
-
-// proxyToCatalogService encaminha requisições para o serviço de catálogo
-func proxyToCatalogService(cfg *config.Config, path string) gin.HandlerFunc {
-	return proxyToService(cfg, "catalog", cfg.Services.Catalog.Host, cfg.Services.Catalog.Port, path)
-}
+		if retry != nil {
+			c.Request = c.Request.WithContext(proxy.WithRetryPolicy(c.Request.Context(), retry))
+		}
+		if timeout > 0 {
+			c.Request = c.Request.WithContext(proxy.WithTimeout(c.Request.Context(), timeout))
+		}
+		c.Request = c.Request.WithContext(resilience.WithPriority(c.Request.Context(), priority))
 
-// proxyToOrderService encaminha requisições para o serviço de pedidos
-func proxyToOrderService(cfg *config.Config, path string) gin.HandlerFunc {
-	return proxyToService(cfg, "order", cfg.Services.Order.Host, cfg.Services.Order.Port, path)
+		// Encaminhar a requisição para uma das instâncias do serviço
+		upstream.ServeHTTP(c.Writer, c.Request)
+	}
 }
 
-// proxyToCartService encaminha requisições para o serviço de carrinho
-func proxyToCartService(cfg *config.Config, path string) gin.HandlerFunc {
-	return proxyToService(cfg, "cart", cfg.Services.Cart.Host, cfg.Services.Cart.Port, path)
-}
+// proxyToRoute cria o handler de proxy para uma rota declarada na configuração
+func proxyToRoute(upstreams proxy.Upstreams, identity *auth.IdentitySigner, route config.RouteConfig) (gin.HandlerFunc, error) {
+	upstream, ok := upstreams[route.Service]
+	if !ok {
+		return nil, fmt.Errorf("unknown service %q", route.Service)
+	}
 
-// proxyToUserService encaminha requisições para o serviço de usuários
-func proxyToUserService(cfg *config.Config, path string) gin.HandlerFunc {
-	return proxyToService(cfg, "user", cfg.Services.User.Host, cfg.Services.User.Port, path)
-}
+	query := proxy.QueryRewrite{
+		Drop:   route.Query.Drop,
+		Allow:  route.Query.Allow,
+		Remove: route.Query.Remove,
+	}
+	for _, rename := range route.Query.Rename {
+		if query.Rename == nil {
+			query.Rename = make(map[string]string, len(route.Query.Rename))
+		}
+		query.Rename[rename.From] = rename.To
+	}
+	for _, param := range route.Query.Set {
+		if query.Set == nil {
+			query.Set = make(map[string]string, len(route.Query.Set))
+		}
+		query.Set[param.Name] = param.Value
+	}
 
-// proxyToPaymentService encaminha requisições para o serviço de pagamentos
-func proxyToPaymentService(cfg *config.Config, path string) gin.HandlerFunc {
-	return proxyToService(cfg, "payment", cfg.Services.Payment.Host, cfg.Services.Payment.Port, path)
-}
+	target, err := proxy.NewTarget(route.Target, proxy.TargetOptions{
+		StripPrefix: route.StripPrefix,
+		AddPrefix:   route.AddPrefix,
+		Query:       query,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-// proxyToInventoryService encaminha requisições para o serviço de inventário
-func proxyToInventoryService(cfg *config.Config, path string) gin.HandlerFunc {
-	return proxyToService(cfg, "inventory", cfg.Services.Inventory.Host, cfg.Services.Inventory.Port, path)
-}
+	priority, err := resilience.ParsePriority(route.Priority)
+	if err != nil {
+		return nil, err
+	}
 
-// proxyToNotificationService encaminha requisições para o serviço de notificações
-func proxyToNotificationService(cfg *config.Config, path string) gin.HandlerFunc {
-	return proxyToService(cfg, "notification", cfg.Services.Notification.Host, cfg.Services.Notification.Port, path)
+	logrus.Infof("Creating proxy to %s: %s %s -> %s", route.Service, route.Methods, route.Path, route.Target)
+	return createProxyHandler(upstream, target, identity, resilience.NewRetryPolicy(route.Retry), route.Timeout, priority), nil
 }
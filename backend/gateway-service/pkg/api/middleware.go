@@ -0,0 +1,42 @@
+package api
+
+import (
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/middleware"
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/middleware/quota"
+	"github.com/ecommerce/gateway-service/pkg/middleware/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// MiddlewareEnv reúne a configuração e os recursos compartilhados usados pelos middlewares das rotas
+type MiddlewareEnv struct {
+	Config     *config.Config
+	LoginGuard *auth.LoginGuard   // nil quando auth.loginProtection está desativado
+	Limiter    *ratelimit.Limiter // nil quando rateLimit está desativado
+	Quotas     *quota.Quotas      // nil quando quotas está desativado
+}
+
+// MiddlewareFactory cria um middleware para uma rota declarada na configuração
+type MiddlewareFactory func(env *MiddlewareEnv, route config.RouteConfig) (gin.HandlerFunc, error)
+
+// routeMiddleware relaciona os nomes aceitos em "middleware" na tabela de rotas
+var routeMiddleware = map[string]MiddlewareFactory{
+	"cors": func(env *MiddlewareEnv, route config.RouteConfig) (gin.HandlerFunc, error) {
+		return middleware.Cors(env.Config), nil
+	},
+	"logger": func(env *MiddlewareEnv, route config.RouteConfig) (gin.HandlerFunc, error) {
+		return middleware.Logger(), nil
+	},
+	"metrics": func(env *MiddlewareEnv, route config.RouteConfig) (gin.HandlerFunc, error) {
+		return middleware.Metrics(), nil
+	},
+	// Proteção contra força bruta do login: contam as respostas de erro
+	"login-protection": func(env *MiddlewareEnv, route config.RouteConfig) (gin.HandlerFunc, error) {
+		return env.LoginGuard.Protect(false), nil
+	},
+	// Proteção da recuperação de senha: toda tentativa conta
+	"recovery-protection": func(env *MiddlewareEnv, route config.RouteConfig) (gin.HandlerFunc, error) {
+		return env.LoginGuard.Protect(true), nil
+	},
+}
@@ -1,15 +1,22 @@
 package api
 
 import (
+	"fmt"
+
 	"github.com/ecommerce/gateway-service/pkg/config"
 	"github.com/ecommerce/gateway-service/pkg/middleware"
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/middleware/quota"
+	"github.com/ecommerce/gateway-service/pkg/middleware/ratelimit"
+	"github.com/ecommerce/gateway-service/pkg/policy"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // SetupRouter configura todas as rotas do API Gateway
-func SetupRouter(cfg *config.Config) *gin.Engine {
+func SetupRouter(cfg *config.Config) (*gin.Engine, error) {
 	// Configurar o modo do Gin
 	if gin.Mode() == gin.DebugMode {
 		gin.SetMode(gin.DebugMode)
@@ -33,114 +40,112 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 	router.Use(middleware.MetricsMiddleware())
 	router.Use(gin.Recovery())
 
+	identity := auth.NewIdentitySigner(cfg.Identity)
+	router.Use(identity.StripInbound())
+
 	// Métricas e saúde do serviço
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	router.GET("/health", healthCheck)
 
-	// Rotas públicas
-	public := router.Group("/api")
-	{
-		// Catálogo (produtos, categorias)
-		catalog := public.Group("/catalog")
-		{
-			catalog.GET("/products", proxyToCatalogService(cfg, "/products"))
-			catalog.GET("/products/:id", proxyToCatalogService(cfg, "/products/:id"))
-			catalog.GET("/categories", proxyToCatalogService(cfg, "/categories"))
-			catalog.GET("/categories/:id", proxyToCatalogService(cfg, "/categories/:id"))
-		}
-
-		// Autenticação
-		auth := public.Group("/auth")
-		{
-			auth.POST("/login", proxyToUserService(cfg, "/auth/login"))
-			auth.POST("/register", proxyToUserService(cfg, "/auth/register"))
-			auth.POST("/forgot-password", proxyToUserService(cfg, "/auth/forgot-password"))
-			auth.POST("/reset-password", proxyToUserService(cfg, "/auth/reset-password"))
-		}
+	// Rotas encaminhadas aos microserviços, declaradas em config.yaml
+	upstreams, err := proxy.NewUpstreams(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	authenticator, err := auth.NewAuthenticator(cfg.Auth, auth.NewRevocationStore(config.RevocationConfig{Retention: cfg.Auth.Revocation.Retention}, nil), nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := policy.NewStore(cfg.Policies)
+	if err != nil {
+		return nil, err
+	}
+	if err := RegisterRoutes(router, cfg, upstreams, authenticator, auth.NewAuthorizer(cfg.Authorization), policy.NewEnforcer(policies, upstreams, identity), identity, nil, nil, nil); err != nil {
+		return nil, err
 	}
 
-	// Rotas protegidas (requerem autenticação)
-	secured := router.Group("/api")
-	secured.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret))
-	{
-		// Carrinho de compras
-		cart := secured.Group("/cart")
-		{
-			cart.GET("", proxyToCartService(cfg, ""))
-			cart.POST("/items", proxyToCartService(cfg, "/items"))
-			cart.PUT("/items/:id", proxyToCartService(cfg, "/items/:id"))
-			cart.DELETE("/items/:id", proxyToCartService(cfg, "/items/:id"))
-			cart.POST("/checkout", proxyToCartService(cfg, "/checkout"))
-		}
+	return router, nil
+}
 
-		// Pedidos
-		orders := secured.Group("/orders")
-		{
-			orders.GET("", proxyToOrderService(cfg, ""))
-			orders.GET("/:id", proxyToOrderService(cfg, "/:id"))
-			orders.POST("", proxyToOrderService(cfg, ""))
-			orders.PUT("/:id/cancel", proxyToOrderService(cfg, "/:id/cancel"))
+// RegisterRoutes registra as rotas da tabela cfg.Routes, encaminhando-as aos serviços de destino.
+// A identidade do usuário é repassada aos serviços pela asserção assinada de identity; guard,
+// quando não é nil, protege as rotas com os middlewares login-protection e recovery-protection.
+// Os limites de requisições de limiter valem para todas as rotas e as cotas de quotas contam
+// as chamadas autenticadas; ambos são opcionais (nil).
+// Retorna erro para entradas inválidas ou que conflitem com rotas já registradas.
+func RegisterRoutes(router *gin.Engine, cfg *config.Config, upstreams proxy.Upstreams, authenticator *auth.Authenticator, authorizer *auth.Authorizer, enforcer *policy.Enforcer, identity *auth.IdentitySigner,
+	guard *auth.LoginGuard, limiter *ratelimit.Limiter, quotas *quota.Quotas) (err error) {
+	var current config.RouteConfig
+	env := &MiddlewareEnv{Config: cfg, LoginGuard: guard, Limiter: limiter, Quotas: quotas}
+
+	// O Gin sinaliza conflitos na árvore de rotas com panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("route %s %s conflicts with an existing route: %v", current.Methods, current.Path, r)
 		}
+	}()
+
+	for i, route := range cfg.Routes {
+		current = route
 
-		// Usuários (perfil)
-		users := secured.Group("/users")
-		{
-			users.GET("/profile", proxyToUserService(cfg, "/profile"))
-			users.PUT("/profile", proxyToUserService(cfg, "/profile"))
-			users.GET("/addresses", proxyToUserService(cfg, "/addresses"))
-			users.POST("/addresses", proxyToUserService(cfg, "/addresses"))
-			users.PUT("/addresses/:id", proxyToUserService(cfg, "/addresses/:id"))
-			users.DELETE("/addresses/:id", proxyToUserService(cfg, "/addresses/:id"))
+		handlers, err := routeHandlers(env, upstreams, authenticator, authorizer, enforcer, identity, route)
+		if err != nil {
+			return fmt.Errorf("routes[%d] %s: %w", i, route.Path, err)
 		}
 
-		// Pagamentos
-		payments := secured.Group("/payments")
-		{
-			payments.GET("/methods", proxyToPaymentService(cfg, "/methods"))
-			payments.POST("/process", proxyToPaymentService(cfg, "/process"))
-			payments.GET("/:id/status", proxyToPaymentService(cfg, "/:id/status"))
+		for _, method := range route.Methods {
+			router.Handle(method, route.Path, handlers...)
 		}
 	}
 
-	// Rotas administrativas (requerem autenticação e papel de admin)
-	admin := router.Group("/api/admin")
-	admin.Use(middleware.AuthMiddleware(cfg.Auth.JWTSecret))
-	admin.Use(middleware.RoleMiddleware("admin"))
-	{
-		// Gerenciamento de produtos
-		adminCatalog := admin.Group("/catalog")
-		{
-			adminCatalog.POST("/products", proxyToCatalogService(cfg, "/admin/products"))
-			adminCatalog.PUT("/products/:id", proxyToCatalogService(cfg, "/admin/products/:id"))
-			adminCatalog.DELETE("/products/:id", proxyToCatalogService(cfg, "/admin/products/:id"))
-			adminCatalog.POST("/categories", proxyToCatalogService(cfg, "/admin/categories"))
-			adminCatalog.PUT("/categories/:id", proxyToCatalogService(cfg, "/admin/categories/:id"))
-			adminCatalog.DELETE("/categories/:id", proxyToCatalogService(cfg, "/admin/categories/:id"))
-		}
+	return nil
+}
 
-		// Gerenciamento de pedidos
-		adminOrders := admin.Group("/orders")
-		{
-			adminOrders.GET("", proxyToOrderService(cfg, "/admin"))
-			adminOrders.PUT("/:id/status", proxyToOrderService(cfg, "/admin/:id/status"))
-		}
+// routeHandlers monta a cadeia de handlers de uma rota: autenticação, limites de requisições,
+// autorização, políticas, step-up, cotas, middlewares e proxy
+func routeHandlers(env *MiddlewareEnv, upstreams proxy.Upstreams, authenticator *auth.Authenticator, authorizer *auth.Authorizer, enforcer *policy.Enforcer, identity *auth.IdentitySigner, route config.RouteConfig) ([]gin.HandlerFunc, error) {
+	var handlers []gin.HandlerFunc
 
-		// Gerenciamento de usuários
-		adminUsers := admin.Group("/users")
-		{
-			adminUsers.GET("", proxyToUserService(cfg, "/admin"))
-			adminUsers.GET("/:id", proxyToUserService(cfg, "/admin/:id"))
-			adminUsers.PUT("/:id", proxyToUserService(cfg, "/admin/:id"))
-			adminUsers.DELETE("/:id", proxyToUserService(cfg, "/admin/:id"))
-		}
+	if route.Auth {
+		handlers = append(handlers, authenticator.RequireAuth())
+	}
+	// Os limites vêm logo depois da autenticação, que identifica o usuário e a chave de API
+	if env.Limiter != nil {
+		handlers = append(handlers, env.Limiter.Limit())
+	}
+	if len(route.Permissions) > 0 {
+		handlers = append(handlers, authorizer.RequirePermissions(route.Permissions...))
+	}
+	if len(route.Scopes) > 0 {
+		handlers = append(handlers, auth.RequireScopes(route.Scopes...))
+	}
+	handlers = append(handlers, enforcer.Enforce())
+	// O step-up vem depois das demais verificações: só vale pedir nova autenticação se o
+	// usuário puder realizar a operação
+	if route.StepUp.Required() {
+		handlers = append(handlers, auth.RequireStepUp(route.StepUp))
+	}
+	// As cotas só contam as chamadas autenticadas que o gateway aceitou
+	if route.Auth && env.Quotas != nil {
+		handlers = append(handlers, env.Quotas.Meter())
+	}
 
-		// Gerenciamento de estoque
-		adminInventory := admin.Group("/inventory")
-		{
-			adminInventory.GET("", proxyToInventoryService(cfg, "/admin"))
-			adminInventory.PUT("/products/:id", proxyToInventoryService(cfg, "/admin/products/:id"))
+	for _, name := range route.Middleware {
+		factory, ok := routeMiddleware[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown middleware %q", name)
 		}
+		handler, err := factory(env, route)
+		if err != nil {
+			return nil, fmt.Errorf("middleware %q: %w", name, err)
+		}
+		handlers = append(handlers, handler)
+	}
+
+	proxyHandler, err := proxyToRoute(upstreams, identity, route)
+	if err != nil {
+		return nil, err
 	}
 
-	return router
+	return append(handlers, proxyHandler), nil
 }
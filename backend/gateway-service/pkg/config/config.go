@@ -1,20 +1,394 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// EndpointConfig descreve uma instância de um serviço remoto
+type EndpointConfig struct {
+	Host   string
+	Port   string
+	Weight int // peso relativo usado pela estratégia "weighted" e pelo hash consistente (padrão 1)
+}
+
+// LoadBalancingConfig define como as requisições são distribuídas entre as instâncias
+type LoadBalancingConfig struct {
+	Strategy string // round-robin (padrão), weighted, least-requests ou consistent-hash
+	HashOn   string // chave do hash consistente: "user" ou "header:<Nome>"
+}
+
+// HealthCheckConfig define a verificação ativa de saúde das instâncias
+type HealthCheckConfig struct {
+	Type               string        // http, grpc ou none (padrão)
+	Path               string        // caminho verificado no modo http; status < 500 indica instância saudável
+	Port               string        // porta da verificação, quando diferente da porta do serviço (ex.: porta gRPC)
+	Service            string        // nome do serviço consultado no protocolo de health do gRPC
+	Interval           time.Duration // intervalo entre verificações (padrão 10s)
+	Timeout            time.Duration // tempo máximo de cada verificação (padrão 2s)
+	HealthyThreshold   int           // sucessos consecutivos para voltar a receber tráfego (padrão 2)
+	UnhealthyThreshold int           // falhas consecutivas para deixar de receber tráfego (padrão 3)
+}
+
+// OutlierDetectionConfig define a ejeção de instâncias com base nas falhas do tráfego real
+type OutlierDetectionConfig struct {
+	ConsecutiveFailures int           // falhas consecutivas (erro de conexão ou 5xx) para ejetar; 0 desativa
+	BaseEjectionTime    time.Duration // tempo da primeira ejeção, dobrado a cada reincidência (padrão 30s)
+	MaxEjectionTime     time.Duration // limite do tempo de ejeção (padrão 5m)
+	MaxEjectionPercent  int           // percentual máximo de instâncias ejetadas ao mesmo tempo (padrão 50)
+}
+
+// CircuitBreakerConfig define o circuit breaker de um serviço
+type CircuitBreakerConfig struct {
+	FailureRatio     float64       // proporção de falhas na janela que abre o circuito; 0 desativa
+	MinimumRequests  int           // volume mínimo na janela antes de avaliar a proporção (padrão 20)
+	Window           time.Duration // janela deslizante de observação (padrão 10s)
+	CoolDown         time.Duration // tempo aberto antes de testar o serviço novamente (padrão 30s)
+	HalfOpenRequests int           // requisições de teste no estado meio-aberto (padrão 5)
+}
+
+// RetryConfig define a repetição de chamadas que falharam. Apenas métodos idempotentes
+// (ou requisições com Idempotency-Key) são repetidos.
+type RetryConfig struct {
+	MaxAttempts int           // total de tentativas, incluindo a primeira; 0 ou 1 desativa
+	BaseBackoff time.Duration // espera antes da primeira repetição, dobrada a cada tentativa (padrão 25ms)
+	MaxBackoff  time.Duration // limite da espera entre tentativas (padrão 1s)
+	RetryOn     []int         // status que provocam repetição (padrão 502, 503 e 504)
+}
+
+// RetryBudgetConfig limita as repetições de todo o gateway em relação ao tráfego normal
+type RetryBudgetConfig struct {
+	Ratio               float64       // repetições permitidas por requisição na janela (padrão 0.2)
+	MinRetriesPerSecond int           // repetições sempre permitidas, mesmo com pouco tráfego (padrão 10)
+	Window              time.Duration // janela de contagem (padrão 10s)
+}
+
+// ConcurrencyConfig define o limite adaptativo de requisições simultâneas a um serviço. O
+// limite acompanha a latência observada; quando ele é atingido, as requisições de menor
+// prioridade são descartadas primeiro.
+type ConcurrencyConfig struct {
+	Algorithm        string        // aimd ou gradient; vazio desativa
+	InitialLimit     int           // limite inicial (padrão 20)
+	MinLimit         int           // menor limite (padrão 5)
+	MaxLimit         int           // maior limite (padrão 1000)
+	LatencyThreshold time.Duration // aimd: latência acima da qual a chamada indica sobrecarga (padrão 1s)
+	BackoffRatio     float64       // aimd: fator aplicado ao limite na sobrecarga (padrão 0.9)
+	Tolerance        float64       // gradient: aumento da latência, sobre a de referência, tolerado sem reduzir o limite (padrão 1.5)
+	Smoothing        float64       // gradient: peso de cada ajuste no limite (padrão 0.2)
+}
+
+// BulkheadConfig isola a capacidade do gateway dedicada a um serviço, limitando as
+// requisições simultâneas e a fila das que aguardam vaga
+type BulkheadConfig struct {
+	MaxInflight  int           // requisições simultâneas ao serviço; 0 desativa
+	MaxQueue     int           // requisições aguardando vaga; além disso a recusa é imediata
+	QueueTimeout time.Duration // espera máxima na fila (padrão 1s)
+}
+
 // ServiceConfig armazena as configurações para serviços remotos
 type ServiceConfig struct {
-	Host string
-	Port string
+	Host             string
+	Port             string
+	Endpoints        []EndpointConfig // instâncias do serviço; quando vazio usa Host/Port
+	LoadBalancing    LoadBalancingConfig
+	HealthCheck      HealthCheckConfig
+	OutlierDetection OutlierDetectionConfig
+	CircuitBreaker   CircuitBreakerConfig
+	Retry            RetryConfig
+	Concurrency      ConcurrencyConfig
+	Bulkhead         BulkheadConfig
+	Timeout          time.Duration // tempo máximo de cada chamada ao serviço, incluindo as repetições
+}
+
+// Instances retorna as instâncias configuradas do serviço, usando Host/Port quando não há lista
+func (s ServiceConfig) Instances() []EndpointConfig {
+	if len(s.Endpoints) > 0 {
+		return s.Endpoints
+	}
+	return []EndpointConfig{{Host: s.Host, Port: s.Port, Weight: 1}}
+}
+
+// QueryRewriteConfig descreve a reescrita da query string de uma rota. Rename e Set são
+// listas, e não mapas, porque o viper converte as chaves dos mapas para minúsculas.
+type QueryRewriteConfig struct {
+	Drop   bool
+	Allow  []string
+	Remove []string
+	Rename []QueryRenameConfig
+	Set    []QueryParamConfig
+}
+
+// QueryRenameConfig troca o nome de um parâmetro da query string
+type QueryRenameConfig struct {
+	From string // nome recebido pelo gateway
+	To   string // nome repassado ao serviço
+}
+
+// QueryParamConfig define um parâmetro fixo da query string
+type QueryParamConfig struct {
+	Name  string
+	Value string // valores iniciados por ':' são lidos dos parâmetros da rota
+}
+
+// RouteConfig descreve uma rota do gateway encaminhada para um serviço remoto
+type RouteConfig struct {
+	Path        string   // caminho no gateway, no formato do Gin ("/api/catalog/products/:id")
+	Methods     []string // métodos HTTP aceitos
+	Service     string   // nome do serviço de destino (catalog, order, cart...)
+	Target      string   // template de caminho no serviço; vazio repassa o caminho original
+	StripPrefix string   // prefixo removido do caminho original quando Target está vazio
+	AddPrefix   string   // prefixo adicionado ao caminho original quando Target está vazio
+	Query       QueryRewriteConfig
+	Auth        bool          // exige token de autenticação
+	Permissions []string      // permissões exigidas, todas obrigatórias ("catalog:write"); exige Auth
+	Scopes      []string      // escopos OAuth exigidos no token, todos obrigatórios; exige Auth
+	StepUp      StepUpConfig  // autenticação recente ou forte exigida (pagamentos, endereços); exige Auth
+	Middleware  []string      // middlewares adicionais aplicados apenas a esta rota
+	Retry       RetryConfig   // substitui a política de repetição do serviço nesta rota
+	Timeout     time.Duration // substitui o timeout do serviço nesta rota
+	Priority    string        // critical, high, normal (padrão) ou low; sob sobrecarga, low é descartada primeiro
+}
+
+// StepUpConfig define a autenticação exigida por uma operação sensível. Tokens sem auth_time
+// usam o iat como instante da autenticação.
+type StepUpConfig struct {
+	MaxAge  time.Duration // idade máxima da autenticação do usuário (claim auth_time); zero não verifica
+	Methods []string      // métodos aceitos na claim amr ("pwd", "otp", "mfa"), basta um; vazio não verifica
+}
+
+// Required indica se a operação exige step-up
+func (s StepUpConfig) Required() bool {
+	return s.MaxAge > 0 || len(s.Methods) > 0
+}
+
+// AuthConfig define a validação dos tokens JWT dos usuários
+type AuthConfig struct {
+	JWTSecret   string        // segredo compartilhado dos tokens HS256
+	TokenExpiry int           // em minutos
+	Algorithms  []string      // algoritmos aceitos (padrão HS256, RS256 e ES256)
+	JWKSURL     string        // URL do JWKS com as chaves públicas dos emissores
+	JWKSFile    string        // arquivo JWKS local, usado junto ou no lugar da URL
+	JWKSRefresh time.Duration // intervalo de atualização do JWKS (padrão 5m)
+	Issuers     []string      // valores aceitos em iss; vazio não verifica
+	Audiences   []string      // valores aceitos em aud; vazio não verifica
+	ClockSkew   time.Duration // tolerância de relógio para exp, nbf e iat (padrão 30s)
+	Revocation  RevocationConfig
+	APIKeys     APIKeyConfig
+	OAuth       OAuthConfig
+	Session     SessionConfig
+	Refresh     RefreshConfig
+	// LoginProtection limita as tentativas nas rotas de login e recuperação de senha
+	LoginProtection LoginProtectionConfig
+	Impersonation   ImpersonationConfig
+}
+
+// ImpersonationConfig define a impersonação de clientes pelo suporte
+// (POST /api/admin/users/:id/impersonate). Os tokens são emitidos como os do auth.oauth,
+// com o cliente em sub e o administrador em act.sub, e cada requisição feita com eles é
+// registrada na auditoria.
+type ImpersonationConfig struct {
+	Enabled     bool
+	TokenTTL    time.Duration // validade dos tokens (padrão 15m)
+	Roles       []string      // papéis incluídos nos tokens; vazio vê a loja como um cliente sem papéis
+	DeniedPaths []string      // caminhos proibidos aos tokens, no formato das rotas ("/api/payments/*path"), opcionalmente só em um método ("PUT /api/users/profile")
+	AuditFile   string        // arquivo da auditoria (uma entrada JSON por linha); vazio registra no log
+}
+
+// LoginProtectionConfig define a proteção contra força bruta e credential stuffing das rotas
+// de login e recuperação de senha. As falhas são contadas por IP, por conta e por dispositivo;
+// ao atingir o limite a chave é bloqueada por um tempo que dobra a cada nova falha.
+type LoginProtectionConfig struct {
+	Enabled          bool
+	Store            string        // memory (padrão) ou redis
+	Window           time.Duration // por quanto tempo, desde a última falha, as falhas são lembradas (padrão 15m)
+	AccountThreshold int           // falhas da conta até o bloqueio (padrão 5)
+	DeviceThreshold  int           // falhas do dispositivo até o bloqueio (padrão 10)
+	IPThreshold      int           // falhas do IP até o bloqueio; alto por causa de NAT (padrão 50)
+	CaptchaAfter     int           // falhas da conta ou do dispositivo a partir das quais o erro pede captcha (padrão 3)
+	LockoutBase      time.Duration // primeiro bloqueio (padrão 1m)
+	LockoutMax       time.Duration // bloqueio máximo (padrão 1h)
+	AccountFields    []string      // campos do corpo JSON com o identificador da conta, na ordem de busca
+	DeviceHeader     string        // cabeçalho com o ID do dispositivo enviado pelos apps; sem ele a impressão usa User-Agent e Accept-Language
+	StuffingAccounts int           // contas distintas com falha em um minuto que caracterizam credential stuffing (padrão 100)
+}
+
+// RefreshConfig define os refresh tokens emitidos pelo gateway no login. Cada login abre uma
+// sessão (família de tokens) e cada refresh troca o token por um novo; apresentar um token já
+// trocado revoga a sessão inteira. Os tokens de acesso do refresh são assinados como os do
+// auth.oauth (issuer, signingKeyFile ou jwtSecret).
+type RefreshConfig struct {
+	Enabled        bool
+	Store          string        // memory (padrão) ou redis
+	SessionTTL     time.Duration // validade máxima da sessão desde o login (padrão 720h)
+	IdleTimeout    time.Duration // a sessão expira se não houver refresh nesse intervalo (padrão 168h)
+	AccessTokenTTL time.Duration // validade dos tokens de acesso emitidos no refresh (padrão 15m)
+}
+
+// SessionConfig define os cookies do modo de sessão, usado pelos clientes web listados em
+// cors.sessionOrigins: o token fica em um cookie HttpOnly e as requisições que alteram estado
+// exigem o token CSRF (double-submit) no cabeçalho
+type SessionConfig struct {
+	CookieName     string // cookie HttpOnly com o token (padrão gw_session)
+	CSRFCookieName string // cookie com o token CSRF (padrão XSRF-TOKEN)
+	CSRFHeader     string // cabeçalho com o token CSRF (padrão X-XSRF-TOKEN)
+	RefreshCookie  string // cookie HttpOnly com o refresh token, quando auth.refresh está ativo (padrão gw_refresh)
+	Domain         string // domínio dos cookies; vazio restringe ao host do gateway
+	Path           string // caminho dos cookies (padrão "/")
+}
+
+// SessionOriginConfig habilita o modo de sessão para uma origem de cors.allowedOrigins
+type SessionOriginConfig struct {
+	Origin   string
+	SameSite string // strict, lax (padrão) ou none
+	Insecure bool   // emite os cookies sem o atributo Secure; apenas para desenvolvimento sem HTTPS
+}
+
+// OAuthConfig define o endpoint de tokens OAuth2 (grant client_credentials) usado por
+// jobs e serviços internos. Os tokens emitidos são aceitos pela própria autenticação do gateway.
+type OAuthConfig struct {
+	Enabled        bool
+	Issuer         string        // iss dos tokens emitidos (padrão "api-gateway")
+	Audience       string        // aud dos tokens emitidos; deve estar em auth.audiences quando houver
+	SigningKeyFile string        // chave privada PEM (RSA ou EC); vazio assina com auth.jwtSecret (HS256)
+	TokenTTL       time.Duration // validade dos tokens (padrão 5m)
+	Clients        []OAuthClientConfig
+}
+
+// OAuthClientConfig descreve um cliente autorizado a obter tokens
+type OAuthClientConfig struct {
+	ID         string
+	SecretHash string   // hash bcrypt do segredo do cliente
+	Scopes     []string // escopos que o cliente pode solicitar
+	Roles      []string // papéis incluídos nos tokens, usados nas permissões das rotas
+	Plan       string   // plano de cotas do cliente (quotas.plans), incluído nos tokens
+}
+
+// APIKeyConfig define a autenticação por chave de API de parceiros e integrações internas
+type APIKeyConfig struct {
+	Enabled    bool   // aceita chaves de API nas rotas autenticadas
+	File       string // arquivo onde as chaves são persistidas (apenas o hash); vazio mantém em memória
+	Header     string // cabeçalho com a chave (padrão X-API-Key)
+	QueryParam string // parâmetro de query aceito com a chave; vazio desativa
+}
+
+// RevocationConfig define onde ficam os tokens revogados (logout e bloqueio de usuários)
+type RevocationConfig struct {
+	Store     string        // memory (padrão) ou redis
+	Retention time.Duration // por quanto tempo a revogação de todos os tokens de um usuário vale (padrão 24h)
+}
+
+// AuthorizationConfig define as permissões concedidas a cada papel
+type AuthorizationConfig struct {
+	Roles  map[string][]string // papel -> permissões ("catalog:write", "catalog:*" ou "*"); nomes de papéis sem distinção de maiúsculas
+	StepUp StepUpConfig        // step-up das operações sensíveis das rotas do próprio gateway (perfil e endereços)
+}
+
+// PolicyConfig define os arquivos das políticas de acesso avaliadas pelo gateway
+type PolicyConfig struct {
+	Files []string // arquivos ou padrões glob ("policies/*.yaml"); recarregados quando mudam
+}
+
+// IdentityConfig define a identidade repassada aos serviços. Os cabeçalhos de identidade
+// recebidos dos clientes são sempre removidos; o gateway envia no lugar uma asserção assinada
+// (JWT HS256) com o usuário autenticado, que os serviços verificam com a chave compartilhada.
+type IdentityConfig struct {
+	Header       string        // cabeçalho com a asserção assinada (padrão X-Gateway-Identity)
+	UserIDHeader string        // cabeçalho com o ID do usuário em texto, para os serviços que ainda não verificam a asserção (padrão X-User-ID)
+	SigningKey   string        // segredo HMAC compartilhado com os serviços; não deve ser o auth.jwtSecret
+	Issuer       string        // iss da asserção (padrão "api-gateway")
+	TTL          time.Duration // validade da asserção (padrão 30s)
+	StripHeaders []string      // cabeçalhos removidos das requisições recebidas; "X-User-*" remove pelo prefixo
+}
+
+// RateLimitConfig define os limites de requisições do gateway. Cada requisição passa por
+// todas as políticas que cobrem o seu caminho e método e é recusada se alguma se esgotar.
+type RateLimitConfig struct {
+	Enabled  bool
+	Store    string // memory (padrão) ou redis (compartilhado entre réplicas)
+	Policies []RateLimitPolicyConfig
+}
+
+// RateLimitPolicyConfig define o limite de um grupo de rotas
+type RateLimitPolicyConfig struct {
+	Name      string
+	Paths     []string      // caminhos no formato das rotas ("/api/payments/*path"); vazio cobre todos
+	Methods   []string      // métodos cobertos; vazio cobre todos
+	Key       string        // ip (padrão), user, apiKey ou header:<nome>; requisições sem a chave não são limitadas pela política
+	Algorithm string        // tokenBucket (padrão) ou slidingWindow
+	Requests  int           // requisições permitidas por período
+	Period    time.Duration // período do limite (padrão 1m)
+	Burst     int           // capacidade do balde no tokenBucket (padrão Requests)
+}
+
+// QuotaConfig define as cotas de chamadas dos consumidores da API por plano. O plano vem da
+// chave de API, do cliente OAuth ou da claim "plan" do token; sem plano, ou com um plano
+// desconhecido, vale DefaultPlan.
+type QuotaConfig struct {
+	Enabled     bool
+	Store       string // memory (padrão) ou redis (compartilhado entre réplicas)
+	DefaultPlan string // vazio não aplica cotas a quem não tem plano
+	Plans       []QuotaPlanConfig
+}
+
+// QuotaPlanConfig define as cotas de um plano
+type QuotaPlanConfig struct {
+	Name   string
+	Quotas []QuotaLimitConfig
+}
+
+// QuotaLimitConfig define a cota de um grupo de rotas em um plano
+type QuotaLimitConfig struct {
+	Name     string
+	Paths    []string // caminhos no formato das rotas ("/api/orders/*rest"); vazio cobre todos
+	Methods  []string // métodos cobertos; vazio cobre todos
+	Window   string   // daily ou monthly (padrão), no calendário UTC
+	Requests int64    // chamadas permitidas por janela
+}
+
+// CacheConfig define o cache das respostas das leituras do catálogo. A validade de cada
+// resposta segue o Cache-Control (ou o Expires) e o Vary do serviço; as rotas podem
+// substituir esses valores.
+type CacheConfig struct {
+	Enabled              bool
+	Store                string        // memory (padrão) ou redis (compartilhado entre réplicas)
+	MaxBytes             int64         // memory: tamanho máximo das respostas guardadas (padrão 64MB)
+	MaxEntryBytes        int64         // maior resposta guardada (padrão 1MB)
+	DefaultTTL           time.Duration // validade das respostas sem max-age nem Expires; 0 não as guarda
+	StaleWhileRevalidate time.Duration // resposta vencida servida enquanto outra é buscada em segundo plano
+	StaleIfError         time.Duration // resposta vencida servida quando o serviço falha
+	Routes               []CacheRouteConfig
+}
+
+// CacheRouteConfig substitui a validade das respostas de um grupo de rotas; os valores
+// zerados mantêm os da resposta
+type CacheRouteConfig struct {
+	Paths                []string // caminhos no formato das rotas ("/api/v1/products/:id")
+	TTL                  time.Duration
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+}
+
+// RedisConfig define a conexão com o Redis usado pelos armazenamentos compartilhados
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
 }
 
 // Config armazena todas as configurações da aplicação
 type Config struct {
 	Server struct {
-		Port string
+		Port         string
+		ReadTimeout  time.Duration
+		WriteTimeout time.Duration // limita também o timeout das rotas e serviços
+		IdleTimeout  time.Duration
 	}
 	Services struct {
 		Catalog      ServiceConfig
@@ -25,68 +399,829 @@ type Config struct {
 		Inventory    ServiceConfig
 		Notification ServiceConfig
 	}
-	Auth struct {
-		JWTSecret   string
-		TokenExpiry int // em minutos
-	}
+	// ServiceDefaults define políticas aplicadas aos serviços que não configuram as suas
+	ServiceDefaults ServiceConfig
+	// RetryBudget limita as repetições somadas de todos os serviços
+	RetryBudget RetryBudgetConfig
+
+	Auth AuthConfig
+	// Authorization relaciona os papéis dos usuários às permissões exigidas pelas rotas
+	Authorization AuthorizationConfig
+	// Policies são as regras de acesso por atributos (dono do recurso, papel, método)
+	Policies PolicyConfig
+	// Identity define a identidade assinada repassada aos serviços
+	Identity IdentityConfig
+	// RateLimit limita as requisições por IP, usuário, chave de API ou cabeçalho em cada grupo de rotas
+	RateLimit RateLimitConfig
+	// Quotas controla as cotas diárias e mensais de chamadas dos consumidores da API
+	Quotas QuotaConfig
+	// Cache guarda as respostas das leituras do catálogo
+	Cache CacheConfig
+
 	Cors struct {
 		AllowedOrigins []string
+		// SessionOrigins são as origens que usam o modo de sessão por cookie no login
+		SessionOrigins []SessionOriginConfig
 	}
+	// Redis é usado pelos armazenamentos compartilhados entre réplicas do gateway
+	Redis  RedisConfig
+	Routes []RouteConfig
 }
 
 // LoadConfig carrega a configuração do arquivo config.yaml
 func LoadConfig() (*Config, error) {
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("./config")
-	viper.AutomaticEnv()
+	v := newViper()
 
-	if err := viper.ReadInConfig(); err != nil {
+	if err := v.ReadInConfig(); err != nil {
 		logrus.Warnf("Config file not found: %v", err)
 	}
 
+	return decode(v)
+}
+
+// Watch observa o arquivo de configuração e chama onChange a cada alteração.
+// Cada versão é relida e validada do zero; se for inválida, onChange recebe o erro
+// e cabe ao chamador manter a configuração anterior.
+func Watch(onChange func(cfg *Config, err error)) error {
+	watcher := newViper()
+	if err := watcher.ReadInConfig(); err != nil {
+		return err
+	}
+
+	watcher.OnConfigChange(func(event fsnotify.Event) {
+		v := newViper()
+		if err := v.ReadInConfig(); err != nil {
+			onChange(nil, fmt.Errorf("read %s: %w", event.Name, err))
+			return
+		}
+		onChange(decode(v))
+	})
+	watcher.WatchConfig()
+
+	logrus.Infof("Observando alterações em %s", watcher.ConfigFileUsed())
+	return nil
+}
+
+// newViper cria uma instância do viper apontando para o config.yaml, com os valores padrão
+func newViper() *viper.Viper {
+	v := viper.New()
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
+	v.AddConfigPath(".")
+	v.AddConfigPath("./config")
+	v.AutomaticEnv()
+
 	// Configurações padrão
-	setDefaults()
+	setDefaults(v)
 
+	return v
+}
+
+// decode converte e valida a configuração lida pelo viper
+func decode(v *viper.Viper) (*Config, error) {
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
 		return nil, err
 	}
 
 	return &config, nil
 }
 
+// Service retorna a configuração de um serviço pelo nome usado nas rotas,
+// com as políticas não configuradas preenchidas a partir de ServiceDefaults
+func (c *Config) Service(name string) (ServiceConfig, bool) {
+	var service ServiceConfig
+	switch strings.ToLower(name) {
+	case "catalog":
+		service = c.Services.Catalog
+	case "order":
+		service = c.Services.Order
+	case "cart":
+		service = c.Services.Cart
+	case "user":
+		service = c.Services.User
+	case "payment":
+		service = c.Services.Payment
+	case "inventory":
+		service = c.Services.Inventory
+	case "notification":
+		service = c.Services.Notification
+	default:
+		return ServiceConfig{}, false
+	}
+	return service.withDefaults(c.ServiceDefaults), true
+}
+
+// withDefaults substitui cada política não configurada (valor zero) pela política padrão
+func (s ServiceConfig) withDefaults(defaults ServiceConfig) ServiceConfig {
+	if reflect.ValueOf(s.LoadBalancing).IsZero() {
+		s.LoadBalancing = defaults.LoadBalancing
+	}
+	if reflect.ValueOf(s.HealthCheck).IsZero() {
+		s.HealthCheck = defaults.HealthCheck
+	}
+	if reflect.ValueOf(s.OutlierDetection).IsZero() {
+		s.OutlierDetection = defaults.OutlierDetection
+	}
+	if reflect.ValueOf(s.CircuitBreaker).IsZero() {
+		s.CircuitBreaker = defaults.CircuitBreaker
+	}
+	if reflect.ValueOf(s.Retry).IsZero() {
+		s.Retry = defaults.Retry
+	}
+	if reflect.ValueOf(s.Concurrency).IsZero() {
+		s.Concurrency = defaults.Concurrency
+	}
+	if reflect.ValueOf(s.Bulkhead).IsZero() {
+		s.Bulkhead = defaults.Bulkhead
+	}
+	if s.Timeout == 0 {
+		s.Timeout = defaults.Timeout
+	}
+	return s
+}
+
+// ServiceNames lista os nomes dos serviços remotos conhecidos pelo gateway
+var ServiceNames = []string{"catalog", "order", "cart", "user", "payment", "inventory", "notification"}
+
+// Validate verifica a consistência da configuração, em especial da tabela de rotas
+func (c *Config) Validate() error {
+	var errs []error
+
+	for _, name := range ServiceNames {
+		service, _ := c.Service(name)
+		errs = append(errs, service.validate(name)...)
+		errs = append(errs, c.validateTimeout("services."+name+".timeout", service.Timeout)...)
+	}
+
+	seen := make(map[string]int)
+
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		prefix := fmt.Sprintf("routes[%d] %s", i, route.Path)
+
+		if !strings.HasPrefix(route.Path, "/") {
+			errs = append(errs, fmt.Errorf("%s: path must start with '/'", prefix))
+		}
+
+		route.Service = strings.ToLower(route.Service)
+		if _, ok := c.Service(route.Service); !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown service %q", prefix, route.Service))
+		}
+
+		if len(route.Methods) == 0 {
+			errs = append(errs, fmt.Errorf("%s: at least one method is required", prefix))
+		}
+		for j, method := range route.Methods {
+			method = strings.ToUpper(method)
+			route.Methods[j] = method
+			if !validMethods[method] {
+				errs = append(errs, fmt.Errorf("%s: invalid method %q", prefix, method))
+				continue
+			}
+
+			key := method + " " + route.Path
+			if other, ok := seen[key]; ok {
+				errs = append(errs, fmt.Errorf("%s: %s conflicts with routes[%d]", prefix, key, other))
+				continue
+			}
+			seen[key] = i
+		}
+
+		if route.Target != "" && (route.StripPrefix != "" || route.AddPrefix != "") {
+			errs = append(errs, fmt.Errorf("%s: target cannot be combined with stripPrefix/addPrefix", prefix))
+		}
+
+		if (len(route.Permissions) > 0 || len(route.Scopes) > 0 || route.StepUp.Required()) && !route.Auth {
+			errs = append(errs, fmt.Errorf("%s: permissions, scopes and stepUp require auth to be enabled", prefix))
+		}
+		if route.StepUp.MaxAge < 0 {
+			errs = append(errs, fmt.Errorf("%s: stepUp.maxAge must not be negative", prefix))
+		}
+		if route.Priority != "" && !validPriorities[route.Priority] {
+			errs = append(errs, fmt.Errorf("%s: unknown priority %q, expected critical, high, normal or low", prefix, route.Priority))
+		}
+		for _, permission := range route.Permissions {
+			if !validPermission(permission, false) {
+				errs = append(errs, fmt.Errorf("%s: invalid permission %q, expected \"resource:action\"", prefix, permission))
+			}
+		}
+
+		for j, rename := range route.Query.Rename {
+			if rename.From == "" || rename.To == "" {
+				errs = append(errs, fmt.Errorf("%s: query.rename[%d]: from and to are required", prefix, j))
+			}
+		}
+		for j, param := range route.Query.Set {
+			if param.Name == "" {
+				errs = append(errs, fmt.Errorf("%s: query.set[%d]: name is required", prefix, j))
+			}
+		}
+
+		errs = append(errs, route.Retry.validate(prefix+": retry")...)
+		errs = append(errs, c.validateTimeout(prefix+": timeout", route.Timeout)...)
+	}
+
+	errs = append(errs, c.Auth.validate(c.Redis)...)
+
+	for role, permissions := range c.Authorization.Roles {
+		for _, permission := range permissions {
+			if !validPermission(permission, true) {
+				errs = append(errs, fmt.Errorf("authorization.roles.%s: invalid permission %q", role, permission))
+			}
+		}
+	}
+	if c.Authorization.StepUp.MaxAge < 0 {
+		errs = append(errs, errors.New("authorization.stepUp: maxAge must not be negative"))
+	}
+
+	errs = append(errs, c.Identity.validate(c.Auth.JWTSecret)...)
+	errs = append(errs, c.validateSessionOrigins()...)
+	if c.RateLimit.Enabled {
+		errs = append(errs, c.RateLimit.validate(c.Redis)...)
+	}
+	if c.Quotas.Enabled {
+		errs = append(errs, c.Quotas.validate(c.Redis, c.Auth.OAuth.Clients)...)
+	}
+	if c.Cache.Enabled {
+		errs = append(errs, c.Cache.validate(c.Redis)...)
+	}
+
+	if c.RetryBudget.Ratio < 0 {
+		errs = append(errs, errors.New("retryBudget: ratio must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate verifica instâncias e estratégia de balanceamento de um serviço
+func (s ServiceConfig) validate(name string) []error {
+	var errs []error
+	prefix := "services." + name
+
+	for i, endpoint := range s.Instances() {
+		if endpoint.Host == "" || endpoint.Port == "" {
+			errs = append(errs, fmt.Errorf("%s.endpoints[%d]: host and port are required", prefix, i))
+		}
+		if endpoint.Weight < 0 {
+			errs = append(errs, fmt.Errorf("%s.endpoints[%d]: weight must not be negative", prefix, i))
+		}
+	}
+
+	switch s.LoadBalancing.Strategy {
+	case "", "round-robin", "weighted", "least-requests":
+	case "consistent-hash":
+		hashOn := s.LoadBalancing.HashOn
+		if hashOn != "user" && (!strings.HasPrefix(hashOn, "header:") || hashOn == "header:") {
+			errs = append(errs, fmt.Errorf("%s.loadBalancing: hashOn must be \"user\" or \"header:<Name>\", got %q", prefix, hashOn))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s.loadBalancing: unknown strategy %q", prefix, s.LoadBalancing.Strategy))
+	}
+
+	switch s.HealthCheck.Type {
+	case "", "none", "grpc":
+	case "http":
+		if !strings.HasPrefix(s.HealthCheck.Path, "/") {
+			errs = append(errs, fmt.Errorf("%s.healthCheck: path must start with '/'", prefix))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s.healthCheck: unknown type %q", prefix, s.HealthCheck.Type))
+	}
+
+	if p := s.OutlierDetection.MaxEjectionPercent; p < 0 || p > 100 {
+		errs = append(errs, fmt.Errorf("%s.outlierDetection: maxEjectionPercent must be between 0 and 100", prefix))
+	}
+
+	if r := s.CircuitBreaker.FailureRatio; r < 0 || r > 1 {
+		errs = append(errs, fmt.Errorf("%s.circuitBreaker: failureRatio must be between 0 and 1", prefix))
+	}
+
+	errs = append(errs, s.Retry.validate(prefix+".retry")...)
+	errs = append(errs, s.Concurrency.validate(prefix+".concurrency")...)
+	errs = append(errs, s.Bulkhead.validate(prefix+".bulkhead")...)
+
+	return errs
+}
+
+// validPriorities lista as classes de prioridade aceitas nas rotas
+var validPriorities = map[string]bool{"critical": true, "high": true, "normal": true, "low": true}
+
+// validate verifica o algoritmo e os limites do controle de concorrência
+func (c ConcurrencyConfig) validate(prefix string) []error {
+	var errs []error
+	switch c.Algorithm {
+	case "":
+		return nil
+	case "aimd", "gradient":
+	default:
+		errs = append(errs, fmt.Errorf("%s: unknown algorithm %q, expected aimd or gradient", prefix, c.Algorithm))
+	}
+	if c.InitialLimit < 0 || c.MinLimit < 0 || c.MaxLimit < 0 {
+		errs = append(errs, fmt.Errorf("%s: limits must not be negative", prefix))
+	}
+	if c.MinLimit > 0 && c.MaxLimit > 0 && c.MinLimit > c.MaxLimit {
+		errs = append(errs, fmt.Errorf("%s: minLimit must not exceed maxLimit", prefix))
+	}
+	if c.BackoffRatio < 0 || c.BackoffRatio >= 1 {
+		errs = append(errs, fmt.Errorf("%s: backoffRatio must be between 0 and 1", prefix))
+	}
+	if c.Smoothing < 0 || c.Smoothing > 1 {
+		errs = append(errs, fmt.Errorf("%s: smoothing must be between 0 and 1", prefix))
+	}
+	if c.Tolerance != 0 && c.Tolerance < 1 {
+		errs = append(errs, fmt.Errorf("%s: tolerance must be at least 1", prefix))
+	}
+	return errs
+}
+
+// validate verifica os limites do bulkhead
+func (b BulkheadConfig) validate(prefix string) []error {
+	var errs []error
+	if b.MaxInflight < 0 || b.MaxQueue < 0 || b.QueueTimeout < 0 {
+		errs = append(errs, fmt.Errorf("%s: maxInflight, maxQueue and queueTimeout must not be negative", prefix))
+	}
+	if b.MaxInflight == 0 && (b.MaxQueue > 0 || b.QueueTimeout > 0) {
+		errs = append(errs, fmt.Errorf("%s: maxQueue and queueTimeout require maxInflight", prefix))
+	}
+	return errs
+}
+
+// supportedAlgorithms lista os algoritmos de assinatura aceitos em auth.algorithms
+var supportedAlgorithms = map[string]bool{
+	"HS256": true, "HS384": true, "HS512": true,
+	"RS256": true, "RS384": true, "RS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+}
+
+// validate verifica os algoritmos, as fontes de chaves e o armazenamento de revogações da autenticação
+func (a AuthConfig) validate(redis RedisConfig) []error {
+	var errs []error
+
+	for _, alg := range a.Algorithms {
+		if !supportedAlgorithms[alg] {
+			errs = append(errs, fmt.Errorf("auth.algorithms: unsupported algorithm %q", alg))
+		}
+	}
+	if a.JWTSecret == "" && a.JWKSURL == "" && a.JWKSFile == "" {
+		errs = append(errs, errors.New("auth: jwtSecret, jwksUrl or jwksFile is required"))
+	}
+	if a.JWKSURL != "" && !strings.HasPrefix(a.JWKSURL, "https://") && !strings.HasPrefix(a.JWKSURL, "http://") {
+		errs = append(errs, fmt.Errorf("auth.jwksUrl: invalid URL %q", a.JWKSURL))
+	}
+	if a.ClockSkew < 0 || a.JWKSRefresh < 0 {
+		errs = append(errs, errors.New("auth: clockSkew and jwksRefresh must not be negative"))
+	}
+
+	switch a.Revocation.Store {
+	case "", "memory":
+	case "redis":
+		if redis.Addr == "" {
+			errs = append(errs, errors.New("auth.revocation: store redis requires redis.addr"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("auth.revocation: unknown store %q", a.Revocation.Store))
+	}
+
+	if a.APIKeys.Enabled && a.APIKeys.Header == "" && a.APIKeys.QueryParam == "" {
+		errs = append(errs, errors.New("auth.apiKeys: header or queryParam is required"))
+	}
+
+	if a.OAuth.Enabled || a.Refresh.Enabled || a.Impersonation.Enabled {
+		errs = append(errs, a.validateSigning()...)
+	}
+	if a.OAuth.Enabled {
+		errs = append(errs, a.validateOAuth()...)
+	}
+	if a.Refresh.Enabled {
+		errs = append(errs, a.validateRefresh(redis)...)
+	}
+	if a.LoginProtection.Enabled {
+		errs = append(errs, a.LoginProtection.validate(redis)...)
+	}
+	if a.Impersonation.TokenTTL < 0 {
+		errs = append(errs, errors.New("auth.impersonation: tokenTTL must not be negative"))
+	}
+
+	return errs
+}
+
+// validateSigning verifica a compatibilidade dos tokens emitidos pelo gateway (OAuth, refresh
+// e impersonação) com a própria validação de tokens do gateway
+func (a AuthConfig) validateSigning() []error {
+	var errs []error
+
+	if a.OAuth.SigningKeyFile == "" {
+		if a.JWTSecret == "" {
+			errs = append(errs, errors.New("auth.oauth: signingKeyFile or auth.jwtSecret is required"))
+		}
+		if len(a.Algorithms) > 0 && !contains(a.Algorithms, "HS256") {
+			errs = append(errs, errors.New("auth.oauth: tokens signed with jwtSecret require HS256 in auth.algorithms"))
+		}
+	}
+	if len(a.Audiences) > 0 && !contains(a.Audiences, a.OAuth.Audience) {
+		errs = append(errs, fmt.Errorf("auth.oauth: audience %q must be one of auth.audiences", a.OAuth.Audience))
+	}
+
+	return errs
+}
+
+// validateOAuth verifica os clientes do grant client_credentials
+func (a AuthConfig) validateOAuth() []error {
+	var errs []error
+
+	if a.OAuth.TokenTTL < 0 {
+		errs = append(errs, errors.New("auth.oauth: tokenTTL must not be negative"))
+	}
+
+	seen := make(map[string]bool)
+	for i, client := range a.OAuth.Clients {
+		prefix := fmt.Sprintf("auth.oauth.clients[%d] %s", i, client.ID)
+		if client.ID == "" {
+			errs = append(errs, fmt.Errorf("%s: id is required", prefix))
+		}
+		if seen[client.ID] {
+			errs = append(errs, fmt.Errorf("%s: duplicated client id", prefix))
+		}
+		seen[client.ID] = true
+		if !strings.HasPrefix(client.SecretHash, "$2") {
+			errs = append(errs, fmt.Errorf("%s: secretHash must be a bcrypt hash", prefix))
+		}
+	}
+
+	return errs
+}
+
+// validate verifica os cabeçalhos e a chave da identidade repassada aos serviços
+func (i IdentityConfig) validate(jwtSecret string) []error {
+	var errs []error
+
+	if i.Header == "" || i.UserIDHeader == "" {
+		errs = append(errs, errors.New("identity: header and userIdHeader are required"))
+	}
+	switch {
+	case len(i.SigningKey) < 32:
+		errs = append(errs, errors.New("identity.signingKey: at least 32 characters are required"))
+	case i.SigningKey == jwtSecret:
+		errs = append(errs, errors.New("identity.signingKey: must differ from auth.jwtSecret, otherwise services could forge user tokens"))
+	}
+	if i.TTL < 0 {
+		errs = append(errs, errors.New("identity.ttl: must not be negative"))
+	}
+	for _, header := range i.StripHeaders {
+		if name := strings.TrimSuffix(header, "*"); name == "" || strings.Contains(name, "*") {
+			errs = append(errs, fmt.Errorf("identity.stripHeaders: invalid header %q", header))
+		}
+	}
+
+	return errs
+}
+
+// validateRefresh verifica o armazenamento e as validades das sessões de refresh
+func (a AuthConfig) validateRefresh(redis RedisConfig) []error {
+	var errs []error
+
+	switch a.Refresh.Store {
+	case "", "memory":
+	case "redis":
+		if redis.Addr == "" {
+			errs = append(errs, errors.New("auth.refresh: store redis requires redis.addr"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("auth.refresh: unknown store %q", a.Refresh.Store))
+	}
+	if a.Refresh.SessionTTL < 0 || a.Refresh.IdleTimeout < 0 || a.Refresh.AccessTokenTTL < 0 {
+		errs = append(errs, errors.New("auth.refresh: sessionTTL, idleTimeout and accessTokenTTL must not be negative"))
+	}
+
+	return errs
+}
+
+// validate verifica o armazenamento e os limites da proteção de login
+func (l LoginProtectionConfig) validate(redis RedisConfig) []error {
+	var errs []error
+	switch l.Store {
+	case "", "memory":
+	case "redis":
+		if redis.Addr == "" {
+			errs = append(errs, errors.New("auth.loginProtection: store redis requires redis.addr"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("auth.loginProtection: unknown store %q", l.Store))
+	}
+	if l.AccountThreshold < 0 || l.DeviceThreshold < 0 || l.IPThreshold < 0 || l.CaptchaAfter < 0 || l.StuffingAccounts < 0 {
+		errs = append(errs, errors.New("auth.loginProtection: thresholds must not be negative"))
+	}
+	if l.Window < 0 || l.LockoutBase < 0 || l.LockoutMax < 0 {
+		errs = append(errs, errors.New("auth.loginProtection: window, lockoutBase and lockoutMax must not be negative"))
+	}
+	if l.LockoutMax > 0 && l.LockoutBase > l.LockoutMax {
+		errs = append(errs, errors.New("auth.loginProtection: lockoutBase must not exceed lockoutMax"))
+	}
+	return errs
+}
+
+// validate verifica o armazenamento e as políticas de limite de requisições
+func (r RateLimitConfig) validate(redis RedisConfig) []error {
+	var errs []error
+	switch r.Store {
+	case "", "memory":
+	case "redis":
+		if redis.Addr == "" {
+			errs = append(errs, errors.New("rateLimit: store redis requires redis.addr"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("rateLimit: unknown store %q", r.Store))
+	}
+
+	names := make(map[string]bool)
+	for i, policy := range r.Policies {
+		prefix := fmt.Sprintf("rateLimit.policies[%d]", i)
+		switch {
+		case policy.Name == "":
+			errs = append(errs, fmt.Errorf("%s: name is required", prefix))
+		case names[policy.Name]:
+			errs = append(errs, fmt.Errorf("%s: duplicate name %q", prefix, policy.Name))
+		}
+		names[policy.Name] = true
+
+		switch {
+		case policy.Key == "", policy.Key == "ip", policy.Key == "user", policy.Key == "apiKey":
+		case strings.HasPrefix(policy.Key, "header:") && len(policy.Key) > len("header:"):
+		default:
+			errs = append(errs, fmt.Errorf("%s: invalid key %q, expected ip, user, apiKey or header:<name>", prefix, policy.Key))
+		}
+		switch policy.Algorithm {
+		case "", "tokenBucket", "slidingWindow":
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown algorithm %q", prefix, policy.Algorithm))
+		}
+		if policy.Requests <= 0 {
+			errs = append(errs, fmt.Errorf("%s: requests must be positive", prefix))
+		}
+		if policy.Period < 0 || policy.Burst < 0 {
+			errs = append(errs, fmt.Errorf("%s: period and burst must not be negative", prefix))
+		}
+		for j, method := range policy.Methods {
+			policy.Methods[j] = strings.ToUpper(method)
+			if !validMethods[policy.Methods[j]] {
+				errs = append(errs, fmt.Errorf("%s: invalid method %q", prefix, method))
+			}
+		}
+	}
+	return errs
+}
+
+// validate verifica o armazenamento, os limites e as rotas do cache de respostas
+func (c CacheConfig) validate(redis RedisConfig) []error {
+	var errs []error
+	switch c.Store {
+	case "", "memory":
+	case "redis":
+		if redis.Addr == "" {
+			errs = append(errs, errors.New("cache: store redis requires redis.addr"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cache: unknown store %q", c.Store))
+	}
+	if c.MaxBytes < 0 || c.MaxEntryBytes < 0 {
+		errs = append(errs, errors.New("cache: maxBytes and maxEntryBytes must not be negative"))
+	}
+	if c.DefaultTTL < 0 || c.StaleWhileRevalidate < 0 || c.StaleIfError < 0 {
+		errs = append(errs, errors.New("cache: defaultTTL, staleWhileRevalidate and staleIfError must not be negative"))
+	}
+	for i, route := range c.Routes {
+		prefix := fmt.Sprintf("cache.routes[%d]", i)
+		if len(route.Paths) == 0 {
+			errs = append(errs, fmt.Errorf("%s: at least one path is required", prefix))
+		}
+		if route.TTL < 0 || route.StaleWhileRevalidate < 0 || route.StaleIfError < 0 {
+			errs = append(errs, fmt.Errorf("%s: ttl, staleWhileRevalidate and staleIfError must not be negative", prefix))
+		}
+	}
+	return errs
+}
+
+// validate verifica o armazenamento, os planos e as cotas e os planos dos clientes OAuth
+func (q QuotaConfig) validate(redis RedisConfig, clients []OAuthClientConfig) []error {
+	var errs []error
+	switch q.Store {
+	case "", "memory":
+	case "redis":
+		if redis.Addr == "" {
+			errs = append(errs, errors.New("quotas: store redis requires redis.addr"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("quotas: unknown store %q", q.Store))
+	}
+
+	plans := make(map[string]bool)
+	for i, plan := range q.Plans {
+		prefix := fmt.Sprintf("quotas.plans[%d]", i)
+		switch {
+		case plan.Name == "":
+			errs = append(errs, fmt.Errorf("%s: name is required", prefix))
+		case plans[plan.Name]:
+			errs = append(errs, fmt.Errorf("%s: duplicate name %q", prefix, plan.Name))
+		}
+		plans[plan.Name] = true
+
+		names := make(map[string]bool)
+		for j, quota := range plan.Quotas {
+			prefix := fmt.Sprintf("%s.quotas[%d]", prefix, j)
+			switch {
+			case quota.Name == "":
+				errs = append(errs, fmt.Errorf("%s: name is required", prefix))
+			case names[quota.Name]:
+				errs = append(errs, fmt.Errorf("%s: duplicate name %q", prefix, quota.Name))
+			}
+			names[quota.Name] = true
+
+			switch quota.Window {
+			case "", "daily", "monthly":
+			default:
+				errs = append(errs, fmt.Errorf("%s: unknown window %q, expected daily or monthly", prefix, quota.Window))
+			}
+			if quota.Requests <= 0 {
+				errs = append(errs, fmt.Errorf("%s: requests must be positive", prefix))
+			}
+			for k, method := range quota.Methods {
+				quota.Methods[k] = strings.ToUpper(method)
+				if !validMethods[quota.Methods[k]] {
+					errs = append(errs, fmt.Errorf("%s: invalid method %q", prefix, method))
+				}
+			}
+		}
+	}
+	if q.DefaultPlan != "" && !plans[q.DefaultPlan] {
+		errs = append(errs, fmt.Errorf("quotas: defaultPlan %q is not declared in plans", q.DefaultPlan))
+	}
+	for _, client := range clients {
+		if client.Plan != "" && !plans[client.Plan] {
+			errs = append(errs, fmt.Errorf("auth.oauth.clients %s: plan %q is not declared in quotas.plans", client.ID, client.Plan))
+		}
+	}
+	return errs
+}
+
+// validateSessionOrigins verifica as origens do modo de sessão, que precisam estar entre as
+// origens do CORS para que o navegador envie os cookies
+func (c *Config) validateSessionOrigins() []error {
+	var errs []error
+
+	for i, origin := range c.Cors.SessionOrigins {
+		prefix := fmt.Sprintf("cors.sessionOrigins[%d] %s", i, origin.Origin)
+		if origin.Origin == "" || origin.Origin == "*" {
+			errs = append(errs, fmt.Errorf("%s: an explicit origin is required", prefix))
+		} else if !contains(c.Cors.AllowedOrigins, origin.Origin) {
+			errs = append(errs, fmt.Errorf("%s: origin must be listed in cors.allowedOrigins", prefix))
+		}
+		switch strings.ToLower(origin.SameSite) {
+		case "", "strict", "lax":
+		case "none":
+			if origin.Insecure {
+				errs = append(errs, fmt.Errorf("%s: sameSite none requires secure cookies", prefix))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown sameSite %q", prefix, origin.SameSite))
+		}
+	}
+
+	return errs
+}
+
+// contains indica se value está na lista
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validPermission verifica o formato "recurso:ação". Nas permissões concedidas aos papéis
+// também são aceitos os curingas "recurso:*" e "*".
+func validPermission(permission string, allowWildcard bool) bool {
+	if permission == "*" {
+		return allowWildcard
+	}
+	resource, action, ok := strings.Cut(permission, ":")
+	if !ok || resource == "" || action == "" || strings.ContainsAny(resource, ":*") || strings.Contains(action, ":") {
+		return false
+	}
+	return action != "*" || allowWildcard
+}
+
+// validateTimeout verifica o timeout de uma rota ou serviço, que não pode ultrapassar
+// o tempo que o servidor espera para escrever a resposta
+func (c *Config) validateTimeout(prefix string, timeout time.Duration) []error {
+	if timeout < 0 {
+		return []error{fmt.Errorf("%s must not be negative", prefix)}
+	}
+	if c.Server.WriteTimeout > 0 && timeout > c.Server.WriteTimeout {
+		return []error{fmt.Errorf("%s (%s) exceeds server.writeTimeout (%s)", prefix, timeout, c.Server.WriteTimeout)}
+	}
+	return nil
+}
+
+// validate verifica uma política de repetição
+func (r RetryConfig) validate(prefix string) []error {
+	var errs []error
+
+	if r.MaxAttempts < 0 {
+		errs = append(errs, fmt.Errorf("%s: maxAttempts must not be negative", prefix))
+	}
+	if r.BaseBackoff < 0 || r.MaxBackoff < 0 {
+		errs = append(errs, fmt.Errorf("%s: backoff must not be negative", prefix))
+	}
+	if r.MaxBackoff > 0 && r.BaseBackoff > r.MaxBackoff {
+		errs = append(errs, fmt.Errorf("%s: baseBackoff must not exceed maxBackoff", prefix))
+	}
+	for _, status := range r.RetryOn {
+		if status < 100 || status > 599 {
+			errs = append(errs, fmt.Errorf("%s: invalid status %d in retryOn", prefix, status))
+		}
+	}
+
+	return errs
+}
+
+// validMethods lista os métodos HTTP aceitos na tabela de rotas
+var validMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"OPTIONS": true,
+}
+
 // setDefaults define valores padrão para configurações
-func setDefaults() {
-	viper.SetDefault("server.port", "8080")
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.port", "8080")
+	v.SetDefault("server.readTimeout", 15*time.Second)
+	v.SetDefault("server.writeTimeout", 15*time.Second)
+	v.SetDefault("server.idleTimeout", 60*time.Second)
+
+	// Tempo máximo das chamadas aos serviços que não definem o seu
+	v.SetDefault("serviceDefaults.timeout", 10*time.Second)
 
 	// Configurações padrão para serviços
-	viper.SetDefault("services.catalog.host", "catalog")
-	viper.SetDefault("services.catalog.port", "8081")
+	v.SetDefault("services.catalog.host", "catalog")
+	v.SetDefault("services.catalog.port", "8081")
 
-	viper.SetDefault("services.order.host", "order")
-	viper.SetDefault("services.order.port", "8082")
+	v.SetDefault("services.order.host", "order")
+	v.SetDefault("services.order.port", "8082")
 
-	viper.SetDefault("services.cart.host", "cart")
-	viper.SetDefault("services.cart.port", "8083")
+	v.SetDefault("services.cart.host", "cart")
+	v.SetDefault("services.cart.port", "8083")
 
-	viper.SetDefault("services.user.host", "user")
-	viper.SetDefault("services.user.port", "8084")
+	v.SetDefault("services.user.host", "user")
+	v.SetDefault("services.user.port", "8084")
 
-	viper.SetDefault("services.payment.host", "payment")
-	viper.SetDefault("services.payment.port", "8085")
+	v.SetDefault("services.payment.host", "payment")
+	v.SetDefault("services.payment.port", "8085")
 
-	viper.SetDefault("services.inventory.host", "inventory")
-	viper.SetDefault("services.inventory.port", "8086")
+	v.SetDefault("services.inventory.host", "inventory")
+	v.SetDefault("services.inventory.port", "8086")
 
-	viper.SetDefault("services.notification.host", "notification")
-	viper.SetDefault("services.notification.port", "8087")
+	v.SetDefault("services.notification.host", "notification")
+	v.SetDefault("services.notification.port", "8087")
 
 	// Configurações de autenticação
-	viper.SetDefault("auth.jwtsecret", "your-secret-key")
-	viper.SetDefault("auth.tokenExpiry", 60) // 60 minutos
+	v.SetDefault("auth.jwtsecret", "your-secret-key")
+	v.SetDefault("auth.tokenExpiry", 60) // 60 minutos
+	v.SetDefault("auth.apiKeys.header", "X-API-Key")
+	v.SetDefault("auth.oauth.issuer", "api-gateway")
+	v.SetDefault("auth.oauth.tokenTTL", 5*time.Minute)
+	v.SetDefault("auth.session.cookieName", "gw_session")
+	v.SetDefault("auth.session.csrfCookieName", "XSRF-TOKEN")
+	v.SetDefault("auth.session.csrfHeader", "X-XSRF-TOKEN")
+	v.SetDefault("auth.session.refreshCookie", "gw_refresh")
+	v.SetDefault("auth.session.path", "/")
+	v.SetDefault("auth.loginProtection.accountFields", []string{"email", "username"})
+	v.SetDefault("auth.loginProtection.deviceHeader", "X-Device-ID")
+	v.SetDefault("auth.impersonation.tokenTTL", 15*time.Minute)
+	v.SetDefault("auth.impersonation.deniedPaths", []string{
+		"/api/payments/*path", "/api/auth/*path", "/api/v1/auth/*path", "/api/admin/*path", "/api/v1/admin/*path",
+		"/api/v1/users/me/sessions/*path",
+		"PUT /api/v1/users/me", "POST /api/v1/users/me/addresses", "PUT /api/v1/users/me/addresses/:id", "DELETE /api/v1/users/me/addresses/:id",
+		"PUT /api/users/profile", "POST /api/users/addresses", "PUT /api/users/addresses/:id", "DELETE /api/users/addresses/:id",
+	})
+
+	// Identidade repassada aos serviços
+	v.SetDefault("identity.header", "X-Gateway-Identity")
+	v.SetDefault("identity.userIdHeader", "X-User-ID")
+	v.SetDefault("identity.issuer", "api-gateway")
+	v.SetDefault("identity.ttl", 30*time.Second)
+	v.SetDefault("identity.stripHeaders", []string{"X-User-*", "X-Auth-*", "X-Authenticated-*", "X-Forwarded-User", "X-Remote-User"})
 
 	// Configurações CORS
-	viper.SetDefault("cors.allowedOrigins", []string{"*"})
-} 
\ No newline at end of file
+	v.SetDefault("cors.allowedOrigins", []string{"*"})
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// APIKeyHandler gerencia as chaves de API de parceiros e integrações
+type APIKeyHandler struct {
+	apiKeys *auth.APIKeys
+}
+
+// NewAPIKeyHandler cria uma nova instância do handler de chaves de API
+func NewAPIKeyHandler(apiKeys *auth.APIKeys) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeys: apiKeys,
+	}
+}
+
+// CreateAPIKeyRequest representa os dados de uma nova chave
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Subject   string     `json:"subject"`
+	Roles     []string   `json:"roles"`
+	Scopes    []string   `json:"scopes"`
+	RateLimit int        `json:"rateLimit" binding:"min=0"`
+	Plan      string     `json:"plan"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// RotateAPIKeyRequest representa o corpo opcional da rotação
+type RotateAPIKeyRequest struct {
+	GracePeriod string `json:"gracePeriod"` // ex.: "24h"; o segredo anterior vale por esse tempo
+}
+
+// APIKeyResponse representa uma chave recém emitida; o valor não é exibido novamente
+type APIKeyResponse struct {
+	Key    string       `json:"key"`
+	APIKey *auth.APIKey `json:"apiKey"`
+}
+
+// List retorna as chaves cadastradas, sem os segredos
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.apiKeys.List(c.Request.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Erro ao listar chaves de API")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao listar chaves de API",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// Create emite uma nova chave de API
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Dados da chave de API inválidos",
+		})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A data de expiração deve estar no futuro",
+		})
+		return
+	}
+
+	key, secret, err := h.apiKeys.Create(c.Request.Context(), auth.APIKeySpec{
+		Name:      req.Name,
+		Subject:   req.Subject,
+		Roles:     req.Roles,
+		Scopes:    req.Scopes,
+		RateLimit: req.RateLimit,
+		Plan:      req.Plan,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Erro ao criar chave de API")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Erro ao criar chave de API",
+		})
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{"api_key_id": key.ID, "name": key.Name}).Info("Chave de API criada")
+	c.JSON(http.StatusCreated, APIKeyResponse{Key: secret, APIKey: key})
+}
+
+// Rotate emite um novo segredo para a chave, mantendo o ID
+func (h *APIKeyHandler) Rotate(c *gin.Context) {
+	var req RotateAPIKeyRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Dados de rotação inválidos",
+			})
+			return
+		}
+	}
+
+	var grace time.Duration
+	if req.GracePeriod != "" {
+		var err error
+		if grace, err = time.ParseDuration(req.GracePeriod); err != nil || grace < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Período de carência inválido",
+			})
+			return
+		}
+	}
+
+	key, secret, err := h.apiKeys.Rotate(c.Request.Context(), c.Param("id"), grace)
+	if err != nil {
+		h.respondError(c, err, "Erro ao rotacionar chave de API")
+		return
+	}
+
+	logrus.WithField("api_key_id", key.ID).Info("Chave de API rotacionada")
+	c.JSON(http.StatusOK, APIKeyResponse{Key: secret, APIKey: key})
+}
+
+// Revoke invalida a chave imediatamente
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	if err := h.apiKeys.Revoke(c.Request.Context(), c.Param("id")); err != nil {
+		h.respondError(c, err, "Erro ao revogar chave de API")
+		return
+	}
+
+	logrus.WithField("api_key_id", c.Param("id")).Info("Chave de API revogada")
+	c.Status(http.StatusNoContent)
+}
+
+// respondError traduz os erros do gerenciamento de chaves
+func (h *APIKeyHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, auth.ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Chave de API não encontrada",
+		})
+	case errors.Is(err, auth.ErrInvalidAPIKey):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Chave de API revogada",
+		})
+	default:
+		logrus.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": message,
+		})
+	}
+}
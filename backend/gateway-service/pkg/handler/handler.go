@@ -1,8 +1,20 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
 	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/middleware/cache"
+	"github.com/ecommerce/gateway-service/pkg/middleware/quota"
+	"github.com/ecommerce/gateway-service/pkg/policy"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
+	"github.com/ecommerce/gateway-service/pkg/resilience"
 	"github.com/ecommerce/gateway-service/pkg/service"
+	"github.com/gin-gonic/gin"
 )
 
 // Handlers contém todos os manipuladores de requisições da API
@@ -14,20 +26,81 @@ type Handlers struct {
 	UserHandler      *UserHandler
 	HealthHandler    *HealthHandler
 	DashboardHandler *DashboardHandler
+	SessionHandler   *SessionHandler
+	PolicyHandler    *PolicyHandler
+	APIKeyHandler    *APIKeyHandler
+	OAuthHandler     *OAuthHandler   // nil quando auth.oauth está desativado
+	RefreshHandler   *RefreshHandler // nil quando auth.refresh está desativado
+	UsageHandler     *UsageHandler   // nil quando quotas está desativado
+	// ImpersonationHandler é nil quando auth.impersonation está desativado
+	ImpersonationHandler *ImpersonationHandler
 }
 
-// NewHandlers inicializa todos os handlers com suas dependências
-func NewHandlers(cfg *config.Config) *Handlers {
+// NewHandlers inicializa todos os handlers com suas dependências. issuer é nil quando o
+// gateway não emite tokens, refresh é nil quando o refresh de sessões está desativado, quotas
+// é nil quando as cotas estão desativadas e responses é nil quando o cache está desativado.
+func NewHandlers(cfg *config.Config, upstreams proxy.Upstreams, authenticator *auth.Authenticator, issuer *auth.TokenIssuer,
+	refresh *auth.RefreshTokens, revocations auth.RevocationStore, apiKeys *auth.APIKeys, policies *policy.Store, quotas *quota.Quotas,
+	responses *cache.Cache) *Handlers {
 	// Inicializar serviços
-	services := service.NewServices(cfg)
+	services := service.NewServices(cfg, upstreams, responses)
 
-	return &Handlers{
+	handlers := &Handlers{
 		AuthHandler:      NewAuthHandler(services.AuthService),
 		ProductHandler:   NewProductHandler(services.CatalogService),
 		CartHandler:      NewCartHandler(services.CartService),
 		OrderHandler:     NewOrderHandler(services.OrderService),
 		UserHandler:      NewUserHandler(services.UserService),
-		HealthHandler:    NewHealthHandler(services),
+		HealthHandler:    NewHealthHandler(services, upstreams),
 		DashboardHandler: NewDashboardHandler(services),
+		SessionHandler:   NewSessionHandler(revocations, refresh, authenticator.Sessions()),
+		PolicyHandler:    NewPolicyHandler(policies),
+		APIKeyHandler:    NewAPIKeyHandler(apiKeys),
+	}
+	if cfg.Auth.OAuth.Enabled {
+		handlers.OAuthHandler = NewOAuthHandler(issuer, authenticator)
+	}
+	if refresh != nil {
+		handlers.RefreshHandler = NewRefreshHandler(refresh, authenticator.Sessions())
+	}
+	if quotas != nil {
+		handlers.UsageHandler = NewUsageHandler(quotas)
+	}
+	if impersonation := authenticator.Impersonation(); impersonation != nil {
+		handlers.ImpersonationHandler = NewImpersonationHandler(impersonation)
+	}
+	return handlers
+}
+
+// respondIfUnavailable responde 503 com Retry-After quando o circuit breaker do serviço
+// está aberto ou a requisição foi descartada pela sobrecarga do serviço ou pelo seu bulkhead,
+// e 504 quando o serviço não respondeu a tempo. Retorna true se a resposta foi enviada.
+func respondIfUnavailable(c *gin.Context, err error) bool {
+	var openErr *resilience.OpenError
+	var shedErr *resilience.ShedError
+	var bulkheadErr *resilience.BulkheadError
+	switch {
+	case errors.As(err, &openErr):
+		c.Header("Retry-After", strconv.Itoa(openErr.RetryAfterSeconds()))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Serviço temporariamente indisponível",
+		})
+	case errors.As(err, &shedErr):
+		c.Header("Retry-After", strconv.Itoa(shedErr.RetryAfterSeconds()))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Serviço sobrecarregado, tente novamente em instantes",
+		})
+	case errors.As(err, &bulkheadErr):
+		c.Header("Retry-After", strconv.Itoa(bulkheadErr.RetryAfterSeconds()))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Serviço sobrecarregado, tente novamente em instantes",
+		})
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": "Tempo de resposta do serviço esgotado",
+		})
+	default:
+		return false
 	}
+	return true
 }
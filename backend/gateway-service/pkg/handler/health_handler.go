@@ -4,42 +4,52 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
+	"github.com/ecommerce/gateway-service/pkg/resilience"
 	"github.com/ecommerce/gateway-service/pkg/service"
 	"github.com/gin-gonic/gin"
 )
 
 // HealthHandler gerencia as requisições relacionadas à saúde do sistema
 type HealthHandler struct {
-	services *service.Services
+	services  *service.Services
+	upstreams proxy.Upstreams
 }
 
 // NewHealthHandler cria uma nova instância do handler de saúde
-func NewHealthHandler(services *service.Services) *HealthHandler {
+func NewHealthHandler(services *service.Services, upstreams proxy.Upstreams) *HealthHandler {
 	return &HealthHandler{
-		services: services,
+		services:  services,
+		upstreams: upstreams,
 	}
 }
 
 // ServiceStatus representa o status de um serviço
 type ServiceStatus struct {
-	Name    string `json:"name"`
-	Status  string `json:"status"`
-	Message string `json:"message,omitempty"`
+	Name             string                 `json:"name"`
+	Status           string                 `json:"status"`
+	Message          string                 `json:"message,omitempty"`
+	CircuitBreaker   string                 `json:"circuitBreaker,omitempty"`
+	ConcurrencyLimit int                    `json:"concurrencyLimit,omitempty"` // limite adaptativo atual, quando ativo
+	BulkheadInflight int                    `json:"bulkheadInflight,omitempty"` // requisições ocupando o bulkhead
+	BulkheadQueued   int                    `json:"bulkheadQueued,omitempty"`   // requisições aguardando vaga no bulkhead
+	Instances        []proxy.EndpointStatus `json:"instances,omitempty"`
 }
 
 // Check verifica o status de todos os serviços e retorna o resultado
 func (h *HealthHandler) Check(c *gin.Context) {
 	startTime := time.Now()
 
-	// Verifique o status de cada serviço (simulado por enquanto)
-	services := []ServiceStatus{
-		{Name: "gateway", Status: "UP"},
-		{Name: "auth", Status: "UP"},
-		{Name: "catalog", Status: "UP"},
-		{Name: "cart", Status: "UP"},
-		{Name: "order", Status: "UP"},
-		{Name: "user", Status: "UP"},
-		// Adicione mais serviços conforme necessário
+	// O gateway está no ar; os demais serviços refletem o estado das suas instâncias
+	overall := "UP"
+	services := []ServiceStatus{{Name: "gateway", Status: "UP"}}
+	for _, name := range config.ServiceNames {
+		status := serviceStatus(h.upstreams[name])
+		if status.Status != "UP" {
+			overall = "DEGRADED"
+		}
+		services = append(services, status)
 	}
 
 	// Calcular tempo de resposta
@@ -47,10 +57,46 @@ func (h *HealthHandler) Check(c *gin.Context) {
 
 	// Construir resposta
 	c.JSON(http.StatusOK, gin.H{
-		"status":       "UP",
+		"status":       overall,
 		"services":     services,
 		"responseTime": responseTime,
 		"timestamp":    time.Now().Format(time.RFC3339),
 		"version":      "1.0.0", // Versão da API
 	})
 }
+
+// serviceStatus resume o estado de um serviço: UP com todas as instâncias disponíveis,
+// DEGRADED com parte delas e DOWN quando nenhuma pode receber tráfego ou o circuito está aberto
+func serviceStatus(upstream *proxy.Upstream) ServiceStatus {
+	instances := upstream.Status()
+	breaker := upstream.BreakerState()
+	inflight, queued := upstream.Bulkhead()
+
+	up := 0
+	for _, instance := range instances {
+		if instance.Status == "UP" {
+			up++
+		}
+	}
+
+	status := ServiceStatus{
+		Name:             upstream.Name(),
+		Status:           "DEGRADED",
+		CircuitBreaker:   breaker.String(),
+		ConcurrencyLimit: upstream.ConcurrencyLimit(),
+		BulkheadInflight: inflight,
+		BulkheadQueued:   queued,
+		Instances:        instances,
+	}
+	switch {
+	case up == 0:
+		status.Status = "DOWN"
+		status.Message = "nenhuma instância disponível"
+	case breaker == resilience.StateOpen:
+		status.Status = "DOWN"
+		status.Message = "circuit breaker aberto"
+	case up == len(instances) && breaker == resilience.StateClosed:
+		status.Status = "UP"
+	}
+	return status
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ImpersonationHandler emite os tokens com que o suporte vê a loja como um cliente
+type ImpersonationHandler struct {
+	impersonation *auth.Impersonation
+}
+
+// NewImpersonationHandler cria uma nova instância do handler de impersonação
+func NewImpersonationHandler(impersonation *auth.Impersonation) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		impersonation: impersonation,
+	}
+}
+
+// ImpersonateRequest representa o pedido de impersonação; o motivo (ex.: o chamado de
+// suporte) vai para a auditoria
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ImpersonateResponse representa o token de impersonação emitido
+type ImpersonateResponse struct {
+	Token       string   `json:"token"`
+	TokenType   string   `json:"tokenType"`
+	ExpiresIn   int      `json:"expiresIn"`
+	SubjectID   string   `json:"subjectId"`
+	ActorID     string   `json:"actorId"`
+	DeniedPaths []string `json:"deniedPaths"`
+}
+
+// Impersonate emite um token curto com que o administrador age como o usuário informado.
+// O token não acessa pagamentos, senha nem administração e todo uso é auditado.
+func (h *ImpersonationHandler) Impersonate(c *gin.Context) {
+	actor, ok := auth.PrincipalFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Usuário não autenticado",
+		})
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Informe o motivo da impersonação",
+		})
+		return
+	}
+
+	subject := c.Param("id")
+	token, ttl, err := h.impersonation.Start(c, actor, subject, strings.TrimSpace(req.Reason))
+	if errors.Is(err, auth.ErrSelfImpersonation) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Não é possível impersonar o próprio usuário",
+		})
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Erro ao emitir token de impersonação")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Não foi possível iniciar a impersonação",
+		})
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{"actor_id": actor.UserID, "subject_id": subject}).Warn("Impersonação iniciada")
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, ImpersonateResponse{
+		Token:       token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+		SubjectID:   subject,
+		ActorID:     actor.UserID,
+		DeniedPaths: h.impersonation.DeniedPaths(),
+	})
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// OAuthHandler implementa o endpoint de tokens OAuth2 (grant client_credentials) e a
+// introspecção de tokens. As respostas seguem o formato das RFC 6749 e 7662.
+type OAuthHandler struct {
+	issuer        *auth.TokenIssuer
+	authenticator *auth.Authenticator
+}
+
+// NewOAuthHandler cria uma nova instância do handler OAuth
+func NewOAuthHandler(issuer *auth.TokenIssuer, authenticator *auth.Authenticator) *OAuthHandler {
+	return &OAuthHandler{
+		issuer:        issuer,
+		authenticator: authenticator,
+	}
+}
+
+// TokenResponse representa um token emitido
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// IntrospectionResponse representa o estado de um token; tokens inválidos só informam active=false
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// Token emite um token para um cliente registrado (grant_type=client_credentials).
+// O cliente se autentica por HTTP Basic ou pelos campos client_id e client_secret.
+func (h *OAuthHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	if grantType := c.PostForm("grant_type"); grantType != "client_credentials" {
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "Apenas o grant client_credentials é suportado")
+		return
+	}
+
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	token, err := h.issuer.Issue(client, strings.Fields(c.PostForm("scope")))
+	if errors.Is(err, auth.ErrInvalidScope) {
+		oauthError(c, http.StatusBadRequest, "invalid_scope", "Escopo não permitido para o cliente")
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("client_id", client.ID).Error("Erro ao emitir token OAuth")
+		oauthError(c, http.StatusInternalServerError, "server_error", "Erro ao emitir token")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{"client_id": client.ID, "scope": token.Scopes}).Info("Token OAuth emitido")
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(token.ExpiresIn.Seconds()),
+		Scope:       strings.Join(token.Scopes, " "),
+	})
+}
+
+// Introspect informa se um token é válido e quais são as suas claims. Apenas clientes
+// registrados podem consultar.
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	if _, ok := h.authenticateClient(c); !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "Token não informado")
+		return
+	}
+
+	principal, err := h.authenticator.Verify(c.Request.Context(), token)
+	if err != nil {
+		if !errors.Is(err, auth.ErrInvalidToken) && !errors.Is(err, auth.ErrRevokedToken) {
+			logrus.WithError(err).Error("Erro ao verificar token na introspecção")
+			oauthError(c, http.StatusServiceUnavailable, "temporarily_unavailable", "Não foi possível verificar o token")
+			return
+		}
+		c.JSON(http.StatusOK, IntrospectionResponse{Active: false})
+		return
+	}
+
+	resp := IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(principal.Scopes, " "),
+		ClientID:  principal.ClientID,
+		Username:  principal.Username,
+		TokenType: "Bearer",
+		Exp:       principal.ExpiresAt.Unix(),
+		Sub:       principal.UserID,
+		Iss:       principal.Issuer,
+		Jti:       principal.TokenID,
+		Roles:     principal.Roles,
+	}
+	if !principal.IssuedAt.IsZero() {
+		resp.Iat = principal.IssuedAt.Unix()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// authenticateClient valida as credenciais do cliente e responde invalid_client quando falham
+func (h *OAuthHandler) authenticateClient(c *gin.Context) (client config.OAuthClientConfig, ok bool) {
+	id, secret, basic := c.Request.BasicAuth()
+	if !basic {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	client, err := h.issuer.AuthenticateClient(id, secret)
+	if err != nil {
+		logrus.WithField("client_id", id).Warn("Falha na autenticação de cliente OAuth")
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Credenciais do cliente inválidas")
+		return client, false
+	}
+	return client, true
+}
+
+// oauthError responde no formato de erro da RFC 6749
+func oauthError(c *gin.Context, status int, code, description string) {
+	c.JSON(status, gin.H{
+		"error":             code,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/policy"
+	"github.com/gin-gonic/gin"
+)
+
+// PolicyHandler permite simular as decisões das políticas de acesso
+type PolicyHandler struct {
+	policies *policy.Store
+}
+
+// NewPolicyHandler cria uma nova instância do handler de políticas
+func NewPolicyHandler(policies *policy.Store) *PolicyHandler {
+	return &PolicyHandler{
+		policies: policies,
+	}
+}
+
+// PolicyPrincipal representa o usuário simulado na avaliação, com os atributos aceitos nas
+// condições das políticas (principal.*)
+type PolicyPrincipal struct {
+	ID         string   `json:"id"`
+	Username   string   `json:"username"`
+	Email      string   `json:"email"`
+	Issuer     string   `json:"issuer"`
+	TokenID    string   `json:"tokenId"`
+	Roles      []string `json:"roles"`
+	Scopes     []string `json:"scopes"`
+	AuthMethod string   `json:"authMethod"`
+	APIKeyID   string   `json:"apiKeyId"`
+	ClientID   string   `json:"clientId"`
+	ActorID    string   `json:"actorId"`
+}
+
+// EvaluatePolicyRequest representa a requisição simulada. Sem principal a requisição é
+// avaliada como anônima; sem resource as condições sobre o recurso não são satisfeitas.
+type EvaluatePolicyRequest struct {
+	Method    string                 `json:"method" binding:"required"`
+	Path      string                 `json:"path" binding:"required"`
+	Principal *PolicyPrincipal       `json:"principal"`
+	Query     map[string]string      `json:"query"`
+	Headers   map[string]string      `json:"headers"`
+	Resource  map[string]interface{} `json:"resource"`
+}
+
+// Evaluate avalia as políticas ativas para a requisição simulada, sem consultar os serviços,
+// e explica a decisão de cada política
+func (h *PolicyHandler) Evaluate(c *gin.Context) {
+	var req EvaluatePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Dados de avaliação inválidos",
+		})
+		return
+	}
+
+	in := &policy.Input{
+		Method: strings.ToUpper(req.Method),
+		Path:   req.Path,
+		Query:  url.Values{},
+		Header: http.Header{},
+	}
+	for key, value := range req.Query {
+		in.Query.Set(key, value)
+	}
+	for key, value := range req.Headers {
+		in.Header.Set(key, value)
+	}
+	if p := req.Principal; p != nil {
+		in.Principal = &auth.Principal{
+			UserID:     p.ID,
+			Username:   p.Username,
+			Email:      p.Email,
+			Issuer:     p.Issuer,
+			TokenID:    p.TokenID,
+			Roles:      p.Roles,
+			Scopes:     p.Scopes,
+			AuthMethod: p.AuthMethod,
+			APIKeyID:   p.APIKeyID,
+			ClientID:   p.ClientID,
+			ActorID:    p.ActorID,
+		}
+	}
+
+	decision, err := h.policies.Policies().Evaluate(c.Request.Context(), in, policy.StaticResource(req.Resource), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Não foi possível avaliar as políticas: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, decision)
+}
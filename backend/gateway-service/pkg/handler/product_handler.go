@@ -40,9 +40,12 @@ func (h *ProductHandler) GetAll(c *gin.Context) {
 	}
 
 	// Buscar produtos do serviço de catálogo
-	products, total, err := h.catalogService.GetAllProducts(page, size)
+	products, total, err := h.catalogService.GetAllProducts(c.Request.Context(), page, size)
 	if err != nil {
 		logrus.WithError(err).Error("Erro ao obter produtos")
+		if respondIfUnavailable(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Erro ao obter produtos",
 		})
@@ -70,9 +73,12 @@ func (h *ProductHandler) GetByID(c *gin.Context) {
 	}
 
 	// Buscar produto do serviço de catálogo
-	product, err := h.catalogService.GetProductByID(id)
+	product, err := h.catalogService.GetProductByID(c.Request.Context(), id)
 	if err != nil {
 		logrus.WithError(err).Error("Erro ao obter produto")
+		if respondIfUnavailable(c, err) {
+			return
+		}
 
 		// Verificar se o produto não foi encontrado
 		if err.Error() == "produto não encontrado" {
@@ -94,9 +100,12 @@ func (h *ProductHandler) GetByID(c *gin.Context) {
 // GetCategories retorna todas as categorias
 func (h *ProductHandler) GetCategories(c *gin.Context) {
 	// Buscar categorias do serviço de catálogo
-	categories, err := h.catalogService.GetCategories()
+	categories, err := h.catalogService.GetCategories(c.Request.Context())
 	if err != nil {
 		logrus.WithError(err).Error("Erro ao obter categorias")
+		if respondIfUnavailable(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Erro ao obter categorias",
 		})
@@ -133,9 +142,12 @@ func (h *ProductHandler) Search(c *gin.Context) {
 	}
 
 	// Buscar produtos do serviço de catálogo
-	products, total, err := h.catalogService.SearchProducts(query, page, size)
+	products, total, err := h.catalogService.SearchProducts(c.Request.Context(), query, page, size)
 	if err != nil {
 		logrus.WithError(err).Error("Erro ao buscar produtos")
+		if respondIfUnavailable(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Erro ao buscar produtos",
 		})
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RefreshHandler troca os refresh tokens emitidos pelo gateway e permite ao cliente ver e
+// encerrar as sessões abertas nos seus dispositivos
+type RefreshHandler struct {
+	refresh  *auth.RefreshTokens
+	sessions *auth.Sessions // nil quando o modo de sessão por cookie está desativado
+}
+
+// NewRefreshHandler cria uma nova instância do handler de refresh
+func NewRefreshHandler(refresh *auth.RefreshTokens, sessions *auth.Sessions) *RefreshHandler {
+	return &RefreshHandler{
+		refresh:  refresh,
+		sessions: sessions,
+	}
+}
+
+// RefreshRequest representa o corpo do refresh; no modo de sessão o token vem do cookie
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// RefreshResponse representa os tokens emitidos no refresh
+type RefreshResponse struct {
+	Token            string `json:"token"`
+	TokenType        string `json:"tokenType"`
+	ExpiresIn        int    `json:"expiresIn"`
+	RefreshToken     string `json:"refreshToken"`
+	RefreshExpiresIn int    `json:"refreshExpiresIn"`
+	SessionID        string `json:"sessionId"`
+}
+
+// SessionResponse representa uma sessão aberta em um dispositivo
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// Refresh troca o refresh token por um novo e emite um token de acesso. O reuso de um token
+// já trocado encerra a sessão inteira.
+func (h *RefreshHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Dados de refresh inválidos",
+			})
+			return
+		}
+	}
+	if req.RefreshToken == "" && h.sessions != nil {
+		req.RefreshToken = h.sessions.RefreshToken(c.Request)
+	}
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Refresh token não fornecido",
+		})
+		return
+	}
+
+	tokens, err := h.refresh.Refresh(c.Request.Context(), req.RefreshToken, c.ClientIP())
+	if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		if h.sessions != nil {
+			h.sessions.End(c)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Refresh token inválido ou expirado",
+		})
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Erro ao renovar sessão")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Não foi possível renovar a sessão",
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, RefreshResponse{
+		Token:            tokens.AccessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(tokens.ExpiresIn.Seconds()),
+		RefreshToken:     tokens.RefreshToken,
+		RefreshExpiresIn: int(time.Until(tokens.Session.IdleUntil).Seconds()),
+		SessionID:        tokens.Session.ID,
+	})
+}
+
+// ListSessions retorna as sessões ativas do usuário, indicando a da requisição
+func (h *RefreshHandler) ListSessions(c *gin.Context) {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Usuário não autenticado",
+		})
+		return
+	}
+
+	sessions, err := h.refresh.Sessions(c.Request.Context(), principal.UserID)
+	if err != nil {
+		logrus.WithError(err).Error("Erro ao listar sessões")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Não foi possível listar as sessões",
+		})
+		return
+	}
+	current, err := h.refresh.Current(c.Request.Context(), principal)
+	if err != nil {
+		logrus.WithError(err).Warn("Erro ao identificar a sessão atual")
+	}
+
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, SessionResponse{
+			ID:         session.ID,
+			Device:     session.Device,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == current,
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeSession encerra uma sessão do usuário, como a de um dispositivo perdido
+func (h *RefreshHandler) RevokeSession(c *gin.Context) {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Usuário não autenticado",
+		})
+		return
+	}
+
+	err := h.refresh.Revoke(c.Request.Context(), principal.UserID, c.Param("id"))
+	if errors.Is(err, auth.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Sessão não encontrada",
+		})
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Erro ao encerrar sessão")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Não foi possível encerrar a sessão",
+		})
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{"user_id": principal.UserID, "session_id": c.Param("id")}).Info("Sessão encerrada")
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeOtherSessions encerra todas as sessões do usuário, exceto a da requisição
+func (h *RefreshHandler) RevokeOtherSessions(c *gin.Context) {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Usuário não autenticado",
+		})
+		return
+	}
+
+	current, err := h.refresh.Current(c.Request.Context(), principal)
+	var revoked int
+	if err == nil {
+		revoked, err = h.refresh.RevokeAll(c.Request.Context(), principal.UserID, current)
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Erro ao encerrar sessões")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Não foi possível encerrar as sessões",
+		})
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{"user_id": principal.UserID, "revoked": revoked}).Info("Outras sessões encerradas")
+	c.JSON(http.StatusOK, gin.H{
+		"revoked": revoked,
+	})
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// SessionHandler gerencia o encerramento de sessões, revogando tokens no gateway
+type SessionHandler struct {
+	revocations auth.RevocationStore
+	refresh     *auth.RefreshTokens // nil quando o refresh de sessões está desativado
+	sessions    *auth.Sessions      // nil quando o modo de sessão por cookie está desativado
+}
+
+// NewSessionHandler cria uma nova instância do handler de sessões
+func NewSessionHandler(revocations auth.RevocationStore, refresh *auth.RefreshTokens, sessions *auth.Sessions) *SessionHandler {
+	return &SessionHandler{
+		revocations: revocations,
+		refresh:     refresh,
+		sessions:    sessions,
+	}
+}
+
+// LogoutRequest representa o corpo opcional do logout
+type LogoutRequest struct {
+	AllDevices bool `json:"allDevices"`
+}
+
+// Logout revoga o token da requisição ou, com allDevices, todos os tokens do usuário.
+// Tokens sem jti só podem ser revogados junto com os demais tokens do usuário. As sessões de
+// refresh correspondentes são encerradas e, no modo de sessão, os cookies são removidos.
+func (h *SessionHandler) Logout(c *gin.Context) {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Usuário não autenticado",
+		})
+		return
+	}
+
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Dados de logout inválidos",
+			})
+			return
+		}
+	}
+
+	var err error
+	if req.AllDevices || principal.TokenID == "" {
+		err = h.revocations.RevokeUser(c.Request.Context(), principal.UserID, time.Now())
+	} else {
+		err = h.revocations.RevokeToken(c.Request.Context(), principal.TokenID, principal.ExpiresAt)
+	}
+	if err == nil && h.refresh != nil {
+		err = h.endRefreshSessions(c, principal, req.AllDevices)
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Erro ao revogar token")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Não foi possível encerrar a sessão",
+		})
+		return
+	}
+
+	if h.sessions != nil {
+		h.sessions.End(c)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// endRefreshSessions encerra a sessão de refresh do token da requisição ou todas as do usuário
+func (h *SessionHandler) endRefreshSessions(c *gin.Context, principal *auth.Principal, allDevices bool) error {
+	if allDevices {
+		_, err := h.refresh.RevokeAll(c.Request.Context(), principal.UserID, "")
+		return err
+	}
+
+	current, err := h.refresh.Current(c.Request.Context(), principal)
+	if err != nil || current == "" {
+		return err
+	}
+	err = h.refresh.Revoke(c.Request.Context(), principal.UserID, current)
+	if errors.Is(err, auth.ErrSessionNotFound) {
+		return nil
+	}
+	return err
+}
+
+// RevokeUserTokens revoga todos os tokens emitidos até agora para um usuário (ex.: usuário
+// bloqueado) e encerra as suas sessões de refresh
+func (h *SessionHandler) RevokeUserTokens(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "ID do usuário não fornecido",
+		})
+		return
+	}
+
+	if err := h.revocations.RevokeUser(c.Request.Context(), userID, time.Now()); err != nil {
+		logrus.WithError(err).Error("Erro ao revogar tokens do usuário")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Não foi possível revogar os tokens do usuário",
+		})
+		return
+	}
+	if h.refresh != nil {
+		if _, err := h.refresh.RevokeAll(c.Request.Context(), userID, ""); err != nil {
+			logrus.WithError(err).Error("Erro ao encerrar as sessões do usuário")
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Não foi possível encerrar as sessões do usuário",
+			})
+			return
+		}
+	}
+
+	logrus.WithField("user_id", userID).Info("Tokens do usuário revogados")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/middleware/quota"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// UsageHandler informa aos consumidores da API o consumo das suas cotas
+type UsageHandler struct {
+	quotas *quota.Quotas
+}
+
+// NewUsageHandler cria uma nova instância do handler de consumo
+func NewUsageHandler(quotas *quota.Quotas) *UsageHandler {
+	return &UsageHandler{
+		quotas: quotas,
+	}
+}
+
+// Usage retorna o plano do consumidor autenticado e o consumo de cada cota na janela atual
+func (h *UsageHandler) Usage(c *gin.Context) {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Usuário não autenticado",
+		})
+		return
+	}
+
+	usage, err := h.quotas.Usage(c.Request.Context(), principal)
+	if err != nil {
+		logrus.WithError(err).Error("Erro ao consultar o consumo das cotas")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Consumo temporariamente indisponível",
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, usage)
+}
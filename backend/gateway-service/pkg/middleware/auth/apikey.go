@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+)
+
+// apiKeyPrefix identifica as chaves emitidas pelo gateway; o formato é gwk_<id>_<segredo>
+const apiKeyPrefix = "gwk"
+
+// Erros da autenticação por chave de API
+var (
+	ErrInvalidAPIKey  = errors.New("invalid, expired or revoked API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// RateLimitedError indica que a chave excedeu o seu limite de requisições
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return "API key rate limit exceeded"
+}
+
+// RetryAfterSeconds retorna o valor do cabeçalho Retry-After, arredondado para cima
+func (e *RateLimitedError) RetryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// APIKey é uma chave de longa duração de um parceiro ou sistema interno. Apenas o hash
+// do segredo é guardado; o segredo só é conhecido no momento da emissão.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Subject   string     `json:"subject"` // identidade repassada aos serviços como usuário
+	Roles     []string   `json:"roles,omitempty"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	RateLimit int        `json:"rateLimit,omitempty"` // requisições por minuto; 0 não limita
+	Plan      string     `json:"plan,omitempty"`      // plano de cotas (quotas.plans)
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+
+	Hash string `json:"-"`
+	// O segredo anterior a uma rotação continua valendo até PreviousValidUntil
+	PreviousHash       string     `json:"-"`
+	PreviousValidUntil *time.Time `json:"previousValidUntil,omitempty"`
+}
+
+// APIKeySpec descreve uma chave a ser emitida
+type APIKeySpec struct {
+	Name      string
+	Subject   string
+	Roles     []string
+	Scopes    []string
+	RateLimit int
+	Plan      string
+	ExpiresAt *time.Time
+}
+
+// APIKeyStore guarda as chaves de API pelo ID
+type APIKeyStore interface {
+	// Get retorna a chave ou ErrAPIKeyNotFound
+	Get(ctx context.Context, id string) (*APIKey, error)
+	// List retorna todas as chaves, inclusive as revogadas
+	List(ctx context.Context) ([]*APIKey, error)
+	// Save cria ou substitui uma chave
+	Save(ctx context.Context, key *APIKey) error
+}
+
+// APIKeys autentica as requisições por chave de API e gerencia a emissão, a rotação e a
+// revogação das chaves
+type APIKeys struct {
+	store      APIKeyStore
+	enabled    bool
+	header     string
+	queryParam string
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewAPIKeys cria o autenticador de chaves de API sobre o armazenamento informado
+func NewAPIKeys(cfg config.APIKeyConfig, store APIKeyStore) *APIKeys {
+	return &APIKeys{
+		store:      store,
+		enabled:    cfg.Enabled,
+		header:     cfg.Header,
+		queryParam: cfg.QueryParam,
+		buckets:    make(map[string]*bucket),
+	}
+}
+
+// credential extrai a chave da requisição, se houver
+func (k *APIKeys) credential(r *http.Request) string {
+	if !k.enabled {
+		return ""
+	}
+	if k.header != "" {
+		if key := r.Header.Get(k.header); key != "" {
+			return key
+		}
+	}
+	if k.queryParam != "" {
+		return r.URL.Query().Get(k.queryParam)
+	}
+	return ""
+}
+
+// strip remove a chave da requisição para que ela não seja repassada aos serviços
+func (k *APIKeys) strip(r *http.Request) {
+	if k.header != "" {
+		r.Header.Del(k.header)
+	}
+	if k.queryParam != "" {
+		query := r.URL.Query()
+		if query.Has(k.queryParam) {
+			query.Del(k.queryParam)
+			r.URL.RawQuery = query.Encode()
+		}
+	}
+}
+
+// Authenticate valida a chave e retorna a identidade associada a ela
+func (k *APIKeys) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	id, secret, ok := parseAPIKey(credential)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := k.store.Get(ctx, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load API key: %w", err)
+	}
+
+	now := time.Now()
+	if !key.valid(secret, now) {
+		return nil, ErrInvalidAPIKey
+	}
+	if wait := k.take(key, now); wait > 0 {
+		return nil, &RateLimitedError{RetryAfter: wait}
+	}
+
+	return &Principal{
+		UserID:     key.Subject,
+		Username:   key.Name,
+		Roles:      key.Roles,
+		Scopes:     key.Scopes,
+		AuthMethod: AuthMethodAPIKey,
+		APIKeyID:   key.ID,
+		Plan:       key.Plan,
+	}, nil
+}
+
+// valid verifica o segredo, a expiração e a revogação da chave
+func (key *APIKey) valid(secret string, now time.Time) bool {
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return false
+	}
+
+	hash := hashSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(key.Hash)) == 1 {
+		return true
+	}
+	return key.PreviousHash != "" && key.PreviousValidUntil != nil && now.Before(*key.PreviousValidUntil) &&
+		subtle.ConstantTimeCompare([]byte(hash), []byte(key.PreviousHash)) == 1
+}
+
+// Create emite uma nova chave e retorna o valor completo, que não pode ser recuperado depois
+func (k *APIKeys) Create(ctx context.Context, spec APIKeySpec) (*APIKey, string, error) {
+	id, err := randomString(6, hex.EncodeToString)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &APIKey{
+		ID:        id,
+		Name:      spec.Name,
+		Subject:   spec.Subject,
+		Roles:     spec.Roles,
+		Scopes:    spec.Scopes,
+		RateLimit: spec.RateLimit,
+		Plan:      spec.Plan,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: spec.ExpiresAt,
+		Hash:      hashSecret(secret),
+	}
+	if key.Subject == "" {
+		key.Subject = "apikey:" + id
+	}
+
+	if err := k.store.Save(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, formatAPIKey(id, secret), nil
+}
+
+// Rotate troca o segredo da chave. O segredo anterior continua valendo por grace, para
+// que a integração possa ser atualizada sem interrupção.
+func (k *APIKeys) Rotate(ctx context.Context, id string, grace time.Duration) (*APIKey, string, error) {
+	key, err := k.store.Get(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if key.RevokedAt != nil {
+		return nil, "", ErrInvalidAPIKey
+	}
+
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	key.PreviousHash, key.PreviousValidUntil = "", nil
+	if grace > 0 {
+		validUntil := now.Add(grace)
+		key.PreviousHash, key.PreviousValidUntil = key.Hash, &validUntil
+	}
+	key.Hash = hashSecret(secret)
+	key.RotatedAt = &now
+
+	if err := k.store.Save(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, formatAPIKey(id, secret), nil
+}
+
+// Revoke invalida a chave imediatamente, inclusive o segredo anterior a uma rotação
+func (k *APIKeys) Revoke(ctx context.Context, id string) error {
+	key, err := k.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	return k.store.Save(ctx, key)
+}
+
+// List retorna todas as chaves, sem os segredos
+func (k *APIKeys) List(ctx context.Context) ([]*APIKey, error) {
+	return k.store.List(ctx)
+}
+
+// bucket controla o limite de requisições de uma chave
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take consome uma requisição do limite da chave e, se ele estiver esgotado, retorna
+// quanto tempo falta para a próxima ser aceita. O limite permite rajadas de até um
+// minuto de requisições.
+func (k *APIKeys) take(key *APIKey, now time.Time) time.Duration {
+	if key.RateLimit <= 0 {
+		return 0
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	capacity := float64(key.RateLimit)
+	perSecond := capacity / 60
+	b, ok := k.buckets[key.ID]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		k.buckets[key.ID] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// parseAPIKey separa o ID e o segredo de uma chave no formato gwk_<id>_<segredo>
+func parseAPIKey(credential string) (id, secret string, ok bool) {
+	parts := strings.SplitN(credential, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// formatAPIKey monta o valor entregue ao cliente
+func formatAPIKey(id, secret string) string {
+	return apiKeyPrefix + "_" + id + "_" + secret
+}
+
+// hashSecret calcula o hash armazenado do segredo; os segredos são aleatórios e longos,
+// então um hash rápido é suficiente
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString gera n bytes aleatórios codificados por encode
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// apiKeyFileCheckInterval limita a frequência com que o arquivo de chaves é verificado
+const apiKeyFileCheckInterval = time.Second
+
+// fileAPIKeyStore mantém as chaves em memória e as persiste em um arquivo JSON a cada
+// alteração. O arquivo é relido quando muda, para que as réplicas que compartilham o volume
+// vejam as chaves criadas, rotacionadas e revogadas pelas outras; as alterações devem ser
+// feitas por uma réplica de cada vez, pois gravações simultâneas não são coordenadas.
+type fileAPIKeyStore struct {
+	path string
+
+	mu        sync.RWMutex
+	keys      map[string]*APIKey
+	modTime   time.Time // versão do arquivo carregada
+	checkedAt time.Time
+}
+
+// storedAPIKey é o formato persistido, que inclui os hashes omitidos nas respostas da API
+type storedAPIKey struct {
+	*APIKey
+	Hash         string `json:"hash"`
+	PreviousHash string `json:"previousHash,omitempty"`
+}
+
+// NewFileAPIKeyStore cria o armazenamento de chaves sobre o arquivo informado, carregando
+// as chaves existentes. Com path vazio as chaves ficam apenas em memória.
+func NewFileAPIKeyStore(path string) (APIKeyStore, error) {
+	s := &fileAPIKeyStore{path: path, keys: make(map[string]*APIKey)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.checkedAt = time.Now()
+	return s, nil
+}
+
+// load lê o arquivo quando ele mudou desde a última leitura; chamado com s.mu travado
+func (s *fileAPIKeyStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var stored []storedAPIKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("parse API keys file %s: %w", s.path, err)
+	}
+
+	keys := make(map[string]*APIKey, len(stored))
+	for _, item := range stored {
+		if item.APIKey == nil || item.ID == "" {
+			continue
+		}
+		item.APIKey.Hash, item.APIKey.PreviousHash = item.Hash, item.PreviousHash
+		keys[item.ID] = item.APIKey
+	}
+	s.keys, s.modTime = keys, info.ModTime()
+	return nil
+}
+
+// refresh relê o arquivo alterado por outra réplica, no máximo a cada apiKeyFileCheckInterval.
+// Um arquivo inválido é ignorado e as chaves carregadas continuam valendo.
+func (s *fileAPIKeyStore) refresh() {
+	if s.path == "" {
+		return
+	}
+
+	s.mu.RLock()
+	due := time.Since(s.checkedAt) >= apiKeyFileCheckInterval
+	s.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.checkedAt) < apiKeyFileCheckInterval {
+		return
+	}
+	s.checkedAt = time.Now()
+	if err := s.load(); err != nil {
+		logrus.WithError(err).WithField("file", s.path).Warn("Falha ao recarregar as chaves de API; mantendo as chaves atuais")
+	}
+}
+
+func (s *fileAPIKeyStore) Get(ctx context.Context, id string) (*APIKey, error) {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (s *fileAPIKeyStore) List(ctx context.Context) ([]*APIKey, error) {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (s *fileAPIKeyStore) Save(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Parte da versão mais recente do arquivo, para não desfazer as alterações de outra réplica
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	previous, existed := s.keys[key.ID]
+	copied := *key
+	s.keys[key.ID] = &copied
+
+	if err := s.persist(); err != nil {
+		if existed {
+			s.keys[key.ID] = previous
+		} else {
+			delete(s.keys, key.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// persist grava todas as chaves em um arquivo temporário e o renomeia sobre o arquivo
+// final, para que uma falha no meio da gravação não corrompa as chaves existentes
+func (s *fileAPIKeyStore) persist() error {
+	if s.path == "" {
+		return nil
+	}
+
+	stored := make([]storedAPIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		stored = append(stored, storedAPIKey{APIKey: key, Hash: key.Hash, PreviousHash: key.PreviousHash})
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].ID < stored[j].ID })
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".api-keys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	// A versão gravada não precisa ser relida
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
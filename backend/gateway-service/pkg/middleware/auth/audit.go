@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Eventos registrados na auditoria
+const (
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationRequest = "impersonation.request"
+	AuditImpersonationDenied  = "impersonation.denied"
+)
+
+// AuditEntry é uma entrada da auditoria
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	ActorID    string    `json:"actorId"`
+	SubjectID  string    `json:"subjectId"`
+	TokenID    string    `json:"tokenId,omitempty"`
+	Method     string    `json:"method,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Query      string    `json:"query,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	DurationMS int64     `json:"durationMs,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+// AuditLog grava as entradas da auditoria em um arquivo, uma entrada JSON por linha, ou no
+// log da aplicação quando não há arquivo
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewAuditLog abre o arquivo da auditoria para acréscimo; file vazio registra no log
+func NewAuditLog(file string) (*AuditLog, error) {
+	if file == "" {
+		return &AuditLog{}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: f}, nil
+}
+
+// Record grava a entrada. Falhas de escrita são registradas no log, sem interromper a requisição.
+func (l *AuditLog) Record(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	if l.file == nil {
+		logrus.WithField("audit", entry).Info(entry.Event)
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode audit entry")
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		logrus.WithError(err).WithField("event", entry.Event).Error("Failed to write audit entry")
+	}
+}
+
+// Close fecha o arquivo da auditoria
+func (l *AuditLog) Close() {
+	if l.file == nil {
+		return
+	}
+	if err := l.file.Close(); err != nil {
+		logrus.WithError(err).Warn("Failed to close audit log")
+	}
+}
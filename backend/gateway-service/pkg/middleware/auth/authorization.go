@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var authorizationDenialsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "gateway_authorization_denials_total",
+		Help: "Total de requisições negadas pela autorização, por rota e motivo",
+	},
+	[]string{"route", "reason"},
+)
+
+// Authorizer decide se o usuário autenticado pode acessar uma rota, com base nas
+// permissões concedidas aos seus papéis e nos escopos do token
+type Authorizer struct {
+	roles  map[string][]string
+	stepUp config.StepUpConfig
+}
+
+// NewAuthorizer cria o autorizador a partir do mapeamento de papéis para permissões
+func NewAuthorizer(cfg config.AuthorizationConfig) *Authorizer {
+	roles := make(map[string][]string, len(cfg.Roles))
+	for role, permissions := range cfg.Roles {
+		roles[strings.ToLower(role)] = permissions
+	}
+	return &Authorizer{roles: roles, stepUp: cfg.StepUp}
+}
+
+// HasPermission indica se algum papel do usuário concede a permissão
+func (a *Authorizer) HasPermission(p *Principal, permission string) bool {
+	for _, role := range p.Roles {
+		for _, granted := range a.roles[strings.ToLower(role)] {
+			if grants(granted, permission) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// grants indica se a permissão concedida, possivelmente com curinga, cobre a exigida
+func grants(granted, required string) bool {
+	if granted == "*" || granted == required {
+		return true
+	}
+	resource, found := strings.CutSuffix(granted, ":*")
+	return found && strings.HasPrefix(required, resource+":")
+}
+
+// RequirePermissions retorna um middleware que exige todas as permissões informadas
+func (a *Authorizer) RequirePermissions(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFrom(c)
+		if !ok {
+			deny(c, http.StatusUnauthorized, "unauthenticated", nil, "")
+			return
+		}
+
+		for _, permission := range permissions {
+			if !a.HasPermission(principal, permission) {
+				deny(c, http.StatusForbidden, "permission", principal, permission)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireScopes retorna um middleware que exige todos os escopos informados no token
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFrom(c)
+		if !ok {
+			deny(c, http.StatusUnauthorized, "unauthenticated", nil, "")
+			return
+		}
+
+		for _, scope := range scopes {
+			if !principal.HasScope(scope) {
+				deny(c, http.StatusForbidden, "scope", principal, scope)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireStepUp retorna o middleware de step-up das operações sensíveis das rotas do gateway,
+// com a exigência de authorization.stepUp
+func (a *Authorizer) RequireStepUp() gin.HandlerFunc {
+	return RequireStepUp(a.stepUp)
+}
+
+// RequireStepUp retorna um middleware que exige uma autenticação do usuário feita há no máximo
+// cfg.MaxAge e com um dos métodos de cfg.Methods. Caso contrário responde 401 com o desafio de
+// step-up (RFC 9470), para que o cliente autentique o usuário de novo e repita a requisição.
+// Tokens de impersonação nunca satisfazem o step-up e recebem 403.
+func RequireStepUp(cfg config.StepUpConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.Required() {
+			c.Next()
+			return
+		}
+		principal, ok := PrincipalFrom(c)
+		if !ok {
+			deny(c, http.StatusUnauthorized, "unauthenticated", nil, "")
+			return
+		}
+		if principal.ActorID != "" {
+			deny(c, http.StatusForbidden, "impersonation", principal, "")
+			return
+		}
+
+		if cfg.MaxAge > 0 && (principal.AuthTime.IsZero() || time.Since(principal.AuthTime) > cfg.MaxAge) {
+			challenge(c, cfg, principal, "auth_age")
+			return
+		}
+		if len(cfg.Methods) > 0 && !containsAny(principal.AuthMethods, cfg.Methods) {
+			challenge(c, cfg, principal, "auth_method")
+			return
+		}
+		c.Next()
+	}
+}
+
+// challenge responde 401 com o desafio de step-up: o cabeçalho WWW-Authenticate da RFC 9470 e,
+// no corpo, a idade máxima e os métodos aceitos para a nova autenticação
+func challenge(c *gin.Context, cfg config.StepUpConfig, p *Principal, reason string) {
+	route := c.FullPath()
+	authorizationDenialsTotal.WithLabelValues(route, reason).Inc()
+	logrus.WithFields(logrus.Fields{"route": route, "method": c.Request.Method, "reason": reason, "user_id": p.UserID}).Info("Step-up authentication required")
+
+	header := `Bearer error="insufficient_user_authentication", error_description="A more recent or stronger authentication is required"`
+	body := gin.H{
+		"error":     "step-up authentication required",
+		"challenge": "insufficient_user_authentication",
+	}
+	if cfg.MaxAge > 0 {
+		maxAge := int(cfg.MaxAge.Seconds())
+		header += fmt.Sprintf(", max_age=%d", maxAge)
+		body["maxAge"] = maxAge
+	}
+	if len(cfg.Methods) > 0 {
+		body["methods"] = cfg.Methods
+	}
+	if !p.AuthTime.IsZero() {
+		body["authTime"] = p.AuthTime.Unix()
+	}
+
+	c.Header("WWW-Authenticate", header)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, body)
+}
+
+// deny registra a negação e interrompe a requisição
+func deny(c *gin.Context, status int, reason string, p *Principal, missing string) {
+	route := c.FullPath()
+	authorizationDenialsTotal.WithLabelValues(route, reason).Inc()
+
+	entry := logrus.WithFields(logrus.Fields{"route": route, "method": c.Request.Method, "reason": reason})
+	if p != nil {
+		entry = entry.WithFields(logrus.Fields{"user_id": p.UserID, "missing": missing})
+	}
+	entry.Warn("Authorization denied")
+
+	if status == http.StatusUnauthorized {
+		c.AbortWithStatusJSON(status, gin.H{"error": "user is not authenticated"})
+		return
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": "insufficient permissions"})
+}
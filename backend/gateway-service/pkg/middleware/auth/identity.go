@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidIdentity indica uma asserção de identidade ausente, expirada ou com assinatura inválida
+var ErrInvalidIdentity = errors.New("invalid identity assertion")
+
+// IdentityClaims é o conteúdo da asserção de identidade repassada aos serviços
+type IdentityClaims struct {
+	Email      string   `json:"email,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+	AuthMethod string   `json:"auth_method"`
+	APIKeyID   string   `json:"api_key_id,omitempty"`
+	ClientID   string   `json:"client_id,omitempty"`
+	// Actor identifica o administrador nas requisições feitas por impersonação (act.sub)
+	Actor *ActorClaim `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IdentitySigner repassa aos serviços a identidade autenticada. Os cabeçalhos de identidade
+// recebidos do cliente são removidos e substituídos por uma asserção JWT HS256 curta, emitida
+// para o serviço de destino (aud) e assinada com uma chave compartilhada apenas com os serviços.
+type IdentitySigner struct {
+	header       string
+	userIDHeader string
+	key          []byte
+	issuer       string
+	ttl          time.Duration
+	strip        []string // nomes canônicos; os terminados em "*" removem pelo prefixo
+}
+
+// NewIdentitySigner cria o assinador a partir da configuração
+func NewIdentitySigner(cfg config.IdentityConfig) *IdentitySigner {
+	s := &IdentitySigner{
+		header:       textproto.CanonicalMIMEHeaderKey(cfg.Header),
+		userIDHeader: textproto.CanonicalMIMEHeaderKey(cfg.UserIDHeader),
+		key:          []byte(cfg.SigningKey),
+		issuer:       cfg.Issuer,
+		ttl:          cfg.TTL,
+	}
+	if s.ttl <= 0 {
+		s.ttl = 30 * time.Second
+	}
+
+	for _, name := range append([]string{s.header, s.userIDHeader}, cfg.StripHeaders...) {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			s.strip = append(s.strip, textproto.CanonicalMIMEHeaderKey(prefix)+"*")
+		} else {
+			s.strip = append(s.strip, textproto.CanonicalMIMEHeaderKey(name))
+		}
+	}
+	return s
+}
+
+// StripInbound retorna um middleware que remove os cabeçalhos de identidade de todas as
+// requisições recebidas, antes que handlers e políticas possam lê-los
+func (s *IdentitySigner) StripInbound() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.Strip(c.Request.Header)
+		c.Next()
+	}
+}
+
+// Apply remove os cabeçalhos de identidade de r e, quando há usuário autenticado, adiciona a
+// asserção assinada para service e o ID do usuário em texto
+func (s *IdentitySigner) Apply(r *http.Request, p *Principal, service string) error {
+	s.Strip(r.Header)
+	if p == nil {
+		return nil
+	}
+
+	assertion, err := s.Sign(p, service)
+	if err != nil {
+		return err
+	}
+	r.Header.Set(s.header, assertion)
+	r.Header.Set(s.userIDHeader, p.UserID)
+	return nil
+}
+
+// Strip remove de h todos os cabeçalhos de identidade
+func (s *IdentitySigner) Strip(h http.Header) {
+	for name := range h {
+		if s.stripped(name) {
+			delete(h, name)
+		}
+	}
+}
+
+// stripped indica se o cabeçalho (já canônico) é um cabeçalho de identidade
+func (s *IdentitySigner) stripped(name string) bool {
+	for _, strip := range s.strip {
+		if prefix, ok := strings.CutSuffix(strip, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == strip {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign emite a asserção de identidade de p para o serviço informado
+func (s *IdentitySigner) Sign(p *Principal, service string) (string, error) {
+	now := time.Now()
+	ic := IdentityClaims{
+		Email:      p.Email,
+		Roles:      p.Roles,
+		AuthMethod: p.AuthMethod,
+		APIKeyID:   p.APIKeyID,
+		ClientID:   p.ClientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   p.UserID,
+			Audience:  jwt.ClaimStrings{service},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+			ID:        p.TokenID,
+		},
+	}
+	if p.ActorID != "" {
+		ic.Actor = &ActorClaim{Subject: p.ActorID}
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, ic).SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("sign identity assertion: %w", err)
+	}
+	return signed, nil
+}
+
+// Verify valida uma asserção emitida para service. É a verificação que os serviços em Go
+// devem fazer; os serviços Kotlin fazem a mesma com o jjwt.
+func (s *IdentitySigner) Verify(assertion, service string) (*IdentityClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(service),
+	)
+
+	var ic IdentityClaims
+	keyFunc := func(*jwt.Token) (interface{}, error) { return s.key, nil }
+	if _, err := parser.ParseWithClaims(assertion, &ic, keyFunc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentity, err)
+	}
+	if ic.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: assertion has no expiration", ErrInvalidIdentity)
+	}
+	return &ic, nil
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var impersonationRequestsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "gateway_impersonation_requests_total",
+		Help: "Total de requisições feitas com tokens de impersonação, por resultado (allowed, denied)",
+	},
+	[]string{"result"},
+)
+
+// ErrSelfImpersonation indica um administrador tentando se impersonar
+var ErrSelfImpersonation = errors.New("cannot impersonate yourself")
+
+// Impersonation emite os tokens de impersonação do suporte e controla o seu uso: os caminhos
+// proibidos (pagamentos, senha, administração) são negados e toda requisição feita com os
+// tokens é registrada na auditoria.
+type Impersonation struct {
+	issuer *TokenIssuer
+	audit  *AuditLog
+	ttl    time.Duration
+	roles  []string
+	denied []deniedPath
+}
+
+// deniedPath é um caminho proibido aos tokens de impersonação, em todos os métodos ou só em um
+type deniedPath struct {
+	method string // vazio proíbe todos os métodos
+	path   *proxy.PathTemplate
+}
+
+// matches indica se o caminho proibido cobre a requisição
+func (d deniedPath) matches(r *http.Request) bool {
+	if d.method != "" && d.method != r.Method {
+		return false
+	}
+	_, ok := d.path.Match(r.URL.Path)
+	return ok
+}
+
+func (d deniedPath) String() string {
+	if d.method == "" {
+		return d.path.String()
+	}
+	return d.method + " " + d.path.String()
+}
+
+// NewImpersonation cria a impersonação com os tokens emitidos por issuer; retorna nil quando
+// desativada
+func NewImpersonation(cfg config.ImpersonationConfig, issuer *TokenIssuer, audit *AuditLog) (*Impersonation, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	i := &Impersonation{issuer: issuer, audit: audit, ttl: cfg.TokenTTL, roles: cfg.Roles}
+	if i.ttl <= 0 {
+		i.ttl = 15 * time.Minute
+	}
+	for _, raw := range cfg.DeniedPaths {
+		// "PUT /api/users/profile" proíbe só o método; sem método, todos
+		var denied deniedPath
+		if method, rest, ok := strings.Cut(strings.TrimSpace(raw), " "); ok {
+			denied.method, raw = strings.ToUpper(method), strings.TrimSpace(rest)
+		}
+		path, err := proxy.ParsePathTemplate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("auth.impersonation.deniedPaths: %w", err)
+		}
+		denied.path = path
+		i.denied = append(i.denied, denied)
+	}
+	return i, nil
+}
+
+// DeniedPaths retorna os caminhos proibidos aos tokens de impersonação
+func (i *Impersonation) DeniedPaths() []string {
+	paths := make([]string, len(i.denied))
+	for j, denied := range i.denied {
+		paths[j] = denied.String()
+	}
+	return paths
+}
+
+// Start emite o token com que actor age como o usuário subject e registra o início na
+// auditoria com o motivo informado. Retorna o token e a sua validade.
+func (i *Impersonation) Start(c *gin.Context, actor *Principal, subject, reason string) (string, time.Duration, error) {
+	if subject == actor.UserID {
+		return "", 0, ErrSelfImpersonation
+	}
+
+	token, jti, err := i.issuer.IssueImpersonation(actor, subject, i.roles, i.ttl)
+	if err != nil {
+		return "", 0, err
+	}
+
+	i.audit.Record(AuditEntry{
+		Event:     AuditImpersonationStart,
+		ActorID:   actor.UserID,
+		SubjectID: subject,
+		TokenID:   jti,
+		IP:        c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Reason:    reason,
+	})
+	return token, i.ttl, nil
+}
+
+// serve trata uma requisição autenticada por token de impersonação: nega os caminhos
+// proibidos e registra a requisição, com a resposta, na auditoria. Sem impersonação
+// configurada (i nil) os tokens são recusados.
+func (i *Impersonation) serve(c *gin.Context, p *Principal) {
+	if i == nil {
+		abortUnauthorized(c, fmt.Errorf("%w: impersonation is disabled", ErrInvalidToken))
+		return
+	}
+
+	entry := AuditEntry{
+		Event:     AuditImpersonationRequest,
+		ActorID:   p.ActorID,
+		SubjectID: p.UserID,
+		TokenID:   p.TokenID,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Query:     c.Request.URL.RawQuery,
+		IP:        c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+	}
+
+	for _, denied := range i.denied {
+		if denied.matches(c.Request) {
+			impersonationRequestsTotal.WithLabelValues("denied").Inc()
+			entry.Event = AuditImpersonationDenied
+			entry.Status = http.StatusForbidden
+			entry.Reason = "path denied by " + denied.String()
+			i.audit.Record(entry)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "operation not allowed while impersonating a user"})
+			return
+		}
+	}
+
+	impersonationRequestsTotal.WithLabelValues("allowed").Inc()
+	start := time.Now()
+	c.Next()
+	entry.Status = c.Writer.Status()
+	entry.DurationMS = time.Since(start).Milliseconds()
+	i.audit.Record(entry)
+}
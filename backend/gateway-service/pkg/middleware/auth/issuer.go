@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Erros do grant client_credentials, com os códigos da RFC 6749
+var (
+	ErrInvalidClient = errors.New("invalid_client")
+	ErrInvalidScope  = errors.New("invalid_scope")
+)
+
+// TokenIssuer emite os tokens do grant client_credentials para os clientes registrados e os
+// tokens de acesso dos refreshs de sessão. Os tokens são JWTs curtos que a autenticação do
+// próprio gateway aceita.
+type TokenIssuer struct {
+	issuer   string
+	audience string
+	ttl      time.Duration
+	method   jwt.SigningMethod
+	key      interface{} // []byte para HS256 ou a chave privada
+	public   crypto.PublicKey
+	kid      string
+	clients  map[string]config.OAuthClientConfig
+
+	// dummyHash é comparado quando o cliente não existe, para que o tempo de resposta
+	// não revele quais clientes estão registrados
+	dummyHash []byte
+}
+
+// IssuedToken é um token emitido e os escopos concedidos nele
+type IssuedToken struct {
+	AccessToken string
+	ExpiresIn   time.Duration
+	Scopes      []string
+}
+
+// NewTokenIssuer cria o emissor a partir da configuração. Sem signingKeyFile os tokens são
+// assinados com o segredo compartilhado (HS256).
+func NewTokenIssuer(cfg config.OAuthConfig, secret string) (*TokenIssuer, error) {
+	t := &TokenIssuer{
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		ttl:      cfg.TokenTTL,
+		clients:  make(map[string]config.OAuthClientConfig, len(cfg.Clients)),
+	}
+	if t.ttl <= 0 {
+		t.ttl = 5 * time.Minute
+	}
+	for _, client := range cfg.Clients {
+		t.clients[client.ID] = client
+	}
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("client-not-found"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	t.dummyHash = dummyHash
+
+	if cfg.SigningKeyFile == "" {
+		t.method, t.key = jwt.SigningMethodHS256, []byte(secret)
+		return t, nil
+	}
+
+	if err := t.loadSigningKey(cfg.SigningKeyFile); err != nil {
+		return nil, fmt.Errorf("auth.oauth.signingKeyFile: %w", err)
+	}
+	return t, nil
+}
+
+// loadSigningKey lê a chave privada PEM (PKCS#1, PKCS#8 ou SEC 1) e escolhe o algoritmo
+func (t *TokenIssuer) loadSigningKey(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errors.New("no PEM block found")
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		t.method, t.key, t.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			t.method = jwt.SigningMethodES256
+		case elliptic.P384():
+			t.method = jwt.SigningMethodES384
+		case elliptic.P521():
+			t.method = jwt.SigningMethodES512
+		default:
+			return errors.New("unsupported elliptic curve")
+		}
+		t.key, t.public = k, &k.PublicKey
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(t.public)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(der)
+	t.kid = "gateway-" + hex.EncodeToString(sum[:8])
+	return nil
+}
+
+// Issuer retorna o iss dos tokens emitidos
+func (t *TokenIssuer) Issuer() string {
+	return t.issuer
+}
+
+// AuthenticateClient verifica as credenciais de um cliente registrado
+func (t *TokenIssuer) AuthenticateClient(id, secret string) (config.OAuthClientConfig, error) {
+	client, ok := t.clients[id]
+	if !ok || id == "" {
+		_ = bcrypt.CompareHashAndPassword(t.dummyHash, []byte(secret))
+		return config.OAuthClientConfig{}, ErrInvalidClient
+	}
+	if bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(secret)) != nil {
+		return config.OAuthClientConfig{}, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// Issue emite um token para o cliente. Sem escopos solicitados o token recebe todos os
+// escopos permitidos ao cliente; escopos não permitidos resultam em ErrInvalidScope.
+func (t *TokenIssuer) Issue(client config.OAuthClientConfig, requested []string) (*IssuedToken, error) {
+	scopes := client.Scopes
+	if len(requested) > 0 {
+		for _, scope := range requested {
+			if !contains(client.Scopes, scope) {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+			}
+		}
+		scopes = requested
+	}
+
+	jti, err := randomString(16, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tc := claims{
+		Roles:    client.Roles,
+		Scope:    strings.Join(scopes, " "),
+		ClientID: client.ID,
+		Plan:     client.Plan,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.issuer,
+			Subject:   client.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.ttl)),
+			ID:        jti,
+		},
+	}
+	if t.audience != "" {
+		tc.Audience = jwt.ClaimStrings{t.audience}
+	}
+
+	signed, err := t.sign(tc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IssuedToken{AccessToken: signed, ExpiresIn: t.ttl, Scopes: scopes}, nil
+}
+
+// IssueSession emite um token de acesso para o usuário de uma sessão de refresh, com a
+// sessão em "sid" e a autenticação do login em "auth_time" e "amr". Retorna o token e o seu jti.
+func (t *TokenIssuer) IssueSession(session *RefreshSession, ttl time.Duration) (token, jti string, err error) {
+	if jti, err = randomString(16, hex.EncodeToString); err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	tc := claims{
+		UserID:    session.UserID,
+		Username:  session.Username,
+		Email:     session.Email,
+		Roles:     session.Roles,
+		Scope:     strings.Join(session.Scopes, " "),
+		SessionID: session.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.issuer,
+			Subject:   session.UserID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        jti,
+		},
+	}
+	if t.audience != "" {
+		tc.Audience = jwt.ClaimStrings{t.audience}
+	}
+	if !session.AuthTime.IsZero() {
+		tc.AuthTime = jwt.NewNumericDate(session.AuthTime)
+		tc.AMR = session.AuthMethods
+	}
+
+	token, err = t.sign(tc)
+	return token, jti, err
+}
+
+// IssueImpersonation emite o token de impersonação do usuário subject pelo administrador
+// actor: o usuário em sub e o administrador em act.sub (RFC 8693). Retorna o token e o seu jti.
+func (t *TokenIssuer) IssueImpersonation(actor *Principal, subject string, roles []string, ttl time.Duration) (token, jti string, err error) {
+	if jti, err = randomString(16, hex.EncodeToString); err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	tc := claims{
+		UserID: subject,
+		Roles:  roles,
+		Actor:  &ActorClaim{Subject: actor.UserID},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.issuer,
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        jti,
+		},
+	}
+	if t.audience != "" {
+		tc.Audience = jwt.ClaimStrings{t.audience}
+	}
+
+	token, err = t.sign(tc)
+	return token, jti, err
+}
+
+// sign assina as claims com a chave do emissor
+func (t *TokenIssuer) sign(tc claims) (string, error) {
+	token := jwt.NewWithClaims(t.method, tc)
+	if t.kid != "" {
+		token.Header["kid"] = t.kid
+	}
+	return token.SignedString(t.key)
+}
+
+// keySource retorna a fonte com a chave pública dos tokens emitidos; tokens HS256 são
+// verificados pelo segredo compartilhado, que já é uma das fontes do autenticador
+func (t *TokenIssuer) keySource() KeySource {
+	if t.public == nil {
+		return nil
+	}
+	return &issuerSource{kid: t.kid, alg: t.method.Alg(), key: t.public}
+}
+
+// issuerSource verifica os tokens assinados pela chave privada do próprio gateway
+type issuerSource struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+func (s *issuerSource) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	if kid != s.kid || alg != s.alg {
+		return nil, ErrKeyNotFound
+	}
+	return s.key, nil
+}
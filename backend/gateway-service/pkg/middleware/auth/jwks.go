@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minJWKSRefresh é o intervalo mínimo entre tentativas de atualização, que limita as
+// buscas provocadas por tokens com kid desconhecido ou por falhas do emissor
+const minJWKSRefresh = 30 * time.Second
+
+// jwk é uma chave no formato JSON Web Key (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	// oct (HMAC)
+	K string `json:"k"`
+}
+
+// verificationKey é uma chave do JWKS já convertida para o tipo usado na verificação
+type verificationKey struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+// jwksSource obtém as chaves de um JWKS, recarregado periodicamente. Várias chaves podem
+// estar ativas ao mesmo tempo, identificadas pelo kid, o que permite a rotação.
+type jwksSource struct {
+	name    string
+	load    func(ctx context.Context) ([]byte, error)
+	refresh time.Duration
+
+	mu          sync.Mutex
+	keys        []verificationKey
+	loadedAt    time.Time
+	attemptedAt time.Time
+	loading     chan struct{} // fechado ao fim da atualização em andamento; nil sem atualização
+}
+
+// NewJWKSFileSource cria uma fonte de chaves a partir de um arquivo JWKS local
+func NewJWKSFileSource(path string, refresh time.Duration) (KeySource, error) {
+	s := &jwksSource{
+		name:    path,
+		refresh: refresh,
+		load: func(ctx context.Context) ([]byte, error) {
+			return os.ReadFile(path)
+		},
+	}
+
+	// Um arquivo inválido é erro de configuração
+	if err := s.reload(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewJWKSURLSource cria uma fonte de chaves a partir do JWKS publicado pelo emissor
+func NewJWKSURLSource(url string, refresh time.Duration) KeySource {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	s := &jwksSource{
+		name:    url,
+		refresh: refresh,
+		load: func(ctx context.Context) ([]byte, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+			}
+			return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		},
+	}
+
+	// O emissor pode estar fora do ar na inicialização; as chaves são buscadas de novo no primeiro uso
+	if err := s.reload(context.Background()); err != nil {
+		logrus.WithError(err).Warnf("Falha ao carregar JWKS de %s", url)
+	}
+	return s
+}
+
+func (s *jwksSource) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	s.mu.Lock()
+	loaded, stale := !s.loadedAt.IsZero(), time.Since(s.loadedAt) >= s.refresh
+	s.mu.Unlock()
+
+	// Com chaves carregadas a atualização periódica não atrasa a requisição
+	if stale {
+		s.update(ctx, !loaded)
+	}
+
+	key, err := s.lookup(kid, alg)
+	if err == nil {
+		return key, nil
+	}
+
+	// Um kid desconhecido pode indicar que o emissor publicou uma chave nova
+	if kid != "" && s.update(ctx, true) {
+		return s.lookup(kid, alg)
+	}
+	return nil, err
+}
+
+// update inicia a atualização do JWKS, no máximo uma a cada minJWKSRefresh e uma de cada
+// vez; as requisições que chegam durante a busca aguardam a mesma atualização. A busca não
+// depende da requisição que a iniciou. Com wait, aguarda o fim da atualização enquanto ctx
+// estiver ativo e retorna se ela terminou.
+func (s *jwksSource) update(ctx context.Context, wait bool) bool {
+	s.mu.Lock()
+	done := s.loading
+	if done == nil {
+		if time.Since(s.attemptedAt) < minJWKSRefresh {
+			s.mu.Unlock()
+			return false
+		}
+		s.attemptedAt = time.Now()
+		done = make(chan struct{})
+		s.loading = done
+		go s.tryReload(done)
+	}
+	s.mu.Unlock()
+
+	if !wait {
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// tryReload recarrega o JWKS, mantendo as chaves anteriores em caso de falha, e fecha done
+func (s *jwksSource) tryReload(done chan struct{}) {
+	defer func() {
+		s.mu.Lock()
+		s.loading = nil
+		s.mu.Unlock()
+		close(done)
+	}()
+
+	if err := s.reload(context.Background()); err != nil {
+		logrus.WithError(err).Warnf("Falha ao atualizar JWKS de %s", s.name)
+	}
+}
+
+// reload lê e converte o JWKS. As chaves que o gateway não sabe usar são ignoradas, para que
+// não impeçam o uso das demais; o JWKS só é recusado quando nenhuma chave pode ser usada.
+func (s *jwksSource) reload(ctx context.Context) error {
+	data, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("invalid JWKS %s: %w", s.name, err)
+	}
+
+	keys := make([]verificationKey, 0, len(set.Keys))
+	var skipped error
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			skipped = fmt.Errorf("key %q: %w", k.Kid, err)
+			logrus.WithError(err).WithField("kid", k.Kid).Warnf("Ignorando chave não suportada do JWKS de %s", s.name)
+			continue
+		}
+		keys = append(keys, verificationKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(keys) == 0 && skipped != nil {
+		return fmt.Errorf("invalid JWKS %s: no usable keys: %w", s.name, skipped)
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// lookup procura a chave pelo kid. Tokens sem kid só são aceitos quando uma única chave
+// compatível com o algoritmo está publicada.
+func (s *jwksSource) lookup(kid, alg string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var match interface{}
+	matches := 0
+	for _, k := range s.keys {
+		if (kid != "" && k.kid != kid) || !compatible(k, alg) {
+			continue
+		}
+		match = k.key
+		matches++
+	}
+
+	if matches == 1 || (kid != "" && matches > 0) {
+		return match, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// compatible indica se a chave pode verificar o algoritmo. O tipo da chave é sempre
+// conferido, o que impede verificar um token HS256 usando uma chave pública como segredo.
+func compatible(k verificationKey, alg string) bool {
+	if k.alg != "" && k.alg != alg {
+		return false
+	}
+
+	switch k.key.(type) {
+	case []byte:
+		return strings.HasPrefix(alg, "HS")
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	}
+	return false
+}
+
+// publicKey converte a JWK na chave usada pelo jwt-go
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, errors.New("invalid k")
+		}
+		return secret, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// decodeBigInt decodifica um inteiro em base64url sem padding
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -1,78 +1,368 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ecommerce/gateway-service/pkg/config"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
 )
 
-// JWT retorna um middleware para autenticação JWT
-func JWT(secretKey string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Obter token do cabeçalho Authorization
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Token de autenticação não fornecido",
-			})
-			return
+// Erros de autenticação devolvidos por Authenticate
+var (
+	ErrMissingToken  = errors.New("authorization header is required")
+	ErrInvalidFormat = errors.New("authorization header format must be Bearer {token}")
+	ErrInvalidToken  = errors.New("invalid or expired token")
+)
+
+// claims são as claims aceitas nos tokens dos usuários. Tokens antigos trazem um único
+// "role"; os novos, a lista "roles". Os escopos OAuth vêm em "scope" (separados por
+// espaço) ou na lista "scp". Tokens de serviços trazem o cliente OAuth em "client_id" e os
+// emitidos no refresh, a sessão em "sid".
+type claims struct {
+	UserID    string           `json:"user_id,omitempty"`
+	Username  string           `json:"username,omitempty"`
+	Email     string           `json:"email,omitempty"`
+	Role      string           `json:"role,omitempty"`
+	Roles     stringList       `json:"roles,omitempty"`
+	Scope     string           `json:"scope,omitempty"`
+	Scp       stringList       `json:"scp,omitempty"`
+	ClientID  string           `json:"client_id,omitempty"`
+	SessionID string           `json:"sid,omitempty"`
+	AuthTime  *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR       stringList       `json:"amr,omitempty"`
+	Actor     *ActorClaim      `json:"act,omitempty"`
+	Plan      string           `json:"plan,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ActorClaim identifica quem age em nome do usuário do token (claim act da RFC 8693)
+type ActorClaim struct {
+	Subject string `json:"sub"`
+}
+
+// stringList aceita tanto uma string quanto uma lista de strings
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// Authenticator valida os tokens JWT dos usuários e produz o Principal da requisição
+type Authenticator struct {
+	keys          KeySource
+	parser        *jwt.Parser
+	issuers       []string
+	audiences     []string
+	revocations   RevocationStore
+	apiKeys       *APIKeys
+	sessions      *Sessions
+	impersonation *Impersonation
+}
+
+// NewAuthenticator cria o autenticador a partir da configuração. As chaves vêm do JWKS
+// (URL e/ou arquivo), identificadas pelo kid, e do segredo compartilhado para HS256.
+// Tokens presentes em revocations são rejeitados. Requisições sem token podem se
+// autenticar por chave de API, quando apiKeys não é nil, ou pelo cookie de sessão, quando
+// sessions não é nil. Os tokens emitidos por issuer, quando não é nil, são sempre aceitos.
+// Os tokens de impersonação só são aceitos com impersonation, que restringe e audita o seu uso.
+func NewAuthenticator(cfg config.AuthConfig, revocations RevocationStore, apiKeys *APIKeys, issuer *TokenIssuer, sessions *Sessions,
+	impersonation *Impersonation) (*Authenticator, error) {
+	algorithms := cfg.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"HS256", "RS256", "ES256"}
+	}
+	clockSkew := cfg.ClockSkew
+	if clockSkew == 0 {
+		clockSkew = 30 * time.Second
+	}
+	refresh := cfg.JWKSRefresh
+	if refresh == 0 {
+		refresh = 5 * time.Minute
+	}
+
+	var sources keySources
+	issuers := cfg.Issuers
+	if issuer != nil {
+		if !contains(algorithms, issuer.method.Alg()) {
+			return nil, fmt.Errorf("auth.algorithms must include %s to accept the tokens issued by auth.oauth", issuer.method.Alg())
 		}
+		if source := issuer.keySource(); source != nil {
+			sources = append(sources, source)
+		}
+		if len(issuers) > 0 {
+			issuers = append(append([]string(nil), issuers...), issuer.Issuer())
+		}
+	}
+	if cfg.JWKSFile != "" {
+		source, err := NewJWKSFileSource(cfg.JWKSFile, refresh)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	if cfg.JWKSURL != "" {
+		sources = append(sources, NewJWKSURLSource(cfg.JWKSURL, refresh))
+	}
+	if cfg.JWTSecret != "" {
+		sources = append(sources, NewSecretSource(cfg.JWTSecret))
+	}
 
-		// O token deve estar no formato "Bearer {token}"
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Formato de token inválido",
-			})
-			return
+	return &Authenticator{
+		keys:          sources,
+		parser:        jwt.NewParser(jwt.WithValidMethods(algorithms), jwt.WithLeeway(clockSkew), jwt.WithIssuedAt()),
+		issuers:       issuers,
+		audiences:     cfg.Audiences,
+		revocations:   revocations,
+		apiKeys:       apiKeys,
+		sessions:      sessions,
+		impersonation: impersonation,
+	}, nil
+}
+
+// Sessions retorna o modo de sessão por cookie, ou nil quando desativado
+func (a *Authenticator) Sessions() *Sessions {
+	return a.sessions
+}
+
+// Impersonation retorna a impersonação de usuários, ou nil quando desativada
+func (a *Authenticator) Impersonation() *Impersonation {
+	return a.impersonation
+}
+
+// Authenticate valida o token, a chave de API ou o cookie de sessão de uma requisição e
+// retorna a identidade do usuário
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.Header.Get("Authorization") == "" && a.apiKeys != nil {
+		if credential := a.apiKeys.credential(r); credential != "" {
+			return a.apiKeys.Authenticate(r.Context(), credential)
+		}
+	}
+	if r.Header.Get("Authorization") == "" && a.sessions != nil {
+		if token := a.sessions.token(r); token != "" {
+			return a.authenticateSession(r, token)
 		}
+	}
 
-		// Extrair o token
-		tokenString := tokenParts[1]
+	tokenString, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	return a.Verify(r.Context(), tokenString)
+}
+
+// Verify valida um token e retorna a identidade do usuário; usado também na introspecção
+func (a *Authenticator) Verify(ctx context.Context, tokenString string) (*Principal, error) {
+	var tc claims
+	_, err := a.parser.ParseWithClaims(tokenString, &tc, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.keys.Key(ctx, kid, token.Method.Alg())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if err := a.validateClaims(&tc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
 
-		// Validar o token
-		token, err := validateToken(tokenString, secretKey)
+	principal := tc.principal()
+	if a.revocations != nil {
+		revoked, err := a.revocations.IsRevoked(ctx, principal)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Token inválido: " + err.Error(),
-			})
-			return
+			return nil, fmt.Errorf("check token revocation: %w", err)
+		}
+		if revoked {
+			return nil, ErrRevokedToken
 		}
+	}
 
-		// Verificar se o token é válido
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Token inválido",
-			})
+	return principal, nil
+}
+
+// authenticateSession valida o token do cookie de sessão e o token CSRF da requisição
+func (a *Authenticator) authenticateSession(r *http.Request, token string) (*Principal, error) {
+	principal, err := a.Verify(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.sessions.checkCSRF(r, token); err != nil {
+		return nil, err
+	}
+	principal.AuthMethod = AuthMethodSession
+	return principal, nil
+}
+
+// validateClaims verifica as claims que o parser não verifica sozinho: exp obrigatório,
+// emissor e audiência
+func (a *Authenticator) validateClaims(tc *claims) error {
+	if tc.ExpiresAt == nil {
+		return errors.New("token has no expiration")
+	}
+	if len(a.issuers) > 0 && !contains(a.issuers, tc.Issuer) {
+		return fmt.Errorf("issuer %q is not accepted", tc.Issuer)
+	}
+	if len(a.audiences) > 0 && !containsAny(a.audiences, tc.Audience) {
+		return errors.New("token audience is not accepted")
+	}
+	if tc.UserID == "" && tc.Subject == "" {
+		return errors.New("token has no subject")
+	}
+	return nil
+}
+
+// principal converte as claims validadas na identidade da requisição
+func (tc *claims) principal() *Principal {
+	p := &Principal{
+		UserID:     tc.UserID,
+		Username:   tc.Username,
+		Email:      tc.Email,
+		Issuer:     tc.Issuer,
+		TokenID:    tc.ID,
+		ExpiresAt:  tc.ExpiresAt.Time,
+		AuthMethod: AuthMethodJWT,
+		ClientID:   tc.ClientID,
+		SessionID:  tc.SessionID,
+		Plan:       tc.Plan,
+	}
+	if tc.IssuedAt != nil {
+		p.IssuedAt = tc.IssuedAt.Time
+	}
+	// Sem auth_time a hora da autenticação é desconhecida: o iat muda a cada refresh feito pelo
+	// serviço de autenticação e não prova um login recente
+	if tc.AuthTime != nil {
+		p.AuthTime = tc.AuthTime.Time
+	}
+	p.AuthMethods = tc.AMR
+	if tc.Actor != nil && tc.Actor.Subject != "" {
+		// O cliente não se autenticou: a emissão do token não vale como login recente
+		p.ActorID = tc.Actor.Subject
+		p.AuthMethod = AuthMethodImpersonation
+		p.AuthTime = time.Time{}
+		p.AuthMethods = nil
+	}
+	if p.UserID == "" {
+		p.UserID = tc.Subject
+	}
+
+	p.Roles = append(p.Roles, tc.Roles...)
+	if tc.Role != "" && !contains(p.Roles, tc.Role) {
+		p.Roles = append(p.Roles, tc.Role)
+	}
+
+	p.Scopes = append(strings.Fields(tc.Scope), tc.Scp...)
+	return p
+}
+
+// RequireAuth retorna um middleware que exige um token válido e registra o Principal no contexto
+func (a *Authenticator) RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := a.Authenticate(c.Request)
+		var rateLimited *RateLimitedError
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrMissingToken), errors.Is(err, ErrInvalidFormat), errors.Is(err, ErrRevokedToken),
+			errors.Is(err, ErrInvalidAPIKey):
+			abortUnauthorized(c, err)
+			return
+		case errors.Is(err, ErrInvalidCSRFToken):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		case errors.As(err, &rateLimited):
+			c.Header("Retry-After", strconv.Itoa(rateLimited.RetryAfterSeconds()))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "code": "rate_limit_exceeded"})
+			return
+		case errors.Is(err, ErrInvalidToken):
+			logrus.WithError(err).Warn("Failed to validate JWT token")
+			abortUnauthorized(c, err)
+			return
+		default:
+			// Sem acesso às revogações não é possível garantir que o token ainda vale
+			logrus.WithError(err).Error("Failed to authenticate request")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "authentication temporarily unavailable"})
 			return
 		}
 
-		// Adicionar claims ao contexto
-		c.Set("user_id", claims["user_id"])
-		c.Set("email", claims["email"])
-		c.Set("roles", claims["roles"])
+		// A chave de API não é repassada aos serviços; eles recebem apenas a identidade
+		if principal.AuthMethod == AuthMethodAPIKey {
+			a.apiKeys.strip(c.Request)
+		}
+		if a.sessions != nil {
+			a.sessions.strip(c.Request)
+		}
 
+		SetPrincipal(c, principal)
+		if principal.ActorID != "" {
+			a.impersonation.serve(c, principal)
+			return
+		}
 		c.Next()
 	}
 }
 
-// validateToken valida um token JWT
-func validateToken(tokenString, secretKey string) (*jwt.Token, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verificar o algoritmo de assinatura
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("método de assinatura inválido")
-		}
-		return []byte(secretKey), nil
-	})
+// abortUnauthorized responde 401 indicando o esquema Bearer, como define a RFC 6750
+func abortUnauthorized(c *gin.Context, err error) {
+	challenge := "Bearer"
+	message := err.Error()
+	switch {
+	case errors.Is(err, ErrInvalidToken):
+		challenge = `Bearer error="invalid_token"`
+		message = ErrInvalidToken.Error()
+	case errors.Is(err, ErrRevokedToken):
+		challenge = `Bearer error="invalid_token"`
+	}
+	c.Header("WWW-Authenticate", challenge)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+}
 
-	if err != nil {
-		return nil, err
+// bearerToken extrai o token do cabeçalho Authorization
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrMissingToken
 	}
 
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", ErrInvalidFormat
+	}
 	return token, nil
 }
+
+// contains indica se value está na lista
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny indica se algum dos valores está na lista
+func containsAny(list []string, values []string) bool {
+	for _, value := range values {
+		if contains(list, value) {
+			return true
+		}
+	}
+	return false
+}
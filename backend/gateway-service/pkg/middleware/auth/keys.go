@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrKeyNotFound indica que a fonte não tem chave para o kid e o algoritmo do token
+var ErrKeyNotFound = errors.New("verification key not found")
+
+// KeySource fornece as chaves de verificação das assinaturas dos tokens
+type KeySource interface {
+	// Key retorna a chave que verifica tokens com o kid e o algoritmo informados:
+	// []byte para HS*, *rsa.PublicKey para RS* e *ecdsa.PublicKey para ES*
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+// secretSource verifica tokens HMAC com o segredo compartilhado da configuração
+type secretSource struct {
+	secret []byte
+}
+
+// NewSecretSource cria uma fonte com um segredo HMAC compartilhado, aceito para qualquer kid
+func NewSecretSource(secret string) KeySource {
+	return &secretSource{secret: []byte(secret)}
+}
+
+func (s *secretSource) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	if !strings.HasPrefix(alg, "HS") {
+		return nil, ErrKeyNotFound
+	}
+	return s.secret, nil
+}
+
+// keySources consulta várias fontes em ordem, usando a primeira que tiver a chave
+type keySources []KeySource
+
+func (s keySources) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	for _, source := range s {
+		key, err := source.Key(ctx, kid, alg)
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, ErrKeyNotFound) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w (kid %q, alg %s)", ErrKeyNotFound, kid, alg)
+}
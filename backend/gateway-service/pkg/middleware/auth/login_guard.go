@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	loginFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_login_failures_total",
+			Help: "Total de tentativas de login e recuperação de senha com falha, por rota",
+		},
+		[]string{"route"},
+	)
+
+	loginLockoutsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_login_lockouts_total",
+			Help: "Total de bloqueios aplicados pela proteção de login, por rota e chave (ip, account, device)",
+		},
+		[]string{"route", "key"},
+	)
+
+	loginBlockedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_login_blocked_total",
+			Help: "Total de requisições recusadas por uma chave bloqueada, por rota e chave (ip, account, device)",
+		},
+		[]string{"route", "key"},
+	)
+
+	loginFailedAccounts = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_login_failed_accounts",
+			Help: "Contas distintas com falha de login no minuto atual, nesta réplica",
+		},
+	)
+
+	credentialStuffingTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_credential_stuffing_detected_total",
+			Help: "Total de minutos em que as falhas de login em contas distintas passaram do limite",
+		},
+	)
+)
+
+// maxAccountBody limita quanto do corpo é lido para encontrar o identificador da conta
+const maxAccountBody = 64 << 10
+
+// Chaves contadas pela proteção de login
+const (
+	loginKeyIP      = "ip"
+	loginKeyAccount = "account"
+	loginKeyDevice  = "device"
+)
+
+// LoginGuard protege as rotas de login e recuperação de senha contra força bruta. As falhas
+// são contadas por IP, conta e dispositivo; a chave que atinge o limite é bloqueada por um
+// tempo que dobra a cada nova falha. Depois de algumas falhas, e enquanto houver falhas em
+// muitas contas distintas (credential stuffing), o erro devolvido pede captcha.
+type LoginGuard struct {
+	cfg      config.LoginProtectionConfig
+	store    LoginAttemptStore
+	stuffing *stuffingDetector
+}
+
+// NewLoginGuard cria a proteção de login com os limites de cfg
+func NewLoginGuard(cfg config.LoginProtectionConfig, store LoginAttemptStore) *LoginGuard {
+	if cfg.Window <= 0 {
+		cfg.Window = 15 * time.Minute
+	}
+	if cfg.AccountThreshold <= 0 {
+		cfg.AccountThreshold = 5
+	}
+	if cfg.DeviceThreshold <= 0 {
+		cfg.DeviceThreshold = 10
+	}
+	if cfg.IPThreshold <= 0 {
+		cfg.IPThreshold = 50
+	}
+	if cfg.CaptchaAfter <= 0 {
+		cfg.CaptchaAfter = 3
+	}
+	if cfg.LockoutBase <= 0 {
+		cfg.LockoutBase = time.Minute
+	}
+	if cfg.LockoutMax <= 0 {
+		cfg.LockoutMax = time.Hour
+	}
+	if cfg.StuffingAccounts <= 0 {
+		cfg.StuffingAccounts = 100
+	}
+	return &LoginGuard{
+		cfg:      cfg,
+		store:    store,
+		stuffing: &stuffingDetector{threshold: cfg.StuffingAccounts},
+	}
+}
+
+// loginKey é uma das chaves contadas em uma tentativa
+type loginKey struct {
+	kind      string
+	key       string
+	threshold int
+}
+
+// Protect retorna o middleware da proteção. No login (countAll falso) contam as respostas 4xx
+// e o sucesso esquece as falhas da conta e do dispositivo; na recuperação de senha (countAll
+// verdadeiro) toda tentativa conta, já que a resposta não revela se a conta existe.
+// Sem proteção configurada (g nil) o middleware não faz nada.
+func (g *LoginGuard) Protect(countAll bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if g == nil {
+			c.Next()
+			return
+		}
+
+		keys := g.keys(c)
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = k.key
+		}
+
+		// Sem o armazenamento a proteção é suspensa; o serviço continua validando as credenciais
+		attempts, err := g.store.Get(c.Request.Context(), names)
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to read login attempts")
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		var lockedUntil time.Time
+		for i, attempt := range attempts {
+			if attempt.LockedUntil.After(now) {
+				loginBlockedTotal.WithLabelValues(c.FullPath(), keys[i].kind).Inc()
+				if attempt.LockedUntil.After(lockedUntil) {
+					lockedUntil = attempt.LockedUntil
+				}
+			}
+		}
+		if !lockedUntil.IsZero() {
+			retryAfter := int(math.Ceil(lockedUntil.Sub(now).Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":           "too many failed attempts, try again later",
+				"retryAfter":      retryAfter,
+				"captchaRequired": true,
+			})
+			return
+		}
+
+		rewriteResponse(c, func(status int, body []byte) (int, []byte, error) {
+			failed := status >= 400 && status < 500 && status != http.StatusTooManyRequests
+			if countAll {
+				failed = status < 500
+			}
+			if !failed {
+				if status < 300 {
+					g.reset(c, keys)
+				}
+				return status, body, nil
+			}
+
+			if g.fail(c, keys) && status >= 400 {
+				body = withCaptchaRequired(body)
+			}
+			return status, body, nil
+		})
+	}
+}
+
+// keys retorna as chaves da tentativa: o IP, a conta (quando identificada no corpo) e o dispositivo
+func (g *LoginGuard) keys(c *gin.Context) []loginKey {
+	ip := c.ClientIP()
+	keys := []loginKey{{kind: loginKeyIP, key: "ip:" + ip, threshold: g.cfg.IPThreshold}}
+
+	if account := g.account(c.Request); account != "" {
+		keys = append(keys, loginKey{kind: loginKeyAccount, key: "account:" + fingerprint(account), threshold: g.cfg.AccountThreshold})
+	}
+
+	// O ID enviado pelos apps identifica o dispositivo; nos navegadores a impressão inclui o IP
+	// para que usuários com o mesmo navegador não compartilhem a chave
+	device := ""
+	if g.cfg.DeviceHeader != "" {
+		device = c.GetHeader(g.cfg.DeviceHeader)
+	}
+	if device == "" {
+		device = ip + "|" + c.GetHeader("User-Agent") + "|" + c.GetHeader("Accept-Language")
+	}
+	keys = append(keys, loginKey{kind: loginKeyDevice, key: "device:" + fingerprint(device), threshold: g.cfg.DeviceThreshold})
+	return keys
+}
+
+// account retorna o identificador da conta no corpo JSON, sem consumir o corpo
+func (g *LoginGuard) account(r *http.Request) string {
+	if r.Body == nil || !strings.Contains(r.Header.Get("Content-Type"), "json") {
+		return ""
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxAccountBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var fields map[string]interface{}
+	if json.Unmarshal(data, &fields) != nil {
+		return ""
+	}
+	for _, name := range g.cfg.AccountFields {
+		if value, ok := fields[name].(string); ok && strings.TrimSpace(value) != "" {
+			return strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	return ""
+}
+
+// fail registra a falha em todas as chaves, bloqueia as que atingiram o limite e indica se
+// o cliente deve passar a resolver um captcha
+func (g *LoginGuard) fail(c *gin.Context, keys []loginKey) bool {
+	ctx := c.Request.Context()
+	route := c.FullPath()
+	loginFailuresTotal.WithLabelValues(route).Inc()
+
+	captcha := false
+	for _, k := range keys {
+		failures, err := g.store.Fail(ctx, k.key, g.cfg.Window)
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to record login failure")
+			continue
+		}
+
+		switch k.kind {
+		case loginKeyAccount:
+			if g.stuffing.record(k.key, time.Now()) {
+				credentialStuffingTotal.Inc()
+				logrus.WithField("accounts", g.cfg.StuffingAccounts).Warn("Possible credential stuffing: failed logins across many accounts")
+			}
+			fallthrough
+		case loginKeyDevice:
+			captcha = captcha || failures >= g.cfg.CaptchaAfter
+		}
+
+		if failures < k.threshold {
+			continue
+		}
+		lockout := g.lockout(failures - k.threshold)
+		if err := g.store.Lock(ctx, k.key, time.Now().Add(lockout)); err != nil {
+			logrus.WithError(err).Warn("Failed to lock login key")
+			continue
+		}
+		loginLockoutsTotal.WithLabelValues(route, k.kind).Inc()
+		logrus.WithFields(logrus.Fields{
+			"route":    route,
+			"key":      k.kind,
+			"failures": failures,
+			"lockout":  lockout,
+			"ip":       c.ClientIP(),
+		}).Warn("Login attempts locked out")
+	}
+
+	return captcha || g.stuffing.active(time.Now())
+}
+
+// reset esquece as falhas da conta e do dispositivo depois de um login bem-sucedido; as do
+// IP continuam valendo, já que o mesmo IP pode estar testando várias contas
+func (g *LoginGuard) reset(c *gin.Context, keys []loginKey) {
+	for _, k := range keys {
+		if k.kind == loginKeyIP {
+			continue
+		}
+		if err := g.store.Reset(c.Request.Context(), k.key); err != nil {
+			logrus.WithError(err).Warn("Failed to reset login attempts")
+		}
+	}
+}
+
+// lockout calcula o bloqueio depois de excess falhas além do limite: LockoutBase dobrado a
+// cada falha, até LockoutMax
+func (g *LoginGuard) lockout(excess int) time.Duration {
+	if excess > 30 {
+		excess = 30
+	}
+	lockout := g.cfg.LockoutBase * time.Duration(1<<excess)
+	if lockout <= 0 || lockout > g.cfg.LockoutMax {
+		return g.cfg.LockoutMax
+	}
+	return lockout
+}
+
+// withCaptchaRequired acrescenta "captchaRequired": true ao corpo de erro, quando ele é um objeto JSON
+func withCaptchaRequired(body []byte) []byte {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(body, &resp); err != nil || resp == nil {
+		return body
+	}
+	resp["captchaRequired"] = true
+	updated, err := json.Marshal(resp)
+	if err != nil {
+		return body
+	}
+	return updated
+}
+
+// fingerprint evita guardar e-mails, IDs de dispositivo e afins em texto no armazenamento
+func fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
+
+// stuffingDetector conta as contas distintas com falha de login em cada minuto. Acima do
+// limite o ataque é considerado em andamento até o fim do minuto seguinte.
+type stuffingDetector struct {
+	threshold int
+
+	mu          sync.Mutex
+	minute      time.Time
+	accounts    map[string]struct{}
+	activeUntil time.Time
+}
+
+// record registra a falha da conta e indica se o limite acabou de ser atingido
+func (d *stuffingDetector) record(account string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if minute := now.Truncate(time.Minute); !minute.Equal(d.minute) {
+		d.minute = minute
+		d.accounts = make(map[string]struct{})
+	}
+	d.accounts[account] = struct{}{}
+	loginFailedAccounts.Set(float64(len(d.accounts)))
+
+	if len(d.accounts) != d.threshold {
+		return false
+	}
+	d.activeUntil = d.minute.Add(2 * time.Minute)
+	return true
+}
+
+// active indica se há um ataque em andamento
+func (d *stuffingDetector) active(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return now.Before(d.activeUntil)
+}
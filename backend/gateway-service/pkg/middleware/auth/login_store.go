@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginAttempts é o estado das falhas de login de uma chave (IP, conta ou dispositivo)
+type LoginAttempts struct {
+	Failures    int
+	LockedUntil time.Time
+}
+
+// LoginAttemptStore conta as falhas de login por chave e guarda os bloqueios
+type LoginAttemptStore interface {
+	// Get retorna o estado das chaves, na mesma ordem
+	Get(ctx context.Context, keys []string) ([]LoginAttempts, error)
+	// Fail registra uma falha, esquecida depois de window sem novas falhas, e retorna o total
+	Fail(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock bloqueia a chave até until
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset esquece as falhas e o bloqueio da chave
+	Reset(ctx context.Context, key string) error
+}
+
+// NewLoginAttemptStore cria o armazenamento de tentativas configurado. O cliente Redis só
+// é usado com store "redis".
+func NewLoginAttemptStore(cfg config.LoginProtectionConfig, client *redis.Client) LoginAttemptStore {
+	if cfg.Store == "redis" {
+		return NewRedisLoginAttemptStore(client)
+	}
+	return NewMemoryLoginAttemptStore()
+}
+
+// memoryLoginAttemptStore mantém as tentativas na memória do processo; serve para uma única réplica
+type memoryLoginAttemptStore struct {
+	mu        sync.Mutex
+	attempts  map[string]*loginAttempt
+	lastSweep time.Time
+}
+
+type loginAttempt struct {
+	failures    int
+	expiresAt   time.Time // quando as falhas são esquecidas
+	lockedUntil time.Time
+}
+
+// NewMemoryLoginAttemptStore cria um armazenamento de tentativas em memória
+func NewMemoryLoginAttemptStore() LoginAttemptStore {
+	return &memoryLoginAttemptStore{attempts: make(map[string]*loginAttempt)}
+}
+
+func (s *memoryLoginAttemptStore) Get(ctx context.Context, keys []string) ([]LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	result := make([]LoginAttempts, len(keys))
+	for i, key := range keys {
+		attempt, ok := s.attempts[key]
+		if !ok {
+			continue
+		}
+		if now.Before(attempt.expiresAt) {
+			result[i].Failures = attempt.failures
+		}
+		if now.Before(attempt.lockedUntil) {
+			result[i].LockedUntil = attempt.lockedUntil
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryLoginAttemptStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &loginAttempt{}
+		s.attempts[key] = attempt
+	}
+	if !now.Before(attempt.expiresAt) {
+		attempt.failures = 0
+	}
+	attempt.failures++
+	attempt.expiresAt = now.Add(window)
+	return attempt.failures, nil
+}
+
+func (s *memoryLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &loginAttempt{}
+		s.attempts[key] = attempt
+	}
+	attempt.lockedUntil = until
+	return nil
+}
+
+func (s *memoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// sweep remove as chaves sem falhas nem bloqueio vigentes, no máximo uma vez por minuto
+func (s *memoryLoginAttemptStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, attempt := range s.attempts {
+		if !now.Before(attempt.expiresAt) && !now.Before(attempt.lockedUntil) {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+// redisLoginAttemptStore mantém as tentativas no Redis, compartilhadas entre as réplicas do
+// gateway. As chaves expiram sozinhas com a janela de falhas e com o bloqueio.
+type redisLoginAttemptStore struct {
+	client *redis.Client
+}
+
+// Prefixos das chaves de tentativas de login no Redis
+const (
+	redisLoginFailuresPrefix = "gateway:login:failures:"
+	redisLoginLockPrefix     = "gateway:login:lock:"
+)
+
+// NewRedisLoginAttemptStore cria um armazenamento de tentativas no Redis
+func NewRedisLoginAttemptStore(client *redis.Client) LoginAttemptStore {
+	return &redisLoginAttemptStore{client: client}
+}
+
+func (s *redisLoginAttemptStore) Get(ctx context.Context, keys []string) ([]LoginAttempts, error) {
+	redisKeys := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		redisKeys = append(redisKeys, redisLoginFailuresPrefix+key, redisLoginLockPrefix+key)
+	}
+	values, err := s.client.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]LoginAttempts, len(keys))
+	for i := range keys {
+		if raw, ok := values[2*i].(string); ok {
+			result[i].Failures, _ = strconv.Atoi(raw)
+		}
+		if raw, ok := values[2*i+1].(string); ok {
+			if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				result[i].LockedUntil = time.UnixMilli(ms)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *redisLoginAttemptStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, redisLoginFailuresPrefix+key)
+		pipe.Expire(ctx, redisLoginFailuresPrefix+key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+func (s *redisLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, redisLoginLockPrefix+key, until.UnixMilli(), ttl).Err()
+}
+
+func (s *redisLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, redisLoginFailuresPrefix+key, redisLoginLockPrefix+key).Err()
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey é a chave do Principal no contexto do Gin
+const principalKey = "principal"
+
+// Formas de autenticação de uma requisição
+const (
+	AuthMethodJWT           = "jwt"
+	AuthMethodAPIKey        = "api_key"
+	AuthMethodSession       = "session"       // token JWT do cookie de sessão
+	AuthMethodImpersonation = "impersonation" // token de impersonação emitido para o suporte
+)
+
+// Principal é a identidade autenticada de uma requisição
+type Principal struct {
+	UserID     string
+	Username   string
+	Email      string
+	Roles      []string
+	Scopes     []string
+	Issuer     string
+	TokenID    string
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+	AuthMethod string // AuthMethodJWT, AuthMethodAPIKey, AuthMethodSession ou AuthMethodImpersonation
+	APIKeyID   string // ID da chave, quando autenticado por chave de API
+	ClientID   string // cliente OAuth, nos tokens do grant client_credentials
+	SessionID  string // sessão de refresh, nos tokens emitidos pelo refresh do gateway
+	ActorID    string // administrador agindo como o usuário, nos tokens de impersonação
+	// AuthTime é quando o usuário se autenticou (auth_time; zero quando desconhecido) e
+	// AuthMethods os métodos usados (amr), verificados no step-up das operações sensíveis
+	AuthTime    time.Time
+	AuthMethods []string
+	Plan        string // plano de cotas do consumidor (chave de API, cliente OAuth ou claim plan)
+}
+
+// HasRole indica se o usuário tem o papel informado
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope indica se o token do usuário tem o escopo informado
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPrincipal associa a identidade autenticada à requisição
+func SetPrincipal(c *gin.Context, p *Principal) {
+	c.Set(principalKey, p)
+
+	// Mantido para os handlers que ainda leem o ID do usuário diretamente
+	c.Set("user_id", p.UserID)
+}
+
+// PrincipalFrom retorna a identidade autenticada da requisição, se houver
+func PrincipalFrom(c *gin.Context) (*Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := value.(*Principal)
+	return p, ok
+}
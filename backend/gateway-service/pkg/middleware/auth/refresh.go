@@ -0,0 +1,390 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// refreshTokenPrefix identifica os refresh tokens do gateway; o formato é gwr_<sessão>_<segredo>
+const refreshTokenPrefix = "gwr"
+
+// maxRotatedHashes limita quantos tokens já trocados cada sessão guarda para detectar reuso
+const maxRotatedHashes = 50
+
+// Erros do refresh de sessões
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// RefreshSession é uma sessão de refresh: o login em um dispositivo e todas as trocas de
+// refresh token seguintes (a família de tokens). Guarda a identidade do usuário para emitir
+// os tokens de acesso e apenas os hashes dos refresh tokens.
+type RefreshSession struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"userId"`
+	Username   string    `json:"username,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	Roles      []string  `json:"roles,omitempty"`
+	Scopes     []string  `json:"scopes,omitempty"`
+	Device     string    `json:"device,omitempty"` // User-Agent do login
+	IP         string    `json:"ip,omitempty"`     // IP do último uso
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"` // validade máxima desde o login
+	IdleUntil  time.Time `json:"idleUntil"` // a sessão expira se não houver refresh até aqui
+	// AuthTime e AuthMethods vêm do login e passam aos tokens de acesso, para o step-up
+	AuthTime    time.Time `json:"authTime"`
+	AuthMethods []string  `json:"amr,omitempty"`
+
+	Hash          string   `json:"hash"`                    // hash do refresh token atual
+	RotatedHashes []string `json:"rotatedHashes,omitempty"` // hashes dos tokens já trocados
+	// AccessTokens são os tokens de acesso emitidos na sessão (jti -> expiração), revogados junto com ela
+	AccessTokens map[string]time.Time `json:"accessTokens,omitempty"`
+}
+
+// expired indica se a sessão deixou de valer
+func (s *RefreshSession) expired(now time.Time) bool {
+	return !now.Before(s.validUntil())
+}
+
+// validUntil retorna quando a sessão expira se não for usada
+func (s *RefreshSession) validUntil() time.Time {
+	if s.IdleUntil.Before(s.ExpiresAt) {
+		return s.IdleUntil
+	}
+	return s.ExpiresAt
+}
+
+func (s *RefreshSession) clone() *RefreshSession {
+	c := *s
+	c.Roles = append([]string(nil), s.Roles...)
+	c.Scopes = append([]string(nil), s.Scopes...)
+	c.AuthMethods = append([]string(nil), s.AuthMethods...)
+	c.RotatedHashes = append([]string(nil), s.RotatedHashes...)
+	c.AccessTokens = make(map[string]time.Time, len(s.AccessTokens))
+	for jti, expiresAt := range s.AccessTokens {
+		c.AccessTokens[jti] = expiresAt
+	}
+	return &c
+}
+
+// RefreshedTokens é o resultado de um refresh
+type RefreshedTokens struct {
+	AccessToken  string
+	ExpiresIn    time.Duration
+	RefreshToken string
+	Session      *RefreshSession
+}
+
+// RefreshTokens emite e troca os refresh tokens das sessões dos usuários. Cada troca invalida
+// o token anterior; o reuso de um token já trocado indica que ele vazou e revoga a sessão
+// inteira, inclusive os tokens de acesso emitidos nela.
+type RefreshTokens struct {
+	store       SessionStore
+	issuer      *TokenIssuer
+	revocations RevocationStore
+	sessionTTL  time.Duration
+	idleTimeout time.Duration
+	accessTTL   time.Duration
+}
+
+// NewRefreshTokens cria o gerenciador de refresh tokens; os tokens de acesso são emitidos por issuer
+func NewRefreshTokens(cfg config.RefreshConfig, store SessionStore, issuer *TokenIssuer, revocations RevocationStore) *RefreshTokens {
+	r := &RefreshTokens{
+		store:       store,
+		issuer:      issuer,
+		revocations: revocations,
+		sessionTTL:  cfg.SessionTTL,
+		idleTimeout: cfg.IdleTimeout,
+		accessTTL:   cfg.AccessTokenTTL,
+	}
+	if r.sessionTTL <= 0 {
+		r.sessionTTL = 30 * 24 * time.Hour
+	}
+	if r.idleTimeout <= 0 {
+		r.idleTimeout = 7 * 24 * time.Hour
+	}
+	if r.accessTTL <= 0 {
+		r.accessTTL = 15 * time.Minute
+	}
+	return r
+}
+
+// Start abre uma sessão para o usuário autenticado no login e retorna o primeiro refresh token
+func (r *RefreshTokens) Start(ctx context.Context, p *Principal, device, ip string) (*RefreshSession, string, error) {
+	id, err := randomString(16, hex.EncodeToString)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := &RefreshSession{
+		ID:           id,
+		UserID:       p.UserID,
+		Username:     p.Username,
+		Email:        p.Email,
+		Roles:        p.Roles,
+		Scopes:       p.Scopes,
+		Device:       device,
+		IP:           ip,
+		CreatedAt:    now,
+		LastUsedAt:   now,
+		ExpiresAt:    now.Add(r.sessionTTL),
+		AuthTime:     p.AuthTime,
+		AuthMethods:  p.AuthMethods,
+		Hash:         hashSecret(secret),
+		AccessTokens: make(map[string]time.Time),
+	}
+	session.IdleUntil = r.idleUntil(session, now)
+	if p.TokenID != "" {
+		session.AccessTokens[p.TokenID] = p.ExpiresAt
+	}
+
+	if err := r.store.Create(ctx, session); err != nil {
+		return nil, "", err
+	}
+	return session, formatRefreshToken(id, secret), nil
+}
+
+// Refresh troca o refresh token por um novo e emite um token de acesso. As sessões abertas
+// antes de uma revogação dos tokens do usuário não são renovadas e são encerradas.
+func (r *RefreshTokens) Refresh(ctx context.Context, token, ip string) (*RefreshedTokens, error) {
+	id, secret, ok := parseRefreshToken(token)
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+	hash := hashSecret(secret)
+
+	session, err := r.store.Get(ctx, id)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := r.revocations.IsRevoked(ctx, &Principal{UserID: session.UserID, IssuedAt: session.CreatedAt})
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		if err := r.revoke(ctx, session); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newSecret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *RefreshedTokens
+	var reused *RefreshSession
+	err = r.store.Update(ctx, id, func(s *RefreshSession) error {
+		switch {
+		case subtle.ConstantTimeCompare([]byte(hash), []byte(s.Hash)) == 1:
+		case contains(s.RotatedHashes, hash):
+			reused = s.clone()
+			return ErrRefreshTokenReused
+		default:
+			return ErrInvalidRefreshToken
+		}
+
+		accessToken, jti, err := r.issuer.IssueSession(s, r.accessTTL)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		s.RotatedHashes = append(s.RotatedHashes, s.Hash)
+		if len(s.RotatedHashes) > maxRotatedHashes {
+			s.RotatedHashes = s.RotatedHashes[len(s.RotatedHashes)-maxRotatedHashes:]
+		}
+		s.Hash = hashSecret(newSecret)
+		s.LastUsedAt = now
+		s.IdleUntil = r.idleUntil(s, now)
+		s.IP = ip
+		for tokenID, expiresAt := range s.AccessTokens {
+			if now.After(expiresAt) {
+				delete(s.AccessTokens, tokenID)
+			}
+		}
+		if s.AccessTokens == nil {
+			s.AccessTokens = make(map[string]time.Time)
+		}
+		s.AccessTokens[jti] = now.Add(r.accessTTL)
+
+		result = &RefreshedTokens{
+			AccessToken:  accessToken,
+			ExpiresIn:    r.accessTTL,
+			RefreshToken: formatRefreshToken(s.ID, newSecret),
+			Session:      s.clone(),
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, ErrRefreshTokenReused):
+		logrus.WithFields(logrus.Fields{"session_id": id, "user_id": reused.UserID}).
+			Warn("Refresh token reuse detected, revoking session")
+		if err := r.revoke(ctx, reused); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	case errors.Is(err, ErrSessionNotFound):
+		return nil, ErrInvalidRefreshToken
+	case err != nil:
+		return nil, err
+	}
+	return result, nil
+}
+
+// Sessions lista as sessões ativas do usuário
+func (r *RefreshTokens) Sessions(ctx context.Context, userID string) ([]*RefreshSession, error) {
+	return r.store.List(ctx, userID)
+}
+
+// Revoke encerra uma sessão do usuário; sessões de outros usuários resultam em ErrSessionNotFound
+func (r *RefreshTokens) Revoke(ctx context.Context, userID, sessionID string) error {
+	session, err := r.store.Get(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return r.revoke(ctx, session)
+}
+
+// RevokeAll encerra todas as sessões do usuário, exceto except, e retorna quantas foram encerradas
+func (r *RefreshTokens) RevokeAll(ctx context.Context, userID, except string) (int, error) {
+	sessions, err := r.store.List(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.ID == except {
+			continue
+		}
+		if err := r.revoke(ctx, session); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// Current retorna o ID da sessão do token da requisição: a claim sid dos tokens emitidos no
+// refresh ou, para o token do login, a sessão aberta com ele
+func (r *RefreshTokens) Current(ctx context.Context, p *Principal) (string, error) {
+	if p.SessionID != "" || p.TokenID == "" {
+		return p.SessionID, nil
+	}
+
+	sessions, err := r.store.List(ctx, p.UserID)
+	if err != nil {
+		return "", err
+	}
+	for _, session := range sessions {
+		if _, ok := session.AccessTokens[p.TokenID]; ok {
+			return session.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// revoke remove a sessão e revoga os tokens de acesso ainda válidos emitidos nela
+func (r *RefreshTokens) revoke(ctx context.Context, s *RefreshSession) error {
+	if err := r.store.Delete(ctx, s.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for jti, expiresAt := range s.AccessTokens {
+		if now.After(expiresAt) {
+			continue
+		}
+		if err := r.revocations.RevokeToken(ctx, jti, expiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idleUntil calcula a nova expiração por inatividade, limitada à validade máxima da sessão
+func (r *RefreshTokens) idleUntil(s *RefreshSession, now time.Time) time.Time {
+	idle := now.Add(r.idleTimeout)
+	if idle.After(s.ExpiresAt) {
+		return s.ExpiresAt
+	}
+	return idle
+}
+
+// Login retorna o middleware que abre uma sessão a cada login bem-sucedido. O token devolvido
+// pelo login é validado por authenticator e a resposta passa a trazer "refreshToken",
+// "refreshExpiresIn" (segundos) e "sessionId".
+func (r *RefreshTokens) Login(authenticator *Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rewriteResponse(c, func(status int, body []byte) (int, []byte, error) {
+			if status != http.StatusOK {
+				return status, body, nil
+			}
+
+			var resp map[string]interface{}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return 0, nil, err
+			}
+			token, _ := resp["token"].(string)
+			principal, err := authenticator.Verify(c.Request.Context(), token)
+			if err != nil {
+				return 0, nil, err
+			}
+			// O token acabou de ser emitido pelo login: sem auth_time, a sua emissão é a autenticação
+			if principal.AuthTime.IsZero() && principal.ActorID == "" {
+				principal.AuthTime = principal.IssuedAt
+			}
+
+			session, refreshToken, err := r.Start(c.Request.Context(), principal, c.Request.UserAgent(), c.ClientIP())
+			if err != nil {
+				return 0, nil, err
+			}
+
+			resp["refreshToken"] = refreshToken
+			resp["refreshExpiresIn"] = int(time.Until(session.validUntil()).Seconds())
+			resp["sessionId"] = session.ID
+			body, err = json.Marshal(resp)
+			return status, body, err
+		})
+	}
+}
+
+func formatRefreshToken(id, secret string) string {
+	return refreshTokenPrefix + "_" + id + "_" + secret
+}
+
+// parseRefreshToken separa o ID da sessão e o segredo de um refresh token
+func parseRefreshToken(token string) (id, secret string, ok bool) {
+	parts := strings.SplitN(token, "_", 3)
+	if len(parts) != 3 || parts[0] != refreshTokenPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
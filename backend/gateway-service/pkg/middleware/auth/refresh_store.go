@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrSessionNotFound indica uma sessão de refresh inexistente, expirada ou revogada
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore guarda as sessões de refresh pelo ID e as lista por usuário
+type SessionStore interface {
+	// Get retorna a sessão ou ErrSessionNotFound
+	Get(ctx context.Context, id string) (*RefreshSession, error)
+	// List retorna as sessões ativas do usuário
+	List(ctx context.Context, userID string) ([]*RefreshSession, error)
+	// Create grava uma nova sessão
+	Create(ctx context.Context, s *RefreshSession) error
+	// Update aplica fn à sessão de forma atômica; se fn retorna erro nada é gravado
+	Update(ctx context.Context, id string, fn func(s *RefreshSession) error) error
+	// Delete remove a sessão
+	Delete(ctx context.Context, id string) error
+}
+
+// NewSessionStore cria o armazenamento de sessões configurado. O cliente Redis só é usado
+// com store "redis".
+func NewSessionStore(cfg config.RefreshConfig, client *redis.Client) SessionStore {
+	if cfg.Store == "redis" {
+		return NewRedisSessionStore(client)
+	}
+	return NewMemorySessionStore()
+}
+
+// memorySessionStore mantém as sessões na memória do processo; serve para uma única réplica
+type memorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]*RefreshSession
+	users     map[string]map[string]bool // usuário -> IDs das sessões
+	lastSweep time.Time
+}
+
+// NewMemorySessionStore cria um armazenamento de sessões em memória
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{
+		sessions: make(map[string]*RefreshSession),
+		users:    make(map[string]map[string]bool),
+	}
+}
+
+func (s *memorySessionStore) Get(ctx context.Context, id string) (*RefreshSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.live(id, time.Now())
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return session.clone(), nil
+}
+
+func (s *memorySessionStore) List(ctx context.Context, userID string) ([]*RefreshSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var sessions []*RefreshSession
+	for id := range s.users[userID] {
+		if session, ok := s.live(id, now); ok {
+			sessions = append(sessions, session.clone())
+		}
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+func (s *memorySessionStore) Create(ctx context.Context, session *RefreshSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = session.clone()
+	if s.users[session.UserID] == nil {
+		s.users[session.UserID] = make(map[string]bool)
+	}
+	s.users[session.UserID][session.ID] = true
+	s.sweep(time.Now())
+	return nil
+}
+
+func (s *memorySessionStore) Update(ctx context.Context, id string, fn func(s *RefreshSession) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.live(id, time.Now())
+	if !ok {
+		return ErrSessionNotFound
+	}
+	updated := session.clone()
+	if err := fn(updated); err != nil {
+		return err
+	}
+	s.sessions[id] = updated
+	return nil
+}
+
+func (s *memorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(id)
+	return nil
+}
+
+// live retorna a sessão se ela ainda não expirou, removendo-a caso contrário
+func (s *memorySessionStore) live(id string, now time.Time) (*RefreshSession, bool) {
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if session.expired(now) {
+		s.remove(id)
+		return nil, false
+	}
+	return session, true
+}
+
+// sweep remove as sessões expiradas, no máximo uma vez por minuto
+func (s *memorySessionStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for id := range s.sessions {
+		s.live(id, now)
+	}
+}
+
+func (s *memorySessionStore) remove(id string) {
+	session, ok := s.sessions[id]
+	if !ok {
+		return
+	}
+	delete(s.sessions, id)
+	delete(s.users[session.UserID], id)
+	if len(s.users[session.UserID]) == 0 {
+		delete(s.users, session.UserID)
+	}
+}
+
+// redisSessionStore mantém as sessões no Redis, compartilhadas entre as réplicas do gateway.
+// Cada sessão expira sozinha; o conjunto do usuário é limpo quando listado.
+type redisSessionStore struct {
+	client *redis.Client
+}
+
+// Prefixos das chaves de sessão no Redis
+const (
+	redisSessionPrefix     = "gateway:session:"
+	redisUserSessionPrefix = "gateway:sessions:user:"
+)
+
+// redisUpdateAttempts limita as repetições de Update quando a sessão muda durante a transação
+const redisUpdateAttempts = 5
+
+// NewRedisSessionStore cria um armazenamento de sessões no Redis
+func NewRedisSessionStore(client *redis.Client) SessionStore {
+	return &redisSessionStore{client: client}
+}
+
+func (s *redisSessionStore) Get(ctx context.Context, id string) (*RefreshSession, error) {
+	return s.get(ctx, s.client, id)
+}
+
+func (s *redisSessionStore) get(ctx context.Context, c redis.Cmdable, id string) (*RefreshSession, error) {
+	data, err := c.Get(ctx, redisSessionPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session RefreshSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	if session.expired(time.Now()) {
+		return nil, ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+func (s *redisSessionStore) List(ctx context.Context, userID string) ([]*RefreshSession, error) {
+	ids, err := s.client.SMembers(ctx, redisUserSessionPrefix+userID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*RefreshSession
+	var gone []interface{}
+	for _, id := range ids {
+		session, err := s.Get(ctx, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			gone = append(gone, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if len(gone) > 0 {
+		s.client.SRem(ctx, redisUserSessionPrefix+userID, gone...)
+	}
+
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+func (s *redisSessionStore) Create(ctx context.Context, session *RefreshSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, redisSessionPrefix+session.ID, data, time.Until(session.validUntil()))
+		pipe.SAdd(ctx, redisUserSessionPrefix+session.UserID, session.ID)
+		// As sessões têm a mesma validade máxima, então a mais nova é a última a expirar
+		pipe.Expire(ctx, redisUserSessionPrefix+session.UserID, time.Until(session.ExpiresAt))
+		return nil
+	})
+	return err
+}
+
+func (s *redisSessionStore) Update(ctx context.Context, id string, fn func(s *RefreshSession) error) error {
+	key := redisSessionPrefix + id
+	update := func(tx *redis.Tx) error {
+		session, err := s.get(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := fn(session); err != nil {
+			return err
+		}
+		data, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, time.Until(session.validUntil()))
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < redisUpdateAttempts; attempt++ {
+		err := s.client.Watch(ctx, update, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return redis.TxFailedErr
+}
+
+func (s *redisSessionStore) Delete(ctx context.Context, id string) error {
+	session, err := s.Get(ctx, id)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, redisSessionPrefix+id)
+		pipe.SRem(ctx, redisUserSessionPrefix+session.UserID, id)
+		return nil
+	})
+	return err
+}
+
+// sortSessions ordena as sessões da mais recente para a mais antiga
+func sortSessions(sessions []*RefreshSession) {
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+)
+
+// newTestRefreshTokens cria o refresh de sessões com armazenamentos em memória
+func newTestRefreshTokens(t *testing.T) (*RefreshTokens, RevocationStore) {
+	t.Helper()
+	issuer, err := NewTokenIssuer(config.OAuthConfig{}, "test-secret")
+	if err != nil {
+		t.Fatalf("NewTokenIssuer: %v", err)
+	}
+	revocations := NewMemoryRevocationStore(time.Hour)
+	return NewRefreshTokens(config.RefreshConfig{}, NewMemorySessionStore(), issuer, revocations), revocations
+}
+
+// startTestSession abre uma sessão para o usuário e retorna o refresh token
+func startTestSession(t *testing.T, r *RefreshTokens, userID string) string {
+	t.Helper()
+	_, token, err := r.Start(context.Background(), &Principal{UserID: userID, AuthTime: time.Now()}, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return token
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	r, _ := newTestRefreshTokens(t)
+	ctx := context.Background()
+	first := startTestSession(t, r, "u1")
+
+	refreshed, err := r.Refresh(ctx, first, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if refreshed.AccessToken == "" {
+		t.Error("Refresh did not issue an access token")
+	}
+	if refreshed.RefreshToken == first {
+		t.Error("Refresh returned the same refresh token")
+	}
+
+	again, err := r.Refresh(ctx, refreshed.RefreshToken, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Refresh with rotated token: %v", err)
+	}
+	if again.RefreshToken == refreshed.RefreshToken {
+		t.Error("second Refresh returned the same refresh token")
+	}
+}
+
+func TestRefreshRejectsInvalidToken(t *testing.T) {
+	r, _ := newTestRefreshTokens(t)
+	token := startTestSession(t, r, "u1")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"malformed", "not-a-refresh-token"},
+		{"unknown session", "gwr_unknown_secret"},
+		{"wrong secret", token[:len(token)-4] + "AAAA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := r.Refresh(context.Background(), tt.token, "127.0.0.1"); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Errorf("Refresh(%q) error = %v, want %v", tt.token, err, ErrInvalidRefreshToken)
+			}
+		})
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	r, revocations := newTestRefreshTokens(t)
+	ctx := context.Background()
+	first := startTestSession(t, r, "u1")
+
+	refreshed, err := r.Refresh(ctx, first, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// O token já trocado, apresentado de novo, indica roubo: a família inteira é encerrada
+	if _, err := r.Refresh(ctx, first, "127.0.0.1"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Refresh with reused token error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if _, err := r.Refresh(ctx, refreshed.RefreshToken, "127.0.0.1"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh with current token after reuse error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	sessions, err := r.Sessions(ctx, "u1")
+	if err != nil {
+		t.Fatalf("Sessions: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("Sessions after reuse = %d, want 0", len(sessions))
+	}
+
+	for jti := range refreshed.Session.AccessTokens {
+		revoked, err := revocations.IsRevoked(ctx, &Principal{UserID: "u1", TokenID: jti, IssuedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("IsRevoked: %v", err)
+		}
+		if !revoked {
+			t.Errorf("access token %s issued by the family was not revoked", jti)
+		}
+	}
+}
+
+func TestRefreshAfterUserRevoked(t *testing.T) {
+	r, revocations := newTestRefreshTokens(t)
+	ctx := context.Background()
+	token := startTestSession(t, r, "u1")
+	other := startTestSession(t, r, "u2")
+
+	// O iat tem precisão de segundos: a revogação no segundo seguinte alcança as sessões abertas
+	if err := revocations.RevokeUser(ctx, "u1", time.Now().Truncate(time.Second).Add(time.Second)); err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+
+	if _, err := r.Refresh(ctx, token, "127.0.0.1"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after revoke error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	sessions, err := r.Sessions(ctx, "u1")
+	if err != nil {
+		t.Fatalf("Sessions: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("Sessions after revoke = %d, want 0", len(sessions))
+	}
+
+	// Os outros usuários e os logins seguintes à revogação não são afetados
+	if _, err := r.Refresh(ctx, other, "127.0.0.1"); err != nil {
+		t.Errorf("Refresh for another user: %v", err)
+	}
+	if err := revocations.RevokeUser(ctx, "u3", time.Now()); err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+	if _, err := r.Refresh(ctx, startTestSession(t, r, "u3"), "127.0.0.1"); err != nil {
+		t.Errorf("Refresh for a login right after the revoke: %v", err)
+	}
+}
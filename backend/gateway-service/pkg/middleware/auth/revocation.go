@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrRevokedToken indica que o token foi revogado por logout ou bloqueio do usuário
+var ErrRevokedToken = errors.New("token has been revoked")
+
+// RevocationStore guarda os tokens revogados, pelo jti, e o instante antes do qual
+// todos os tokens de um usuário deixam de valer
+type RevocationStore interface {
+	// RevokeToken revoga um token até a sua expiração
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// RevokeUser revoga todos os tokens do usuário emitidos até before
+	RevokeUser(ctx context.Context, userID string, before time.Time) error
+	// IsRevoked indica se o token do principal foi revogado
+	IsRevoked(ctx context.Context, p *Principal) (bool, error)
+}
+
+// NewRevocationStore cria o armazenamento de revogações configurado. O cliente Redis só
+// é usado com store "redis".
+func NewRevocationStore(cfg config.RevocationConfig, client *redis.Client) RevocationStore {
+	retention := cfg.Retention
+	if retention <= 0 {
+		retention = 24 * time.Hour
+	}
+
+	if cfg.Store == "redis" {
+		return NewRedisRevocationStore(client, retention)
+	}
+	return NewMemoryRevocationStore(retention)
+}
+
+// revokedBefore indica se um token emitido em issuedAt é anterior à revogação do usuário.
+// O iat tem precisão de segundos, por isso a revogação também é truncada: um token emitido no
+// mesmo segundo da revogação, como o do login logo em seguida, continua valendo. Tokens sem
+// iat são considerados revogados.
+func revokedBefore(issuedAt, before time.Time) bool {
+	return issuedAt.Before(before.Truncate(time.Second))
+}
+
+// memoryRevocationStore mantém as revogações na memória do processo; serve para uma
+// única réplica do gateway
+type memoryRevocationStore struct {
+	retention time.Duration
+
+	mu        sync.Mutex
+	tokens    map[string]time.Time // jti -> expiração do token
+	users     map[string]time.Time // usuário -> revogado antes de
+	lastSweep time.Time
+}
+
+// NewMemoryRevocationStore cria um armazenamento de revogações em memória
+func NewMemoryRevocationStore(retention time.Duration) RevocationStore {
+	return &memoryRevocationStore{
+		retention: retention,
+		tokens:    make(map[string]time.Time),
+		users:     make(map[string]time.Time),
+	}
+}
+
+func (s *memoryRevocationStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[tokenID] = expiresAt
+	s.sweep(time.Now())
+	return nil
+}
+
+func (s *memoryRevocationStore) RevokeUser(ctx context.Context, userID string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if before.After(s.users[userID]) {
+		s.users[userID] = before
+	}
+	s.sweep(time.Now())
+	return nil
+}
+
+func (s *memoryRevocationStore) IsRevoked(ctx context.Context, p *Principal) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p.TokenID != "" {
+		if _, ok := s.tokens[p.TokenID]; ok {
+			return true, nil
+		}
+	}
+	if before, ok := s.users[p.UserID]; ok && time.Since(before) < s.retention {
+		return revokedBefore(p.IssuedAt, before), nil
+	}
+	return false, nil
+}
+
+// sweep remove as revogações que não podem mais afetar nenhum token, no máximo uma vez por minuto
+func (s *memoryRevocationStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for id, expiresAt := range s.tokens {
+		if now.After(expiresAt) {
+			delete(s.tokens, id)
+		}
+	}
+	for id, before := range s.users {
+		if now.Sub(before) >= s.retention {
+			delete(s.users, id)
+		}
+	}
+}
+
+// redisRevocationStore mantém as revogações no Redis, compartilhadas entre as réplicas
+// do gateway. As chaves expiram sozinhas quando deixam de ser necessárias.
+type redisRevocationStore struct {
+	client    *redis.Client
+	retention time.Duration
+}
+
+// Prefixos das chaves de revogação no Redis
+const (
+	redisRevokedTokenPrefix = "gateway:revoked:token:"
+	redisRevokedUserPrefix  = "gateway:revoked:user:"
+)
+
+// NewRedisRevocationStore cria um armazenamento de revogações no Redis
+func NewRedisRevocationStore(client *redis.Client, retention time.Duration) RevocationStore {
+	return &redisRevocationStore{client: client, retention: retention}
+}
+
+func (s *redisRevocationStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, redisRevokedTokenPrefix+tokenID, 1, ttl).Err()
+}
+
+// revokeUserScript grava ARGV[1] em KEYS[1], com validade de ARGV[2] milissegundos, somente se
+// for posterior ao valor atual: uma revogação mais antiga nunca desfaz uma mais recente
+var revokeUserScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tonumber(ARGV[1]) > current then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+end
+return 1
+`)
+
+func (s *redisRevocationStore) RevokeUser(ctx context.Context, userID string, before time.Time) error {
+	return revokeUserScript.Run(ctx, s.client, []string{redisRevokedUserPrefix + userID}, before.Unix(), s.retention.Milliseconds()).Err()
+}
+
+func (s *redisRevocationStore) IsRevoked(ctx context.Context, p *Principal) (bool, error) {
+	tokenKey := redisRevokedTokenPrefix + p.TokenID
+	if p.TokenID == "" {
+		// Sem jti só a revogação por usuário se aplica; a chave vazia nunca existe
+		tokenKey = redisRevokedTokenPrefix
+	}
+
+	values, err := s.client.MGet(ctx, tokenKey, redisRevokedUserPrefix+p.UserID).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if p.TokenID != "" && values[0] != nil {
+		return true, nil
+	}
+	if raw, ok := values[1].(string); ok {
+		seconds, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		return revokedBefore(p.IssuedAt, time.Unix(seconds, 0)), nil
+	}
+	return false, nil
+}
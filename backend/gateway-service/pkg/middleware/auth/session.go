@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidCSRFToken indica uma requisição de sessão por cookie sem o token CSRF correto
+var ErrInvalidCSRFToken = errors.New("missing or invalid CSRF token")
+
+// Sessions implementa o modo de sessão por cookie dos clientes web. O token de acesso fica
+// em um cookie HttpOnly e o token CSRF, ligado a ele, é devolvido no login e enviado pelo
+// cliente em um cabeçalho nas requisições que alteram estado (double-submit).
+type Sessions struct {
+	cfg     config.SessionConfig
+	origins map[string]config.SessionOriginConfig
+}
+
+// NewSessions cria o modo de sessão para as origens configuradas; retorna nil sem origens
+func NewSessions(cfg config.SessionConfig, origins []config.SessionOriginConfig) *Sessions {
+	if len(origins) == 0 {
+		return nil
+	}
+	s := &Sessions{cfg: cfg, origins: make(map[string]config.SessionOriginConfig, len(origins))}
+	for _, origin := range origins {
+		s.origins[origin.Origin] = origin
+	}
+	return s
+}
+
+// token retorna o token do cookie de sessão, se houver
+func (s *Sessions) token(r *http.Request) string {
+	cookie, err := r.Cookie(s.cfg.CookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// checkCSRF exige, nos métodos que alteram estado, o mesmo token CSRF no cabeçalho e no
+// cookie, emitido para o token da sessão
+func (s *Sessions) checkCSRF(r *http.Request, token string) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	header := r.Header.Get(s.cfg.CSRFHeader)
+	cookie, err := r.Cookie(s.cfg.CSRFCookieName)
+	if header == "" || err != nil || subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return ErrInvalidCSRFToken
+	}
+
+	nonce, mac, ok := strings.Cut(header, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(csrfMAC(token, nonce))) {
+		return ErrInvalidCSRFToken
+	}
+	return nil
+}
+
+// newCSRFToken gera um token CSRF ligado ao token da sessão: um valor aleatório e o HMAC
+// dele com o próprio token, que o cliente não conhece por estar em um cookie HttpOnly
+func newCSRFToken(token string) (string, error) {
+	nonce, err := randomString(16, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+	return nonce + "." + csrfMAC(token, nonce), nil
+}
+
+func csrfMAC(token, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// strip remove os cookies da sessão da requisição para que o token não seja repassado aos serviços
+func (s *Sessions) strip(r *http.Request) {
+	cookies := r.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != s.cfg.CookieName && cookie.Name != s.cfg.CSRFCookieName && cookie.Name != s.cfg.RefreshCookie {
+			r.AddCookie(cookie)
+		}
+	}
+}
+
+// start grava os cookies da sessão com os atributos da origem e retorna o token CSRF
+func (s *Sessions) start(c *gin.Context, origin config.SessionOriginConfig, token string, expiresAt time.Time) (string, error) {
+	csrf, err := newCSRFToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	maxAge := int(time.Until(expiresAt).Seconds())
+	http.SetCookie(c.Writer, s.cookie(origin, s.cfg.CookieName, token, maxAge, true))
+	http.SetCookie(c.Writer, s.cookie(origin, s.cfg.CSRFCookieName, csrf, maxAge, false))
+	return csrf, nil
+}
+
+// End remove os cookies da sessão da resposta, quando a requisição vem de uma origem com sessão
+func (s *Sessions) End(c *gin.Context) {
+	origin, ok := s.origin(c.Request)
+	if !ok {
+		return
+	}
+	http.SetCookie(c.Writer, s.cookie(origin, s.cfg.CookieName, "", -1, true))
+	http.SetCookie(c.Writer, s.cookie(origin, s.cfg.CSRFCookieName, "", -1, false))
+	http.SetCookie(c.Writer, s.cookie(origin, s.cfg.RefreshCookie, "", -1, true))
+}
+
+// RefreshToken retorna o refresh token do cookie, aceito apenas das origens com sessão
+func (s *Sessions) RefreshToken(r *http.Request) string {
+	if _, ok := s.origin(r); !ok {
+		return ""
+	}
+	cookie, err := r.Cookie(s.cfg.RefreshCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// origin retorna a configuração da origem da requisição, se ela usa o modo de sessão
+func (s *Sessions) origin(r *http.Request) (config.SessionOriginConfig, bool) {
+	origin, ok := s.origins[r.Header.Get("Origin")]
+	return origin, ok
+}
+
+func (s *Sessions) cookie(origin config.SessionOriginConfig, name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     s.cfg.Path,
+		Domain:   s.cfg.Domain,
+		MaxAge:   maxAge,
+		Secure:   !origin.Insecure,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteLaxMode,
+	}
+	switch strings.ToLower(origin.SameSite) {
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+// SessionLogin retorna o middleware do login (e do refresh) no modo de sessão. Para as origens
+// com sessão, o token devolvido vai para o cookie HttpOnly, assim como o refresh token, e o
+// corpo da resposta passa a trazer, no lugar deles, o token CSRF em "csrfToken". As demais
+// origens não são afetadas.
+func (a *Authenticator) SessionLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a.sessions == nil {
+			c.Next()
+			return
+		}
+		origin, ok := a.sessions.origin(c.Request)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		rewriteResponse(c, func(status int, body []byte) (int, []byte, error) {
+			if status != http.StatusOK {
+				return status, body, nil
+			}
+			body, err := a.startSession(c, origin, body)
+			return status, body, err
+		})
+	}
+}
+
+// startSession valida o token devolvido pelo login, grava os cookies e retorna o corpo sem os tokens
+func (a *Authenticator) startSession(c *gin.Context, origin config.SessionOriginConfig, body []byte) ([]byte, error) {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	token, _ := resp["token"].(string)
+	if token == "" {
+		return nil, errors.New("login response has no token")
+	}
+
+	principal, err := a.Verify(c.Request.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := a.sessions.start(c, origin, token, principal.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if refreshToken, _ := resp["refreshToken"].(string); refreshToken != "" {
+		maxAge, _ := resp["refreshExpiresIn"].(float64)
+		http.SetCookie(c.Writer, a.sessions.cookie(origin, a.sessions.cfg.RefreshCookie, refreshToken, int(maxAge), true))
+		delete(resp, "refreshToken")
+	}
+
+	delete(resp, "token")
+	resp["csrfToken"] = csrf
+	return json.Marshal(resp)
+}
+
+// rewriteResponse executa os handlers seguintes retendo a resposta, que só é enviada depois de
+// passar por rewrite. Se rewrite falhar o cliente recebe 502.
+func rewriteResponse(c *gin.Context, rewrite func(status int, body []byte) (int, []byte, error)) {
+	// A resposta é reescrita, então o serviço não deve comprimi-la
+	c.Request.Header.Del("Accept-Encoding")
+
+	writer := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+
+	status, body, err := rewrite(writer.status, writer.body.Bytes())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to start session")
+		status, body = http.StatusBadGateway, []byte(`{"error":"failed to start session"}`)
+		c.Header("Content-Type", "application/json; charset=utf-8")
+	}
+
+	c.Header("Content-Length", strconv.Itoa(len(body)))
+	c.Writer.WriteHeader(status)
+	c.Writer.Write(body)
+}
+
+// bufferedWriter retém a resposta dos handlers seguintes para que ela possa ser reescrita
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *bufferedWriter) Flush() {}
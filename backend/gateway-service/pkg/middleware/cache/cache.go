@@ -0,0 +1,466 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	cacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_requests_total",
+			Help: "Total de chamadas aos serviços avaliadas pelo cache, por serviço e resultado (hit, miss, stale)",
+		},
+		[]string{"service", "result"},
+	)
+
+	cacheRevalidationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_revalidations_total",
+			Help: "Total de atualizações em segundo plano de respostas vencidas, por serviço e resultado (updated, failed)",
+		},
+		[]string{"service", "result"},
+	)
+
+	cacheStoreErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_store_errors_total",
+			Help: "Total de falhas do armazenamento do cache, por operação (get, set)",
+		},
+		[]string{"operation"},
+	)
+)
+
+// Valores do cabeçalho X-Cache
+const (
+	StatusHit   = "HIT"   // resposta guardada dentro da validade
+	StatusMiss  = "MISS"  // resposta buscada no serviço
+	StatusStale = "STALE" // resposta vencida, servida enquanto é atualizada ou porque o serviço falhou
+)
+
+// cacheableStatus lista os status guardados no cache
+var cacheableStatus = map[int]bool{
+	http.StatusOK: true, http.StatusNonAuthoritativeInfo: true, http.StatusNoContent: true,
+	http.StatusMovedPermanently: true, http.StatusNotFound: true, http.StatusGone: true,
+}
+
+// policy define o tempo de vida das respostas; os campos zerados não substituem os da resposta
+type policy struct {
+	ttl                  time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+}
+
+// route é uma substituição da política para um grupo de rotas
+type route struct {
+	paths []*proxy.PathTemplate
+	policy
+}
+
+// Cache guarda as respostas das leituras aos serviços. O tempo de vida segue o Cache-Control
+// (max-age, s-maxage, stale-while-revalidate e stale-if-error) ou o Expires da resposta, a
+// variante segue o Vary, e as rotas podem substituir esses valores.
+type Cache struct {
+	store         Store
+	defaults      policy
+	routes        []*route
+	maxEntryBytes int64
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+}
+
+// NewCache cria o cache de respostas com as rotas de cfg; retorna nil quando desativado
+func NewCache(cfg config.CacheConfig, store Store) (*Cache, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	c := &Cache{
+		store:         store,
+		defaults:      policy{ttl: cfg.DefaultTTL, staleWhileRevalidate: cfg.StaleWhileRevalidate, staleIfError: cfg.StaleIfError},
+		maxEntryBytes: cfg.MaxEntryBytes,
+		revalidating:  make(map[string]bool),
+	}
+	if c.maxEntryBytes <= 0 {
+		c.maxEntryBytes = 1 << 20
+	}
+	for i, rc := range cfg.Routes {
+		r := &route{policy: policy{ttl: rc.TTL, staleWhileRevalidate: rc.StaleWhileRevalidate, staleIfError: rc.StaleIfError}}
+		for _, raw := range rc.Paths {
+			path, err := proxy.ParsePathTemplate(raw)
+			if err != nil {
+				return nil, fmt.Errorf("cache.routes[%d]: %w", i, err)
+			}
+			r.paths = append(r.paths, path)
+		}
+		c.routes = append(c.routes, r)
+	}
+	return c, nil
+}
+
+// lookupKey guarda no contexto a requisição que pode usar o cache
+type lookupKey struct{}
+
+// lookup liga as chamadas aos serviços à requisição do gateway: a substituição da rota e os
+// cabeçalhos da resposta, onde vai o X-Cache
+type lookup struct {
+	route  *route
+	header http.Header
+}
+
+// Cacheable retorna o middleware que permite às leituras da rota usar o cache: as chamadas
+// feitas pelos handlers aos serviços passam pelo cache e a resposta recebe o cabeçalho X-Cache
+// (HIT, MISS ou STALE). Sem cache configurado (c nil) o middleware não faz nada.
+func (c *Cache) Cacheable() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if c == nil || (ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead) {
+			ctx.Next()
+			return
+		}
+
+		l := &lookup{route: c.routeFor(ctx.Request.URL.Path), header: ctx.Writer.Header()}
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), lookupKey{}, l))
+		ctx.Next()
+	}
+}
+
+// routeFor retorna a substituição que cobre o caminho, ou nil. Como no roteamento, os
+// segmentos literais têm precedência: "/products/search" vence "/products/:id" em qualquer
+// ordem; entre templates igualmente específicos vale o primeiro.
+func (c *Cache) routeFor(path string) *route {
+	var (
+		best   *route
+		params int
+	)
+	for _, r := range c.routes {
+		for _, template := range r.paths {
+			if _, ok := template.Match(path); ok && (best == nil || len(template.Params()) < params) {
+				best, params = r, len(template.Params())
+			}
+		}
+	}
+	return best
+}
+
+// Transport envolve o transporte das chamadas a um serviço com o cache. Só passam pelo cache
+// as leituras feitas em requisições liberadas por Cacheable. Sem cache configurado (c nil)
+// retorna next.
+func (c *Cache) Transport(service string, next http.RoundTripper) http.RoundTripper {
+	if c == nil {
+		return next
+	}
+	return &transport{cache: c, service: service, next: next}
+}
+
+// transport é o http.RoundTripper do cache para um serviço
+type transport struct {
+	cache   *Cache
+	service string
+	next    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l, ok := req.Context().Value(lookupKey{}).(*lookup)
+	if !ok || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+		return t.next.RoundTrip(req)
+	}
+
+	key := t.service + " " + req.Method + " " + req.URL.String()
+	now := time.Now()
+	entry, err := t.cache.get(req, key)
+	if err != nil {
+		cacheStoreErrorsTotal.WithLabelValues("get").Inc()
+		logrus.WithError(err).WithField("service", t.service).Warn("Failed to read response cache")
+	}
+
+	if entry != nil {
+		switch {
+		case now.Before(entry.FreshUntil):
+			return t.serve(req, l, entry, StatusHit, now), nil
+		case now.Before(entry.FreshUntil.Add(entry.StaleWhileRevalidate)):
+			t.revalidate(req, l.route, key)
+			return t.serve(req, l, entry, StatusStale, now), nil
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if entry != nil && now.Before(entry.FreshUntil.Add(entry.StaleIfError)) && (err != nil || resp.StatusCode >= http.StatusInternalServerError) {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		logrus.WithError(err).WithField("service", t.service).Debug("Servindo resposta vencida do cache após falha do serviço")
+		return t.serve(req, l, entry, StatusStale, now), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cacheRequestsTotal.WithLabelValues(t.service, "miss").Inc()
+	l.header.Set("X-Cache", StatusMiss)
+	return t.cache.put(req, l.route, key, resp, now), nil
+}
+
+// serve responde com a entrada guardada
+func (t *transport) serve(req *http.Request, l *lookup, entry *Entry, status string, now time.Time) *http.Response {
+	cacheRequestsTotal.WithLabelValues(t.service, strings.ToLower(status)).Inc()
+	l.header.Set("X-Cache", status)
+
+	header := entry.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Age", strconv.Itoa(int(now.Sub(entry.StoredAt).Seconds())))
+	header.Set("X-Cache", status)
+
+	body := entry.Body
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// revalidate atualiza a entrada em segundo plano, uma vez por chave. A atualização não
+// depende da requisição do cliente, que já foi respondida.
+func (t *transport) revalidate(req *http.Request, r *route, key string) {
+	c := t.cache
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	out := req.Clone(context.WithoutCancel(req.Context()))
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+
+		resp, err := t.next.RoundTrip(out)
+		if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			cacheRevalidationsTotal.WithLabelValues(t.service, "failed").Inc()
+			return
+		}
+		resp = c.put(out, r, key, resp, time.Now())
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		cacheRevalidationsTotal.WithLabelValues(t.service, "updated").Inc()
+	}()
+}
+
+// get busca a entrada da requisição, seguindo o Vary até a variante
+func (c *Cache) get(req *http.Request, key string) (*Entry, error) {
+	entry, err := c.store.Get(req.Context(), hashKey(key))
+	if err != nil || entry == nil || entry.Status != 0 {
+		return entry, err
+	}
+	return c.store.Get(req.Context(), hashKey(variantKey(key, entry.Vary, req)))
+}
+
+// put guarda a resposta quando ela pode ser guardada e retorna a resposta a ser entregue
+func (c *Cache) put(req *http.Request, r *route, key string, resp *http.Response, now time.Time) *http.Response {
+	entry, ok := c.entryFor(r, resp, now)
+	if !ok {
+		return resp
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxEntryBytes+1))
+	if err != nil || int64(len(body)) > c.maxEntryBytes {
+		// Grande demais, ou com falha na leitura: entrega o que foi lido seguido do restante
+		resp.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return resp
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	entry.Body = body
+
+	ttl := entry.FreshUntil.Sub(now) + max(entry.StaleWhileRevalidate, entry.StaleIfError)
+	ctx := req.Context()
+	if len(entry.Vary) > 0 {
+		marker := &Entry{Vary: entry.Vary, StoredAt: now, FreshUntil: entry.FreshUntil}
+		err = c.store.Set(ctx, hashKey(key), marker, ttl)
+		key = variantKey(key, entry.Vary, req)
+	}
+	if err == nil {
+		err = c.store.Set(ctx, hashKey(key), entry, ttl)
+	}
+	if err != nil {
+		cacheStoreErrorsTotal.WithLabelValues("set").Inc()
+		logrus.WithError(err).Warn("Failed to write response cache")
+	}
+	return resp
+}
+
+// entryFor calcula a validade da resposta pelo Cache-Control ou Expires e pelas substituições
+// configuradas. Falso quando a resposta não pode ser guardada em um cache compartilhado.
+func (c *Cache) entryFor(r *route, resp *http.Response, now time.Time) (*Entry, bool) {
+	if !cacheableStatus[resp.StatusCode] || resp.Header.Get("Set-Cookie") != "" {
+		return nil, false
+	}
+	directives := parseCacheControl(resp.Header.Values("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return nil, false
+	}
+	if _, ok := directives["private"]; ok {
+		return nil, false
+	}
+	if _, ok := directives["no-cache"]; ok {
+		return nil, false
+	}
+	vary := parseVary(resp.Header.Values("Vary"))
+	if len(vary) == 1 && vary[0] == "*" {
+		return nil, false
+	}
+
+	p := c.defaults
+	if ttl, ok := directives.seconds("s-maxage"); ok {
+		p.ttl = ttl
+	} else if ttl, ok := directives.seconds("max-age"); ok {
+		p.ttl = ttl
+	} else if expires, err := http.ParseTime(resp.Header.Get("Expires")); err == nil {
+		p.ttl = expires.Sub(now)
+	}
+	if stale, ok := directives.seconds("stale-while-revalidate"); ok {
+		p.staleWhileRevalidate = stale
+	}
+	if stale, ok := directives.seconds("stale-if-error"); ok {
+		p.staleIfError = stale
+	}
+	// As ausências não recebem a validade da rota: um produto criado depois não pode
+	// continuar "não encontrado" pelo tempo configurado para o catálogo
+	if r != nil && resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+		p = r.override(p)
+	}
+	if p.ttl <= 0 {
+		return nil, false
+	}
+
+	header := resp.Header.Clone()
+	header.Del("Age")
+	return &Entry{
+		Status:               resp.StatusCode,
+		Header:               header,
+		Vary:                 vary,
+		StoredAt:             now,
+		FreshUntil:           now.Add(p.ttl),
+		StaleWhileRevalidate: p.staleWhileRevalidate,
+		StaleIfError:         p.staleIfError,
+	}, true
+}
+
+// override aplica os valores configurados na rota sobre os da resposta
+func (r *route) override(p policy) policy {
+	if r.ttl > 0 {
+		p.ttl = r.ttl
+	}
+	if r.staleWhileRevalidate > 0 {
+		p.staleWhileRevalidate = r.staleWhileRevalidate
+	}
+	if r.staleIfError > 0 {
+		p.staleIfError = r.staleIfError
+	}
+	return p
+}
+
+// cacheControl são as diretivas de um Cache-Control, pelo nome em minúsculas
+type cacheControl map[string]string
+
+func parseCacheControl(values []string) cacheControl {
+	directives := make(cacheControl)
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// seconds retorna o valor em segundos da diretiva
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	arg, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(arg)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// parseVary retorna os cabeçalhos do Vary na forma canônica e em ordem
+func parseVary(values []string) []string {
+	var names []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return []string{"*"}
+			}
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// variantKey acrescenta à chave os valores dos cabeçalhos do Vary na requisição
+func variantKey(key string, vary []string, req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteString("\n" + name + ": " + strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// hashKey resume a chave, para que URLs longas não inflem o armazenamento
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// prefixedBody entrega o início já lido do corpo seguido do restante
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	cacheMemoryBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_cache_memory_bytes",
+			Help: "Tamanho das respostas guardadas no cache em memória",
+		},
+	)
+
+	cacheEvictionsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_evictions_total",
+			Help: "Total de respostas descartadas do cache em memória para abrir espaço",
+		},
+	)
+)
+
+// Entry é uma resposta guardada no cache. Uma entrada sem Status apenas indica, pelo Vary,
+// quais cabeçalhos da requisição escolhem a variante guardada.
+type Entry struct {
+	Status               int           `json:"status,omitempty"`
+	Header               http.Header   `json:"header,omitempty"`
+	Body                 []byte        `json:"body,omitempty"`
+	Vary                 []string      `json:"vary,omitempty"`
+	StoredAt             time.Time     `json:"storedAt"`
+	FreshUntil           time.Time     `json:"freshUntil"`
+	StaleWhileRevalidate time.Duration `json:"staleWhileRevalidate,omitempty"`
+	StaleIfError         time.Duration `json:"staleIfError,omitempty"`
+}
+
+// Store guarda as respostas do cache. As entradas devolvidas são compartilhadas e não devem
+// ser alteradas.
+type Store interface {
+	// Get retorna a entrada da chave, ou nil quando não existe ou expirou
+	Get(ctx context.Context, key string) (*Entry, error)
+	// Set guarda a entrada na chave por ttl
+	Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error
+}
+
+// NewStore cria o armazenamento de respostas configurado. O cliente Redis só é usado com
+// store "redis".
+func NewStore(cfg config.CacheConfig, client *redis.Client) Store {
+	if cfg.Store == "redis" {
+		return NewRedisStore(client)
+	}
+	return NewMemoryStore(cfg.MaxBytes)
+}
+
+// memoryStore mantém as respostas na memória do processo, descartando as usadas há mais
+// tempo quando o tamanho total passa de maxBytes
+type memoryStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	items    map[string]*list.Element
+	order    *list.List // da usada mais recentemente para a menos recente
+}
+
+type memoryItem struct {
+	key       string
+	entry     *Entry
+	size      int64
+	expiresAt time.Time
+}
+
+// NewMemoryStore cria um armazenamento de respostas em memória com até maxBytes (padrão 64MB)
+func NewMemoryStore(maxBytes int64) Store {
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	return &memoryStore{maxBytes: maxBytes, items: make(map[string]*list.Element), order: list.New()}
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	item := elem.Value.(*memoryItem)
+	if time.Now().After(item.expiresAt) {
+		s.remove(elem)
+		return nil, nil
+	}
+	s.order.MoveToFront(elem)
+	return item.entry, nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	size := entrySize(key, entry)
+	if size > s.maxBytes {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		s.remove(elem)
+	}
+	s.items[key] = s.order.PushFront(&memoryItem{key: key, entry: entry, size: size, expiresAt: time.Now().Add(ttl)})
+	s.size += size
+
+	for s.size > s.maxBytes {
+		s.remove(s.order.Back())
+		cacheEvictionsTotal.Inc()
+	}
+	cacheMemoryBytes.Set(float64(s.size))
+	return nil
+}
+
+// remove descarta o item; chamado com mu travado
+func (s *memoryStore) remove(elem *list.Element) {
+	item := s.order.Remove(elem).(*memoryItem)
+	delete(s.items, item.key)
+	s.size -= item.size
+	cacheMemoryBytes.Set(float64(s.size))
+}
+
+// entrySize estima a memória ocupada pela entrada
+func entrySize(key string, entry *Entry) int64 {
+	size := int64(len(key) + len(entry.Body))
+	for name, values := range entry.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	for _, name := range entry.Vary {
+		size += int64(len(name))
+	}
+	return size
+}
+
+// redisStore mantém as respostas no Redis, compartilhadas entre as réplicas do gateway
+type redisStore struct {
+	client *redis.Client
+}
+
+// Prefixo das chaves do cache de respostas no Redis
+const redisCachePrefix = "gateway:cache:"
+
+// NewRedisStore cria um armazenamento de respostas no Redis
+func NewRedisStore(client *redis.Client) Store {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) (*Entry, error) {
+	raw, err := s.client.Get(ctx, redisCachePrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, redisCachePrefix+key, raw, ttl).Err()
+}
@@ -15,6 +15,11 @@ func Cors(cfg *config.Config) gin.HandlerFunc {
 		MaxAge:           86400, // 24 horas
 	}
 
+	// Clientes no modo de sessão enviam o token CSRF em um cabeçalho próprio
+	if len(cfg.Cors.SessionOrigins) > 0 {
+		corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, cfg.Auth.Session.CSRFHeader)
+	}
+
 	// Configurar origens permitidas
 	if len(cfg.Cors.AllowedOrigins) > 0 {
 		corsConfig.AllowOrigins = cfg.Cors.AllowedOrigins
@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"github.com/ecommerce/gateway-service/pkg/resilience"
+	"github.com/gin-gonic/gin"
+)
+
+// Priority retorna um middleware que define a prioridade das requisições da rota nas chamadas
+// aos serviços: sob sobrecarga as de menor prioridade são descartadas primeiro
+func Priority(priority resilience.Priority) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(resilience.WithPriority(c.Request.Context(), priority))
+		c.Next()
+	}
+}
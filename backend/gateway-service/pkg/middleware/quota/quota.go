@@ -0,0 +1,328 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var quotaRequestsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "gateway_quota_requests_total",
+		Help: "Total de chamadas avaliadas pelas cotas, por plano, cota e resultado (allowed, exceeded, error)",
+	},
+	[]string{"plan", "quota", "result"},
+)
+
+// Janelas das cotas, no calendário UTC
+const (
+	WindowDaily   = "daily"
+	WindowMonthly = "monthly"
+)
+
+// windowGrace mantém os totais por um tempo depois do fim da janela, cobrindo a diferença
+// entre os relógios das réplicas
+const windowGrace = time.Hour
+
+// limit é uma cota de um plano já preparada para avaliação
+type limit struct {
+	name     string
+	paths    []*proxy.PathTemplate
+	methods  []string
+	window   string
+	requests int64
+}
+
+// plan é um plano com as suas cotas
+type plan struct {
+	name   string
+	limits []*limit
+}
+
+// Quotas controla as cotas de chamadas dos consumidores da API. Cada consumidor (chave de
+// API, cliente OAuth ou usuário) tem as cotas do seu plano, contadas por janela diária ou
+// mensal em cada grupo de rotas.
+type Quotas struct {
+	store       Store
+	plans       map[string]*plan
+	defaultPlan string
+}
+
+// NewQuotas cria o controle de cotas com os planos de cfg; retorna nil quando desativado
+func NewQuotas(cfg config.QuotaConfig, store Store) (*Quotas, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	q := &Quotas{store: store, plans: make(map[string]*plan, len(cfg.Plans)), defaultPlan: cfg.DefaultPlan}
+	for _, pc := range cfg.Plans {
+		p := &plan{name: pc.Name}
+		for _, lc := range pc.Quotas {
+			l := &limit{name: lc.Name, window: lc.Window, requests: lc.Requests}
+			if l.window == "" {
+				l.window = WindowMonthly
+			}
+			for _, raw := range lc.Paths {
+				path, err := proxy.ParsePathTemplate(raw)
+				if err != nil {
+					return nil, fmt.Errorf("quotas.plans %s.%s: %w", pc.Name, lc.Name, err)
+				}
+				l.paths = append(l.paths, path)
+			}
+			for _, method := range lc.Methods {
+				l.methods = append(l.methods, strings.ToUpper(method))
+			}
+			p.limits = append(p.limits, l)
+		}
+		q.plans[p.name] = p
+	}
+	return q, nil
+}
+
+// Meter retorna o middleware das cotas, que deve vir depois da autenticação e da
+// autorização: só as chamadas aceitas pelo gateway contam. A chamada é recusada com 429 e o
+// código quota_exceeded, diferente do rate_limit_exceeded dos limites de curto prazo, se
+// alguma cota que cobre a rota estiver esgotada; senão, conta em todas elas. Falhas do
+// armazenamento deixam a chamada passar sem contar. Sem cotas configuradas (q nil) o
+// middleware não faz nada.
+func (q *Quotas) Meter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if q == nil {
+			c.Next()
+			return
+		}
+
+		// Sem usuário, ou no suporte agindo como um cliente, não há consumo a contar
+		principal, ok := auth.PrincipalFrom(c)
+		if !ok || principal.ActorID != "" {
+			c.Next()
+			return
+		}
+		p := q.planFor(principal)
+		if p == nil {
+			c.Next()
+			return
+		}
+
+		var limits []*limit
+		for _, l := range p.limits {
+			if l.matches(c.Request) {
+				limits = append(limits, l)
+			}
+		}
+		if len(limits) == 0 {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		consumer := consumerOf(principal)
+		charges := make([]Charge, len(limits))
+		for i, l := range limits {
+			charges[i] = Charge{Key: l.key(consumer, now), Limit: l.requests, ExpiresAt: l.reset(now).Add(windowGrace)}
+		}
+
+		// Todas as cotas são contadas de uma só vez, para que a chamada recusada por uma não
+		// seja contada nas outras
+		used, accepted, err := q.store.Consume(c.Request.Context(), charges)
+		if err != nil {
+			q.failOpen(c, p, limits, err)
+			return
+		}
+		if !accepted {
+			for i, l := range limits {
+				if used[i] >= l.requests {
+					q.reject(c, p, l, used[i], now)
+					return
+				}
+			}
+		}
+
+		var reported *limit
+		var remaining int64
+		for i, l := range limits {
+			quotaRequestsTotal.WithLabelValues(p.name, l.name, "allowed").Inc()
+			if reported == nil || l.requests-used[i] < remaining {
+				reported, remaining = l, l.requests-used[i]
+			}
+		}
+
+		setHeaders(c, reported, remaining, now)
+		c.Next()
+	}
+}
+
+// failOpen registra a falha do armazenamento e deixa a chamada passar
+func (q *Quotas) failOpen(c *gin.Context, p *plan, limits []*limit, err error) {
+	for _, l := range limits {
+		quotaRequestsTotal.WithLabelValues(p.name, l.name, "error").Inc()
+	}
+	logrus.WithError(err).WithField("plan", p.name).Warn("Failed to evaluate quotas")
+	c.Next()
+}
+
+// reject recusa a chamada pela cota esgotada, indicando quando ela é renovada
+func (q *Quotas) reject(c *gin.Context, p *plan, l *limit, used int64, now time.Time) {
+	quotaRequestsTotal.WithLabelValues(p.name, l.name, "exceeded").Inc()
+	setHeaders(c, l, 0, now)
+	resetAt := l.reset(now)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(resetAt.Sub(now).Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":   "quota exceeded",
+		"code":    "quota_exceeded",
+		"plan":    p.name,
+		"quota":   l.name,
+		"window":  l.window,
+		"limit":   l.requests,
+		"used":    used,
+		"resetAt": resetAt,
+	})
+}
+
+// Usage é o consumo das cotas de um consumidor nas janelas atuais
+type Usage struct {
+	Consumer string       `json:"consumer"`
+	Plan     string       `json:"plan,omitempty"`
+	Quotas   []QuotaUsage `json:"quotas"`
+}
+
+// QuotaUsage é o consumo de uma cota na janela atual
+type QuotaUsage struct {
+	Name      string    `json:"name"`
+	Window    string    `json:"window"`
+	Paths     []string  `json:"paths,omitempty"`
+	Methods   []string  `json:"methods,omitempty"`
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt"`
+}
+
+// Usage retorna o consumo das cotas do consumidor autenticado como p; sem plano, a lista
+// de cotas vem vazia
+func (q *Quotas) Usage(ctx context.Context, p *auth.Principal) (*Usage, error) {
+	consumer := consumerOf(p)
+	usage := &Usage{Consumer: consumer, Quotas: []QuotaUsage{}}
+	plan := q.planFor(p)
+	if plan == nil {
+		return usage, nil
+	}
+	usage.Plan = plan.name
+
+	now := time.Now()
+	keys := make([]string, len(plan.limits))
+	for i, l := range plan.limits {
+		keys[i] = l.key(consumer, now)
+	}
+	used, err := q.store.Usage(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, l := range plan.limits {
+		paths := make([]string, len(l.paths))
+		for j, path := range l.paths {
+			paths[j] = path.String()
+		}
+		usage.Quotas = append(usage.Quotas, QuotaUsage{
+			Name:      l.name,
+			Window:    l.window,
+			Paths:     paths,
+			Methods:   l.methods,
+			Limit:     l.requests,
+			Used:      used[i],
+			Remaining: max(0, l.requests-used[i]),
+			ResetAt:   l.reset(now),
+		})
+	}
+	return usage, nil
+}
+
+// planFor retorna o plano do consumidor; sem plano, ou com um plano desconhecido, o plano padrão
+func (q *Quotas) planFor(p *auth.Principal) *plan {
+	if plan, ok := q.plans[p.Plan]; ok {
+		return plan
+	}
+	return q.plans[q.defaultPlan]
+}
+
+// consumerOf identifica o consumidor: a chave de API, o cliente OAuth ou o usuário
+func consumerOf(p *auth.Principal) string {
+	switch {
+	case p.APIKeyID != "":
+		return "apikey:" + p.APIKeyID
+	case p.ClientID != "":
+		return "client:" + p.ClientID
+	default:
+		return "user:" + p.UserID
+	}
+}
+
+// matches indica se a cota cobre o método e o caminho da requisição
+func (l *limit) matches(r *http.Request) bool {
+	if len(l.methods) > 0 && !containsMethod(l.methods, r.Method) {
+		return false
+	}
+	if len(l.paths) == 0 {
+		return true
+	}
+	for _, path := range l.paths {
+		if _, ok := path.Match(r.URL.Path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// start retorna o início da janela atual
+func (l *limit) start(now time.Time) time.Time {
+	now = now.UTC()
+	if l.window == WindowDaily {
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// reset retorna quando a janela atual termina e a cota é renovada
+func (l *limit) reset(now time.Time) time.Time {
+	start := l.start(now)
+	if l.window == WindowDaily {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// key retorna a chave do total do consumidor na cota e na janela atual. O plano não faz
+// parte da chave, para que o consumo continue ao trocar de plano no meio da janela.
+func (l *limit) key(consumer string, now time.Time) string {
+	return consumer + ":" + l.name + ":" + l.start(now).Format("20060102")
+}
+
+// setHeaders escreve os cabeçalhos X-Quota-* com o estado da cota
+func setHeaders(c *gin.Context, l *limit, remaining int64, now time.Time) {
+	c.Header("X-Quota-Limit", strconv.FormatInt(l.requests, 10))
+	c.Header("X-Quota-Remaining", strconv.FormatInt(remaining, 10))
+	c.Header("X-Quota-Reset", strconv.Itoa(int(math.Ceil(l.reset(now).Sub(now).Seconds()))))
+	c.Header("X-Quota-Window", l.window)
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
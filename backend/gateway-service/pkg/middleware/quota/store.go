@@ -0,0 +1,193 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Charge é a contagem de uma chamada em uma cota
+type Charge struct {
+	Key       string
+	Limit     int64
+	ExpiresAt time.Time // quando a chave é descartada
+}
+
+// Store conta as chamadas de cada consumidor por cota e janela
+type Store interface {
+	// Consume conta uma chamada em todas as cotas, de uma só vez, se todos os totais ainda
+	// estiverem abaixo dos limites; caso contrário não conta em nenhuma. Retorna os totais, na
+	// mesma ordem e já com a chamada quando aceita.
+	Consume(ctx context.Context, charges []Charge) ([]int64, bool, error)
+	// Usage retorna os totais das chaves, na mesma ordem; chaves sem chamadas valem zero
+	Usage(ctx context.Context, keys []string) ([]int64, error)
+}
+
+// NewStore cria o armazenamento de cotas configurado. O cliente Redis só é usado com
+// store "redis".
+func NewStore(cfg config.QuotaConfig, client *redis.Client) Store {
+	if cfg.Store == "redis" {
+		return NewRedisStore(client)
+	}
+	return NewMemoryStore()
+}
+
+// memoryStore mantém os totais na memória do processo; serve para uma única réplica, e os
+// totais se perdem quando o gateway reinicia
+type memoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]*counter
+	lastSweep time.Time
+}
+
+type counter struct {
+	used      int64
+	expiresAt time.Time
+}
+
+// NewMemoryStore cria um armazenamento de cotas em memória
+func NewMemoryStore() Store {
+	return &memoryStore{counters: make(map[string]*counter)}
+}
+
+func (s *memoryStore) Consume(ctx context.Context, charges []Charge) ([]int64, bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	counters := make([]*counter, len(charges))
+	used := make([]int64, len(charges))
+	accepted := true
+	for i, charge := range charges {
+		c, ok := s.counters[charge.Key]
+		if !ok || now.After(c.expiresAt) {
+			c = &counter{expiresAt: charge.ExpiresAt}
+			s.counters[charge.Key] = c
+		}
+		counters[i], used[i] = c, c.used
+		if c.used >= charge.Limit {
+			accepted = false
+		}
+	}
+	if !accepted {
+		return used, false, nil
+	}
+
+	for i, c := range counters {
+		c.used++
+		used[i] = c.used
+	}
+	return used, true, nil
+}
+
+func (s *memoryStore) Usage(ctx context.Context, keys []string) ([]int64, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := make([]int64, len(keys))
+	for i, key := range keys {
+		if c, ok := s.counters[key]; ok && !now.After(c.expiresAt) {
+			usage[i] = c.used
+		}
+	}
+	return usage, nil
+}
+
+// sweep descarta os totais das janelas encerradas, no máximo uma vez por hora
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Hour {
+		return
+	}
+	s.lastSweep = now
+
+	for key, c := range s.counters {
+		if now.After(c.expiresAt) {
+			delete(s.counters, key)
+		}
+	}
+}
+
+// redisStore mantém os totais no Redis, compartilhados entre as réplicas do gateway e
+// preservados quando elas reiniciam. As chaves expiram sozinhas depois da janela.
+type redisStore struct {
+	client *redis.Client
+}
+
+// Prefixo das chaves de cotas no Redis
+const redisQuotaPrefix = "gateway:quota:"
+
+// consumeScript incrementa todas as KEYS se cada total estiver abaixo do seu limite,
+// ARGV[2i-1], e na primeira chamada da janela agenda a expiração da chave para ARGV[2i] (Unix
+// em milissegundos). Retorna os totais seguidos de 1 quando a chamada foi aceita.
+var consumeScript = redis.NewScript(`
+local used = {}
+local accepted = 1
+for i, key in ipairs(KEYS) do
+	used[i] = tonumber(redis.call('GET', key) or '0')
+	if used[i] >= tonumber(ARGV[2 * i - 1]) then
+		accepted = 0
+	end
+end
+if accepted == 1 then
+	for i, key in ipairs(KEYS) do
+		used[i] = redis.call('INCR', key)
+		if used[i] == 1 then
+			redis.call('PEXPIREAT', key, ARGV[2 * i])
+		end
+	end
+end
+used[#KEYS + 1] = accepted
+return used
+`)
+
+// NewRedisStore cria um armazenamento de cotas no Redis
+func NewRedisStore(client *redis.Client) Store {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) Consume(ctx context.Context, charges []Charge) ([]int64, bool, error) {
+	keys := make([]string, len(charges))
+	args := make([]interface{}, 0, 2*len(charges))
+	for i, charge := range charges {
+		keys[i] = redisQuotaPrefix + charge.Key
+		args = append(args, charge.Limit, charge.ExpiresAt.UnixMilli())
+	}
+
+	values, err := consumeScript.Run(ctx, s.client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(values) != len(charges)+1 {
+		return nil, false, fmt.Errorf("unexpected quota reply %v", values)
+	}
+	return values[:len(charges)], values[len(charges)] == 1, nil
+}
+
+func (s *redisStore) Usage(ctx context.Context, keys []string) ([]int64, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = redisQuotaPrefix + key
+	}
+	values, err := s.client.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]int64, len(keys))
+	for i, value := range values {
+		if raw, ok := value.(string); ok {
+			usage[i], _ = strconv.ParseInt(raw, 10, 64)
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,213 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var rateLimitRequestsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "gateway_rate_limit_requests_total",
+		Help: "Total de requisições avaliadas pelos limites, por política e resultado (allowed, limited, error)",
+	},
+	[]string{"policy", "result"},
+)
+
+// Algoritmos de limite
+const (
+	AlgorithmTokenBucket   = "tokenBucket"
+	AlgorithmSlidingWindow = "slidingWindow"
+)
+
+// policy é uma política de limite já preparada para avaliação
+type policy struct {
+	name      string
+	paths     []*proxy.PathTemplate
+	methods   map[string]bool
+	key       string
+	header    string // cabeçalho da chave, em key "header:<nome>"
+	algorithm string
+	limit     Limit
+}
+
+// Limiter aplica as políticas de limite de requisições. Cada requisição consome das políticas
+// que cobrem o seu caminho e método, na ordem da configuração, até uma delas se esgotar.
+type Limiter struct {
+	store    Store
+	policies []*policy
+}
+
+// NewLimiter cria o limitador com as políticas de cfg; retorna nil quando desativado
+func NewLimiter(cfg config.RateLimitConfig, store Store) (*Limiter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	l := &Limiter{store: store}
+	for _, pc := range cfg.Policies {
+		p := &policy{
+			name:      pc.Name,
+			key:       pc.Key,
+			algorithm: pc.Algorithm,
+			limit:     Limit{Requests: pc.Requests, Period: pc.Period, Burst: pc.Burst},
+		}
+		if p.key == "" {
+			p.key = "ip"
+		}
+		if header, ok := strings.CutPrefix(p.key, "header:"); ok {
+			p.key, p.header = "header", header
+		}
+		if p.algorithm == "" {
+			p.algorithm = AlgorithmTokenBucket
+		}
+		if p.limit.Period <= 0 {
+			p.limit.Period = time.Minute
+		}
+		if p.limit.Burst <= 0 {
+			p.limit.Burst = p.limit.Requests
+		}
+		for _, raw := range pc.Paths {
+			path, err := proxy.ParsePathTemplate(raw)
+			if err != nil {
+				return nil, fmt.Errorf("rateLimit.policies %s: %w", pc.Name, err)
+			}
+			p.paths = append(p.paths, path)
+		}
+		if len(pc.Methods) > 0 {
+			p.methods = make(map[string]bool, len(pc.Methods))
+			for _, method := range pc.Methods {
+				p.methods[strings.ToUpper(method)] = true
+			}
+		}
+		l.policies = append(l.policies, p)
+	}
+	return l, nil
+}
+
+// Limit retorna o middleware do limitador. Ele deve vir depois da autenticação, para que as
+// políticas por usuário e por chave de API encontrem a identidade; nas rotas públicas essas
+// políticas não se aplicam. Responde com os cabeçalhos RateLimit-* da política mais próxima
+// de se esgotar e, ao recusar, com 429 e Retry-After. Falhas do armazenamento deixam a
+// requisição passar. Sem limitador configurado (l nil) o middleware não faz nada.
+func (l *Limiter) Limit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			c.Next()
+			return
+		}
+
+		var reported *policy
+		var report Result
+		for _, p := range l.policies {
+			if !p.matches(c.Request) {
+				continue
+			}
+			key, ok := p.keyFor(c)
+			if !ok {
+				continue
+			}
+
+			result, err := l.take(c, p, key)
+			if err != nil {
+				rateLimitRequestsTotal.WithLabelValues(p.name, "error").Inc()
+				logrus.WithError(err).WithField("policy", p.name).Warn("Failed to evaluate rate limit")
+				continue
+			}
+
+			if !result.Allowed {
+				rateLimitRequestsTotal.WithLabelValues(p.name, "limited").Inc()
+				setHeaders(c, p, result)
+				retryAfter := max(1, int(math.Ceil(result.RetryAfter.Seconds())))
+				c.Header("Retry-After", strconv.Itoa(retryAfter))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+					"error":      "rate limit exceeded",
+					"code":       "rate_limit_exceeded",
+					"policy":     p.name,
+					"retryAfter": retryAfter,
+				})
+				return
+			}
+
+			rateLimitRequestsTotal.WithLabelValues(p.name, "allowed").Inc()
+			if reported == nil || result.Remaining < report.Remaining {
+				reported, report = p, result
+			}
+		}
+
+		if reported != nil {
+			setHeaders(c, reported, report)
+		}
+		c.Next()
+	}
+}
+
+// take consome a requisição da política na chave informada
+func (l *Limiter) take(c *gin.Context, p *policy, key string) (Result, error) {
+	key = p.name + ":" + key
+	if p.algorithm == AlgorithmSlidingWindow {
+		return l.store.SlidingWindow(c.Request.Context(), key, p.limit)
+	}
+	return l.store.TokenBucket(c.Request.Context(), key, p.limit)
+}
+
+// matches indica se a política cobre o método e o caminho da requisição
+func (p *policy) matches(r *http.Request) bool {
+	if p.methods != nil && !p.methods[r.Method] {
+		return false
+	}
+	if len(p.paths) == 0 {
+		return true
+	}
+	for _, path := range p.paths {
+		if _, ok := path.Match(r.URL.Path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// keyFor retorna a chave da requisição na política; falso quando a requisição não a tem
+// (sem usuário autenticado, sem chave de API ou sem o cabeçalho)
+func (p *policy) keyFor(c *gin.Context) (string, bool) {
+	switch p.key {
+	case "user":
+		if principal, ok := auth.PrincipalFrom(c); ok && principal.UserID != "" {
+			return "user:" + principal.UserID, true
+		}
+	case "apiKey":
+		if principal, ok := auth.PrincipalFrom(c); ok && principal.APIKeyID != "" {
+			return "apikey:" + principal.APIKeyID, true
+		}
+	case "header":
+		// O valor é resumido para que cabeçalhos longos não inflem as chaves do armazenamento
+		if value := c.GetHeader(p.header); value != "" {
+			sum := sha256.Sum256([]byte(value))
+			return "header:" + hex.EncodeToString(sum[:12]), true
+		}
+	default:
+		return "ip:" + c.ClientIP(), true
+	}
+	return "", false
+}
+
+// setHeaders escreve os cabeçalhos RateLimit-* com o estado da política
+func setHeaders(c *gin.Context, p *policy, result Result) {
+	c.Header("RateLimit-Limit", strconv.Itoa(p.limit.Requests))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d;name=%q", p.limit.Requests, int(p.limit.Period.Seconds()), p.name))
+}
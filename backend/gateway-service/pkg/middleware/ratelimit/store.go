@@ -0,0 +1,290 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Limit é o limite de uma chave: Requests por Period, com Burst de capacidade no token bucket
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// Result é a decisão sobre uma requisição e o estado do limite depois dela
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // até o limite estar de novo completo
+	RetryAfter time.Duration // até a próxima requisição ser aceita, quando recusada
+}
+
+// Store guarda o estado dos limites por chave. Cada algoritmo é uma operação atômica do
+// armazenamento, para que réplicas que o compartilham não ultrapassem juntas o limite.
+type Store interface {
+	// TokenBucket consome um token do balde da chave, reabastecido a Requests por Period
+	TokenBucket(ctx context.Context, key string, limit Limit) (Result, error)
+	// SlidingWindow conta a requisição na janela deslizante de Period da chave
+	SlidingWindow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// NewStore cria o armazenamento de limites configurado. O cliente Redis só é usado com
+// store "redis".
+func NewStore(cfg config.RateLimitConfig, client *redis.Client) Store {
+	if cfg.Store == "redis" {
+		return NewRedisStore(client)
+	}
+	return NewMemoryStore()
+}
+
+// memoryStore mantém os limites na memória do processo; serve para uma única réplica
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	windows   map[string]*window
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	last      time.Time
+	expiresAt time.Time // quando o balde estará cheio de novo e pode ser descartado
+}
+
+type window struct {
+	start    time.Time // início da janela fixa atual
+	current  int
+	previous int
+	period   time.Duration
+}
+
+// NewMemoryStore cria um armazenamento de limites em memória
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets: make(map[string]*bucket),
+		windows: make(map[string]*window),
+		now:     time.Now,
+	}
+}
+
+func (s *memoryStore) TokenBucket(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	capacity, rate := float64(limit.Burst), refillRate(limit)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	result := bucketResult(allowed, b.tokens, limit)
+	b.expiresAt = now.Add(result.Reset)
+	return result, nil
+}
+
+func (s *memoryStore) SlidingWindow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	start := now.Truncate(limit.Period)
+	w, ok := s.windows[key]
+	if !ok {
+		w = &window{start: start, period: limit.Period}
+		s.windows[key] = w
+	}
+	switch passed := start.Sub(w.start); {
+	case passed == limit.Period:
+		w.previous, w.current = w.current, 0
+	case passed > limit.Period:
+		w.previous, w.current = 0, 0
+	}
+	w.start = start
+
+	result := windowResult(w.previous, w.current, limit, now.Sub(start))
+	if result.Allowed {
+		w.current++
+	}
+	return result, nil
+}
+
+// sweep descarta os baldes cheios e as janelas encerradas, no máximo uma vez por minuto
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.After(b.expiresAt) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, w := range s.windows {
+		if now.Sub(w.start) >= 2*w.period {
+			delete(s.windows, key)
+		}
+	}
+}
+
+// redisStore mantém os limites no Redis, compartilhados entre as réplicas do gateway. Cada
+// decisão é um script Lua, executado atomicamente; as chaves expiram sozinhas.
+type redisStore struct {
+	client *redis.Client
+}
+
+// Prefixo das chaves de limites no Redis
+const redisRateLimitPrefix = "gateway:ratelimit:"
+
+// tokenBucketScript reabastece e consome o balde em KEYS[1]. ARGV: capacidade, tokens por
+// milissegundo e o instante atual em milissegundos. Retorna se a requisição foi aceita e os
+// tokens restantes (como texto, porque o Redis trunca os números do Lua).
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or capacity
+local last = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - last) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript conta a requisição na janela fixa atual (KEYS[1]) se a estimativa da
+// janela deslizante, com a anterior (KEYS[2]) ponderada por ARGV[2], couber no limite ARGV[1].
+// ARGV[3] é a validade da chave em milissegundos. Retorna as contagens anteriores à requisição.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+if previous * weight + current + 1 <= limit then
+	redis.call('INCR', KEYS[1])
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return {previous, current}
+`)
+
+// NewRedisStore cria um armazenamento de limites no Redis
+func NewRedisStore(client *redis.Client) Store {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) TokenBucket(ctx context.Context, key string, limit Limit) (Result, error) {
+	values, err := tokenBucketScript.Run(ctx, s.client, []string{redisRateLimitPrefix + "tb:" + key},
+		limit.Burst, strconv.FormatFloat(refillRate(limit)/1000, 'g', -1, 64), time.Now().UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 2 {
+		return Result{}, fmt.Errorf("unexpected token bucket reply %v", values)
+	}
+
+	allowed, _ := values[0].(int64)
+	raw, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("unexpected token bucket reply %v", values)
+	}
+	return bucketResult(allowed == 1, tokens, limit), nil
+}
+
+func (s *redisStore) SlidingWindow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	start := now.Truncate(limit.Period)
+	elapsed := now.Sub(start)
+	keys := []string{
+		redisRateLimitPrefix + "sw:" + key + ":" + strconv.FormatInt(start.UnixMilli(), 10),
+		redisRateLimitPrefix + "sw:" + key + ":" + strconv.FormatInt(start.Add(-limit.Period).UnixMilli(), 10),
+	}
+	values, err := slidingWindowScript.Run(ctx, s.client, keys,
+		limit.Requests, strconv.FormatFloat(windowWeight(limit, elapsed), 'g', -1, 64), (2 * limit.Period).Milliseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 2 {
+		return Result{}, fmt.Errorf("unexpected sliding window reply %v", values)
+	}
+	return windowResult(int(values[0]), int(values[1]), limit, elapsed), nil
+}
+
+// refillRate é a taxa de reabastecimento do balde, em tokens por segundo
+func refillRate(limit Limit) float64 {
+	return float64(limit.Requests) / limit.Period.Seconds()
+}
+
+// bucketResult monta o resultado do token bucket a partir dos tokens que sobraram no balde
+func bucketResult(allowed bool, tokens float64, limit Limit) Result {
+	rate := refillRate(limit)
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     seconds((float64(limit.Burst) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return result
+}
+
+// windowWeight é a parte da janela fixa anterior que ainda está na janela deslizante
+func windowWeight(limit Limit, elapsed time.Duration) float64 {
+	return 1 - elapsed.Seconds()/limit.Period.Seconds()
+}
+
+// windowResult estima as requisições na janela deslizante a partir das contagens da janela
+// fixa anterior e da atual, antes da requisição, e decide se ela cabe no limite. elapsed é
+// o tempo decorrido da janela fixa atual.
+func windowResult(previous, current int, limit Limit, elapsed time.Duration) Result {
+	count := float64(previous)*windowWeight(limit, elapsed) + float64(current)
+
+	result := Result{Reset: limit.Period - elapsed}
+	if previous > 0 {
+		result.Reset += limit.Period
+	}
+	if count+1 <= float64(limit.Requests) {
+		result.Allowed = true
+		result.Remaining = max(0, limit.Requests-int(math.Ceil(count))-1)
+		return result
+	}
+
+	// A estimativa cai conforme a janela anterior sai da janela deslizante; se só a atual já
+	// esgota o limite, é preciso esperar a próxima janela
+	result.RetryAfter = limit.Period - elapsed
+	if previous > 0 && current+1 <= limit.Requests {
+		excess := count + 1 - float64(limit.Requests)
+		result.RetryAfter = seconds(excess / float64(previous) * limit.Period.Seconds())
+	}
+	return result
+}
+
+// seconds converte segundos fracionários em duração
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
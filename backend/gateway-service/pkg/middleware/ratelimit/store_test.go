@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testClock é um relógio controlado pelos testes
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestStore() (*memoryStore, *testClock) {
+	clock := &testClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore().(*memoryStore)
+	s.now = clock.Now
+	return s, clock
+}
+
+func TestWindowResult(t *testing.T) {
+	limit := Limit{Requests: 10, Period: time.Minute}
+	tests := []struct {
+		name              string
+		previous, current int
+		elapsed           time.Duration
+		want              Result
+	}{
+		{name: "empty window", elapsed: 0, want: Result{Allowed: true, Remaining: 9, Reset: time.Minute}},
+		{name: "last request of the window", current: 9, elapsed: 30 * time.Second,
+			want: Result{Allowed: true, Remaining: 0, Reset: 30 * time.Second}},
+		{name: "current window exhausted", current: 10, elapsed: 30 * time.Second,
+			want: Result{Reset: 30 * time.Second, RetryAfter: 30 * time.Second}},
+		{name: "previous window weighted", previous: 10, elapsed: 15 * time.Second,
+			want: Result{Allowed: true, Remaining: 1, Reset: 105 * time.Second}},
+		{name: "previous window still counts", previous: 10, current: 2, elapsed: 15 * time.Second,
+			want: Result{Reset: 105 * time.Second, RetryAfter: 3 * time.Second}},
+		{name: "both windows exhausted", previous: 10, current: 10, elapsed: 15 * time.Second,
+			want: Result{Reset: 105 * time.Second, RetryAfter: 45 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := windowResult(tt.previous, tt.current, limit, tt.elapsed); got != tt.want {
+				t.Errorf("windowResult(%d, %d, %s) = %+v, want %+v", tt.previous, tt.current, tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBucketResult(t *testing.T) {
+	limit := Limit{Requests: 60, Period: time.Minute, Burst: 5}
+	tests := []struct {
+		allowed bool
+		tokens  float64
+		want    Result
+	}{
+		{allowed: true, tokens: 4, want: Result{Allowed: true, Remaining: 4, Reset: time.Second}},
+		{allowed: true, tokens: 0.5, want: Result{Allowed: true, Remaining: 0, Reset: 4500 * time.Millisecond}},
+		{allowed: false, tokens: 0.25, want: Result{Remaining: 0, Reset: 4750 * time.Millisecond, RetryAfter: 750 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		if got := bucketResult(tt.allowed, tt.tokens, limit); got != tt.want {
+			t.Errorf("bucketResult(%v, %v) = %+v, want %+v", tt.allowed, tt.tokens, got, tt.want)
+		}
+	}
+}
+
+func TestMemorySlidingWindow(t *testing.T) {
+	s, clock := newTestStore()
+	ctx := context.Background()
+	limit := Limit{Requests: 10, Period: time.Minute}
+
+	for i := 0; i < 10; i++ {
+		result, _ := s.SlidingWindow(ctx, "k", limit)
+		if !result.Allowed || result.Remaining != 9-i {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i+1, result, 9-i)
+		}
+	}
+	if result, _ := s.SlidingWindow(ctx, "k", limit); result.Allowed || result.RetryAfter != time.Minute {
+		t.Fatalf("request over the limit = %+v, want denied until the next window", result)
+	}
+	if result, _ := s.SlidingWindow(ctx, "other", limit); !result.Allowed {
+		t.Errorf("another key = %+v, want allowed", result)
+	}
+
+	// Na janela seguinte as 10 requisições anteriores ainda pesam 75%
+	clock.Advance(75 * time.Second)
+	for i := 0; i < 2; i++ {
+		if result, _ := s.SlidingWindow(ctx, "k", limit); !result.Allowed {
+			t.Fatalf("request %d after rollover = %+v, want allowed", i+1, result)
+		}
+	}
+	result, _ := s.SlidingWindow(ctx, "k", limit)
+	if result.Allowed || result.RetryAfter != 3*time.Second {
+		t.Fatalf("request over the weighted limit = %+v, want denied for 3s", result)
+	}
+	clock.Advance(3 * time.Second)
+	if result, _ := s.SlidingWindow(ctx, "k", limit); !result.Allowed {
+		t.Errorf("request after Retry-After = %+v, want allowed", result)
+	}
+
+	// Depois de duas janelas sem requisições nada da contagem anterior sobra
+	clock.Advance(2 * time.Minute)
+	if result, _ := s.SlidingWindow(ctx, "k", limit); !result.Allowed || result.Remaining != 9 {
+		t.Errorf("request after idle windows = %+v, want allowed with 9 remaining", result)
+	}
+}
+
+func TestMemoryTokenBucket(t *testing.T) {
+	s, clock := newTestStore()
+	ctx := context.Background()
+	limit := Limit{Requests: 60, Period: time.Minute, Burst: 5}
+
+	for i := 0; i < 5; i++ {
+		result, _ := s.TokenBucket(ctx, "k", limit)
+		if !result.Allowed || result.Remaining != 4-i {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i+1, result, 4-i)
+		}
+	}
+	result, _ := s.TokenBucket(ctx, "k", limit)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 5*time.Second {
+		t.Fatalf("request over the burst = %+v, want denied for 1s", result)
+	}
+
+	// Um token por segundo volta ao balde
+	clock.Advance(2500 * time.Millisecond)
+	result, _ = s.TokenBucket(ctx, "k", limit)
+	if !result.Allowed || result.Remaining != 1 || result.Reset != 3500*time.Millisecond {
+		t.Fatalf("request after refill = %+v, want allowed with 1 remaining", result)
+	}
+
+	// O balde nunca passa da capacidade
+	clock.Advance(time.Hour)
+	result, _ = s.TokenBucket(ctx, "k", limit)
+	if !result.Allowed || result.Remaining != 4 {
+		t.Errorf("request after a long idle period = %+v, want allowed with 4 remaining", result)
+	}
+}
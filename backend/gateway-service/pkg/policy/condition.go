@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// conditionPattern separa uma condição em "operando operador operando"
+var conditionPattern = regexp.MustCompile(`^\s*(\S+)\s+(==|!=|not in|in|contains)\s+(.+?)\s*$`)
+
+// namespaces são os prefixos aceitos nas referências a atributos
+var namespaces = map[string][]string{
+	"principal": {"id", "sub", "username", "email", "issuer", "tokenId", "roles", "scopes", "authMethod", "apiKeyId", "clientId", "actorId"},
+	"request":   {"method", "path"},
+	"param":     nil,
+	"query":     nil,
+	"header":    nil,
+	"resource":  nil,
+}
+
+// condition é uma comparação entre um atributo da requisição e outro atributo ou um
+// literal JSON, como `resource.userId == principal.id` ou `request.method in ["GET"]`
+type condition struct {
+	raw   string
+	left  operand
+	op    string
+	right operand
+}
+
+// operand é uma referência a atributo ou um valor literal
+type operand struct {
+	attr    string
+	literal interface{}
+}
+
+// parseCondition interpreta uma condição das políticas
+func parseCondition(raw string) (*condition, error) {
+	match := conditionPattern.FindStringSubmatch(raw)
+	if match == nil {
+		return nil, fmt.Errorf("invalid condition %q, expected \"<attribute> <operator> <value>\"", raw)
+	}
+
+	left, err := parseOperand(match[1])
+	if err != nil {
+		return nil, fmt.Errorf("condition %q: %w", raw, err)
+	}
+	right, err := parseOperand(match[3])
+	if err != nil {
+		return nil, fmt.Errorf("condition %q: %w", raw, err)
+	}
+	return &condition{raw: raw, left: left, op: match[2], right: right}, nil
+}
+
+// parseOperand reconhece literais JSON (strings entre aspas, números, listas, true, false
+// e null); qualquer outro valor é uma referência a atributo
+func parseOperand(raw string) (operand, error) {
+	switch {
+	case raw == "true" || raw == "false" || raw == "null" || strings.ContainsRune(`"[-0123456789`, rune(raw[0])):
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			return operand{}, fmt.Errorf("invalid literal %s: %w", raw, err)
+		}
+		return operand{literal: value}, nil
+	}
+
+	namespace, name, ok := strings.Cut(raw, ".")
+	names, known := namespaces[namespace]
+	if !ok || !known || name == "" {
+		return operand{}, fmt.Errorf("unknown attribute %q", raw)
+	}
+	if names != nil && !contains(names, name) {
+		return operand{}, fmt.Errorf("unknown attribute %q, expected one of %s.%v", raw, namespace, names)
+	}
+	return operand{attr: raw}, nil
+}
+
+// attributes retorna os atributos referenciados pela condição
+func (c *condition) attributes() []string {
+	var attrs []string
+	for _, o := range []operand{c.left, c.right} {
+		if o.attr != "" {
+			attrs = append(attrs, o.attr)
+		}
+	}
+	return attrs
+}
+
+// usesResource indica se a condição depende dos atributos do recurso
+func (c *condition) usesResource() bool {
+	for _, attr := range c.attributes() {
+		if strings.HasPrefix(attr, "resource.") {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate compara os operandos já resolvidos. Atributos ausentes nunca são iguais a nada.
+func (c *condition) evaluate(left, right interface{}) bool {
+	switch c.op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	case "in":
+		return member(right, left)
+	case "not in":
+		return !member(right, left)
+	case "contains":
+		return member(left, right)
+	}
+	return false
+}
+
+// equal compara dois valores escalares pela sua representação textual, de modo que o ID
+// numérico de um recurso seja igual ao mesmo ID em uma claim do token
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	sa, ok := scalar(a)
+	if !ok {
+		return false
+	}
+	sb, ok := scalar(b)
+	return ok && sa == sb
+}
+
+// member indica se value é um dos elementos da lista
+func member(list, value interface{}) bool {
+	var items []interface{}
+	switch l := list.(type) {
+	case []interface{}:
+		items = l
+	case []string:
+		for _, item := range l {
+			items = append(items, item)
+		}
+	default:
+		return false
+	}
+
+	for _, item := range items {
+		if equal(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// scalar converte strings, números e booleanos para texto
+func scalar(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,80 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		raw     string
+		left    operand
+		op      string
+		right   operand
+		wantErr bool
+	}{
+		{raw: "resource.userId == principal.id", left: operand{attr: "resource.userId"}, op: "==", right: operand{attr: "principal.id"}},
+		{raw: "  request.method   !=   \"DELETE\"  ", left: operand{attr: "request.method"}, op: "!=", right: operand{literal: "DELETE"}},
+		{raw: `request.method in ["GET", "HEAD"]`, left: operand{attr: "request.method"}, op: "in", right: operand{literal: []interface{}{"GET", "HEAD"}}},
+		{raw: `principal.authMethod not in ["impersonation"]`, left: operand{attr: "principal.authMethod"}, op: "not in", right: operand{literal: []interface{}{"impersonation"}}},
+		{raw: `principal.roles contains "admin"`, left: operand{attr: "principal.roles"}, op: "contains", right: operand{literal: "admin"}},
+		{raw: "resource.customer.id == 42", left: operand{attr: "resource.customer.id"}, op: "==", right: operand{literal: float64(42)}},
+		{raw: "resource.archived == false", left: operand{attr: "resource.archived"}, op: "==", right: operand{literal: false}},
+		{raw: "header.X-Tenant == param.tenant", left: operand{attr: "header.X-Tenant"}, op: "==", right: operand{attr: "param.tenant"}},
+		{raw: "resource.userId", wantErr: true},
+		{raw: "resource.userId > 1", wantErr: true},
+		{raw: "owner == principal.id", wantErr: true},
+		{raw: "principal.password == \"x\"", wantErr: true},
+		{raw: "resource. == principal.id", wantErr: true},
+		{raw: `request.method in ["GET"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			cond, err := parseCondition(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCondition(%q) succeeded, want error", tt.raw)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCondition(%q): %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(cond.left, tt.left) || cond.op != tt.op || !reflect.DeepEqual(cond.right, tt.right) {
+				t.Errorf("parseCondition(%q) = %+v %q %+v, want %+v %q %+v", tt.raw, cond.left, cond.op, cond.right, tt.left, tt.op, tt.right)
+			}
+		})
+	}
+}
+
+func TestConditionEvaluate(t *testing.T) {
+	tests := []struct {
+		op          string
+		left, right interface{}
+		want        bool
+	}{
+		{op: "==", left: "42", right: float64(42), want: true},
+		{op: "==", left: "u1", right: "u2", want: false},
+		{op: "==", left: true, right: "true", want: true},
+		{op: "==", left: nil, right: nil, want: false},
+		{op: "==", left: nil, right: "u1", want: false},
+		{op: "==", left: []interface{}{"a"}, right: []interface{}{"a"}, want: false},
+		{op: "!=", left: "u1", right: "u2", want: true},
+		{op: "!=", left: nil, right: "u1", want: true},
+		{op: "in", left: "GET", right: []interface{}{"GET", "HEAD"}, want: true},
+		{op: "in", left: "POST", right: []interface{}{"GET", "HEAD"}, want: false},
+		{op: "in", left: "GET", right: "GET", want: false},
+		{op: "not in", left: "POST", right: []interface{}{"GET"}, want: true},
+		{op: "not in", left: "GET", right: []interface{}{"GET"}, want: false},
+		{op: "contains", left: []string{"customer", "admin"}, right: "admin", want: true},
+		{op: "contains", left: []string{"customer"}, right: "admin", want: false},
+		{op: "contains", left: nil, right: "admin", want: false},
+		{op: "contains", left: []interface{}{float64(7)}, right: "7", want: true},
+	}
+	for _, tt := range tests {
+		cond := &condition{op: tt.op}
+		if got := cond.evaluate(tt.left, tt.right); got != tt.want {
+			t.Errorf("%v %s %v = %v, want %v", tt.left, tt.op, tt.right, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var policyDecisionsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "gateway_policy_decisions_total",
+		Help: "Total de decisões das políticas de acesso por rota e resultado",
+	},
+	[]string{"route", "decision"},
+)
+
+// Enforcer aplica as políticas às requisições, buscando nos serviços os atributos dos
+// recursos quando as políticas dependem deles
+type Enforcer struct {
+	store     *Store
+	upstreams proxy.Upstreams
+	identity  *auth.IdentitySigner
+}
+
+// NewEnforcer cria o aplicador das políticas de store. As buscas de recursos levam a
+// identidade do usuário assinada por identity.
+func NewEnforcer(store *Store, upstreams proxy.Upstreams, identity *auth.IdentitySigner) *Enforcer {
+	return &Enforcer{store: store, upstreams: upstreams, identity: identity}
+}
+
+// Enforce retorna um middleware que nega as requisições recusadas pelas políticas.
+// Deve vir depois da autenticação para que as políticas vejam o usuário.
+func (e *Enforcer) Enforce() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		in := &Input{
+			Method: c.Request.Method,
+			Path:   c.Request.URL.Path,
+			Query:  c.Request.URL.Query(),
+			Header: c.Request.Header,
+		}
+		in.Principal, _ = auth.PrincipalFrom(c)
+
+		loader := &upstreamLoader{upstreams: e.upstreams, identity: e.identity, request: c.Request, principal: in.Principal}
+		decision, err := e.store.Policies().Evaluate(c.Request.Context(), in, loader, false)
+		if err != nil {
+			e.abort(c, err)
+			return
+		}
+
+		if !decision.Applicable {
+			policyDecisionsTotal.WithLabelValues(c.FullPath(), "not_applicable").Inc()
+			c.Next()
+			return
+		}
+		if !decision.Allowed {
+			policyDecisionsTotal.WithLabelValues(c.FullPath(), "deny").Inc()
+			fields := logrus.Fields{"route": c.FullPath(), "method": in.Method, "reason": decision.Reason}
+			if in.Principal != nil {
+				fields["user_id"] = in.Principal.UserID
+			}
+			logrus.WithFields(fields).Warn("Access denied by policy")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "access denied by policy"})
+			return
+		}
+
+		policyDecisionsTotal.WithLabelValues(c.FullPath(), "allow").Inc()
+		c.Next()
+	}
+}
+
+// abort responde quando não foi possível avaliar as políticas; na dúvida o acesso é negado
+func (e *Enforcer) abort(c *gin.Context, err error) {
+	policyDecisionsTotal.WithLabelValues(c.FullPath(), "error").Inc()
+
+	if errors.Is(err, ErrResourceNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+		return
+	}
+
+	logrus.WithError(err).WithField("route", c.FullPath()).Error("Failed to evaluate access policies")
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "access policies could not be evaluated"})
+}
+
+// upstreamLoader busca os atributos dos recursos nos serviços, em nome do usuário da requisição
+type upstreamLoader struct {
+	upstreams proxy.Upstreams
+	identity  *auth.IdentitySigner
+	request   *http.Request
+	principal *auth.Principal
+}
+
+func (l *upstreamLoader) Load(ctx context.Context, service, path string) (map[string]interface{}, error) {
+	upstream, ok := l.upstreams[service]
+	if !ok {
+		return nil, fmt.Errorf("unknown service %q", service)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+upstream.Name()+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if authorization := l.request.Header.Get("Authorization"); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	if err := l.identity.Apply(req, l.principal, upstream.Name()); err != nil {
+		return nil, err
+	}
+
+	resp, err := upstream.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrResourceNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("load %s%s: status %d", service, path, resp.StatusCode)
+	}
+
+	var attrs map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&attrs); err != nil {
+		return nil, fmt.Errorf("decode %s%s: %w", service, path, err)
+	}
+	return attrs, nil
+}
+
+// StaticResource retorna um ResourceLoader que devolve sempre os mesmos atributos,
+// usado para simular decisões sem consultar os serviços
+func StaticResource(attrs map[string]interface{}) ResourceLoader {
+	if attrs == nil {
+		return nil
+	}
+	return staticLoader(attrs)
+}
+
+type staticLoader map[string]interface{}
+
+func (l staticLoader) Load(ctx context.Context, service, path string) (map[string]interface{}, error) {
+	return l, nil
+}
@@ -0,0 +1,287 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// Erros na obtenção dos atributos do recurso
+var (
+	ErrResourceNotFound    = errors.New("resource not found")
+	ErrResourceNotProvided = errors.New("resource attributes were not provided")
+)
+
+// Input reúne os atributos de uma requisição avaliados pelas políticas
+type Input struct {
+	Principal *auth.Principal // nil em requisições anônimas
+	Method    string
+	Path      string
+	Query     url.Values
+	Header    http.Header
+}
+
+// ResourceLoader busca os atributos de um recurso no serviço dono dele
+type ResourceLoader interface {
+	Load(ctx context.Context, service, path string) (map[string]interface{}, error)
+}
+
+// Decision é o resultado da avaliação das políticas, com a explicação de cada uma
+type Decision struct {
+	Allowed bool `json:"allowed"`
+	// Applicable indica se alguma política cobre o caminho e o método; sem políticas
+	// aplicáveis a requisição segue para o serviço, que continua responsável pelo acesso
+	Applicable bool           `json:"applicable"`
+	Reason     string         `json:"reason"`
+	Policies   []PolicyResult `json:"policies,omitempty"`
+}
+
+// PolicyResult explica a avaliação de uma política que cobre a requisição
+type PolicyResult struct {
+	Name       string            `json:"name"`
+	Source     string            `json:"source"`
+	Effect     Effect            `json:"effect"`
+	Applies    bool              `json:"applies"`
+	Reason     string            `json:"reason,omitempty"`
+	Resource   string            `json:"resource,omitempty"`
+	Conditions []ConditionResult `json:"conditions,omitempty"`
+}
+
+// ConditionResult explica a avaliação de uma condição
+type ConditionResult struct {
+	Condition string      `json:"condition"`
+	Result    bool        `json:"result"`
+	Left      interface{} `json:"left"`
+	Right     interface{} `json:"right"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// Evaluate decide o acesso de uma requisição. Políticas deny prevalecem sobre allow e,
+// quando alguma política cobre a requisição, o acesso só é liberado se uma política allow
+// se aplicar. Com explain, falhas ao buscar o recurso são registradas na explicação em vez
+// de interromper a avaliação.
+func (s *Set) Evaluate(ctx context.Context, in *Input, loader ResourceLoader, explain bool) (*Decision, error) {
+	decision := &Decision{}
+	resources := make(map[string]map[string]interface{})
+	var allowedBy, deniedBy string
+
+	for _, p := range s.policies {
+		params, ok := p.match(in)
+		if !ok {
+			continue
+		}
+		decision.Applicable = true
+
+		result := PolicyResult{Name: p.Name, Source: p.source, Effect: p.Effect}
+		applies, err := p.evaluate(ctx, in, params, loader, resources, &result, explain)
+		if err != nil {
+			return nil, err
+		}
+		result.Applies = applies
+		decision.Policies = append(decision.Policies, result)
+
+		switch {
+		case applies && p.Effect == Deny && deniedBy == "":
+			deniedBy = p.Name
+		case applies && p.Effect == Allow && allowedBy == "":
+			allowedBy = p.Name
+		}
+	}
+
+	switch {
+	case !decision.Applicable:
+		decision.Allowed = true
+		decision.Reason = "no policy covers the request"
+	case deniedBy != "":
+		decision.Reason = "denied by policy " + deniedBy
+	case allowedBy != "":
+		decision.Allowed = true
+		decision.Reason = "allowed by policy " + allowedBy
+	default:
+		decision.Reason = "no policy allows the request"
+	}
+	return decision, nil
+}
+
+// match indica se a política cobre o método e o caminho, retornando os parâmetros do caminho
+func (p *policy) match(in *Input) (gin.Params, bool) {
+	if len(p.Methods) > 0 && !contains(p.Methods, in.Method) {
+		return nil, false
+	}
+	for _, path := range p.paths {
+		if params, ok := path.Match(in.Path); ok {
+			return params, true
+		}
+	}
+	return nil, false
+}
+
+// evaluate verifica os papéis e as condições da política. O recurso só é buscado se os
+// papéis conferem e alguma condição depende dele, uma única vez por requisição.
+func (p *policy) evaluate(ctx context.Context, in *Input, params gin.Params, loader ResourceLoader,
+	resources map[string]map[string]interface{}, result *PolicyResult, explain bool) (bool, error) {
+
+	if len(p.Roles) > 0 && !hasAnyRole(in.Principal, p.Roles) {
+		result.Reason = "principal has none of the roles " + strings.Join(p.Roles, ", ")
+		return false, nil
+	}
+
+	var resource map[string]interface{}
+	var resourceErr error
+	if p.resource != nil {
+		path, err := p.resource.Expand(params)
+		if err != nil {
+			return false, err
+		}
+		result.Resource = p.Resource.Service + path
+
+		key := p.Resource.Service + " " + path
+		if cached, ok := resources[key]; ok {
+			resource = cached
+		} else if p.needsResource() {
+			if loader == nil {
+				resourceErr = ErrResourceNotProvided
+			} else {
+				resource, resourceErr = loader.Load(ctx, p.Resource.Service, path)
+			}
+			if resourceErr != nil && !explain {
+				return false, resourceErr
+			}
+			if resourceErr == nil {
+				resources[key] = resource
+			}
+		}
+	}
+
+	applies := true
+	for _, cond := range p.conditions {
+		cr := ConditionResult{Condition: cond.raw}
+		if cond.usesResource() && resourceErr != nil {
+			cr.Error = resourceErr.Error()
+		} else {
+			cr.Left = resolve(cond.left, in, params, resource)
+			cr.Right = resolve(cond.right, in, params, resource)
+			cr.Result = cond.evaluate(cr.Left, cr.Right)
+		}
+		result.Conditions = append(result.Conditions, cr)
+
+		if !cr.Result {
+			applies = false
+			if !explain {
+				break
+			}
+		}
+	}
+	if !applies {
+		result.Reason = "conditions not met"
+	}
+	return applies, nil
+}
+
+// needsResource indica se alguma condição usa os atributos do recurso
+func (p *policy) needsResource() bool {
+	for _, cond := range p.conditions {
+		if cond.usesResource() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyRole indica se o usuário tem algum dos papéis, sem distinção de maiúsculas
+func hasAnyRole(principal *auth.Principal, roles []string) bool {
+	if principal == nil {
+		return false
+	}
+	for _, role := range principal.Roles {
+		for _, required := range roles {
+			if strings.EqualFold(role, required) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolve retorna o valor de um operando para a requisição
+func resolve(o operand, in *Input, params gin.Params, resource map[string]interface{}) interface{} {
+	if o.attr == "" {
+		return o.literal
+	}
+
+	namespace, name, _ := strings.Cut(o.attr, ".")
+	switch namespace {
+	case "principal":
+		return principalAttribute(in.Principal, name)
+	case "request":
+		if name == "method" {
+			return in.Method
+		}
+		return in.Path
+	case "param":
+		if value, ok := params.Get(name); ok {
+			return value
+		}
+	case "query":
+		if values, ok := in.Query[name]; ok && len(values) > 0 {
+			return values[0]
+		}
+	case "header":
+		if values := in.Header.Values(name); len(values) > 0 {
+			return values[0]
+		}
+	case "resource":
+		return lookup(resource, name)
+	}
+	return nil
+}
+
+// principalAttribute retorna um atributo do usuário autenticado
+func principalAttribute(p *auth.Principal, name string) interface{} {
+	if p == nil {
+		return nil
+	}
+	switch name {
+	case "id", "sub":
+		return p.UserID
+	case "username":
+		return p.Username
+	case "email":
+		return p.Email
+	case "issuer":
+		return p.Issuer
+	case "tokenId":
+		return p.TokenID
+	case "roles":
+		return p.Roles
+	case "scopes":
+		return p.Scopes
+	case "authMethod":
+		return p.AuthMethod
+	case "apiKeyId":
+		return p.APIKeyID
+	case "clientId":
+		return p.ClientID
+	case "actorId":
+		return p.ActorID
+	}
+	return nil
+}
+
+// lookup percorre os atributos do recurso por um caminho com pontos ("customer.id")
+func lookup(attrs map[string]interface{}, path string) interface{} {
+	var value interface{} = attrs
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// testLoader devolve os atributos por serviço e caminho e conta as buscas
+type testLoader struct {
+	resources map[string]map[string]interface{}
+	loads     int
+}
+
+func (l *testLoader) Load(ctx context.Context, service, path string) (map[string]interface{}, error) {
+	l.loads++
+	resource, ok := l.resources[service+path]
+	if !ok {
+		return nil, ErrResourceNotFound
+	}
+	return resource, nil
+}
+
+func newTestSet(t *testing.T, rules ...Rule) *Set {
+	t.Helper()
+	set := &Set{}
+	for _, rule := range rules {
+		p, err := compile(rule, "test.yaml")
+		if err != nil {
+			t.Fatalf("compile(%s): %v", rule.Name, err)
+		}
+		set.policies = append(set.policies, p)
+	}
+	return set
+}
+
+func testInput(method, path string, principal *auth.Principal) *Input {
+	return &Input{Principal: principal, Method: method, Path: path, Query: url.Values{}, Header: http.Header{}}
+}
+
+func TestSetEvaluate(t *testing.T) {
+	set := newTestSet(t,
+		Rule{Name: "own-orders", Paths: []string{"/api/orders/:id"}, Methods: []string{"GET"},
+			Resource: &ResourceRef{Service: "order", Path: "/orders/:id"}, When: []string{"resource.userId == principal.id"}},
+		Rule{Name: "support-orders", Paths: []string{"/api/orders/:id"}, Roles: []string{"support"}},
+		Rule{Name: "no-impersonated-cancel", Effect: Deny, Paths: []string{"/api/orders/:id", "/api/orders/:id/cancel"},
+			When: []string{`principal.authMethod == "impersonation"`}},
+	)
+	loader := &testLoader{resources: map[string]map[string]interface{}{
+		"order/orders/1": {"userId": float64(7)},
+		"order/orders/2": {"userId": "8"},
+	}}
+
+	owner := &auth.Principal{UserID: "7", AuthMethod: auth.AuthMethodJWT}
+	support := &auth.Principal{UserID: "99", Roles: []string{"Support"}, AuthMethod: auth.AuthMethodJWT}
+	impersonated := &auth.Principal{UserID: "7", ActorID: "99", Roles: []string{"support"}, AuthMethod: auth.AuthMethodImpersonation}
+
+	tests := []struct {
+		name       string
+		in         *Input
+		allowed    bool
+		applicable bool
+		reason     string
+	}{
+		{name: "owner", in: testInput("GET", "/api/orders/1", owner), allowed: true, applicable: true, reason: "allowed by policy own-orders"},
+		{name: "other user's order", in: testInput("GET", "/api/orders/2", owner), applicable: true, reason: "no policy allows the request"},
+		{name: "role match is case insensitive", in: testInput("GET", "/api/orders/2", support), allowed: true, applicable: true,
+			reason: "allowed by policy support-orders"},
+		{name: "deny prevails over allow", in: testInput("GET", "/api/orders/1", impersonated), applicable: true,
+			reason: "denied by policy no-impersonated-cancel"},
+		{name: "anonymous", in: testInput("GET", "/api/orders/1", nil), applicable: true, reason: "no policy allows the request"},
+		{name: "not applicable", in: testInput("GET", "/api/products/1", owner), allowed: true, reason: "no policy covers the request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := set.Evaluate(context.Background(), tt.in, loader, false)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if decision.Allowed != tt.allowed || decision.Applicable != tt.applicable || decision.Reason != tt.reason {
+				t.Errorf("Evaluate() = allowed %v, applicable %v, %q; want %v, %v, %q",
+					decision.Allowed, decision.Applicable, decision.Reason, tt.allowed, tt.applicable, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSetEvaluateLoadsResourceOnce(t *testing.T) {
+	set := newTestSet(t,
+		Rule{Name: "owner", Paths: []string{"/api/orders/:id"}, Resource: &ResourceRef{Service: "order", Path: "/orders/:id"},
+			When: []string{"resource.userId == principal.id"}},
+		Rule{Name: "not-archived", Effect: Deny, Paths: []string{"/api/orders/:id"}, Resource: &ResourceRef{Service: "order", Path: "/orders/:id"},
+			When: []string{"resource.archived == true"}},
+		Rule{Name: "admins", Paths: []string{"/api/orders/:id"}, Roles: []string{"admin"}, Resource: &ResourceRef{Service: "order", Path: "/orders/:id"},
+			When: []string{`resource.status != "deleted"`}},
+	)
+	loader := &testLoader{resources: map[string]map[string]interface{}{"order/orders/1": {"userId": "7", "archived": false}}}
+
+	decision, err := set.Evaluate(context.Background(), testInput("GET", "/api/orders/1", &auth.Principal{UserID: "7"}), loader, false)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if !decision.Allowed {
+		t.Errorf("Evaluate() denied: %s", decision.Reason)
+	}
+	// A política de administradores não confere os papéis e não precisa do recurso
+	if loader.loads != 1 {
+		t.Errorf("resource loaded %d times, want 1", loader.loads)
+	}
+}
+
+func TestSetEvaluateMissingResource(t *testing.T) {
+	set := newTestSet(t, Rule{Name: "owner", Paths: []string{"/api/orders/:id"}, Resource: &ResourceRef{Service: "order", Path: "/orders/:id"},
+		When: []string{"resource.userId == principal.id"}})
+	in := testInput("GET", "/api/orders/404", &auth.Principal{UserID: "7"})
+	ctx := context.Background()
+
+	if _, err := set.Evaluate(ctx, in, &testLoader{}, false); !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("Evaluate() error = %v, want %v", err, ErrResourceNotFound)
+	}
+	if _, err := set.Evaluate(ctx, in, nil, false); !errors.Is(err, ErrResourceNotProvided) {
+		t.Errorf("Evaluate() without loader error = %v, want %v", err, ErrResourceNotProvided)
+	}
+
+	// Na simulação a falha fica na explicação e a condição não é satisfeita
+	decision, err := set.Evaluate(ctx, in, nil, true)
+	if err != nil {
+		t.Fatalf("Evaluate with explain: %v", err)
+	}
+	if decision.Allowed || len(decision.Policies) != 1 {
+		t.Fatalf("Evaluate with explain = %+v, want one denied policy", decision)
+	}
+	cond := decision.Policies[0].Conditions[0]
+	if cond.Result || cond.Error != ErrResourceNotProvided.Error() {
+		t.Errorf("condition = %+v, want error %q", cond, ErrResourceNotProvided)
+	}
+}
+
+func TestEnforcerAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: ErrResourceNotFound, want: http.StatusNotFound},
+		{err: errors.New("order service unavailable"), want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/orders/1", nil)
+		(&Enforcer{}).abort(c, tt.err)
+		if w.Code != tt.want {
+			t.Errorf("abort(%v) status = %d, want %d", tt.err, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
+	"gopkg.in/yaml.v3"
+)
+
+// Effect é o efeito de uma política que se aplica à requisição
+type Effect string
+
+// Efeitos aceitos nas políticas
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Rule é uma política como declarada nos arquivos
+type Rule struct {
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description"`
+	Effect      Effect       `yaml:"effect"`   // allow (padrão) ou deny
+	Paths       []string     `yaml:"paths"`    // caminhos do gateway, com parâmetros (":id", "*rest")
+	Methods     []string     `yaml:"methods"`  // vazio vale para todos os métodos
+	Roles       []string     `yaml:"roles"`    // a política só vale para usuários com um destes papéis
+	Resource    *ResourceRef `yaml:"resource"` // recurso cujos atributos ficam disponíveis em "resource.*"
+	When        []string     `yaml:"when"`     // condições, todas obrigatórias
+}
+
+// ResourceRef indica onde buscar os atributos do recurso acessado
+type ResourceRef struct {
+	Service string `yaml:"service"`
+	Path    string `yaml:"path"` // caminho no serviço, com os parâmetros do caminho do gateway
+}
+
+// document é o formato dos arquivos de políticas
+type document struct {
+	Policies []Rule `yaml:"policies"`
+}
+
+// policy é uma regra validada e pronta para avaliação
+type policy struct {
+	Rule
+	source     string
+	paths      []*proxy.PathTemplate
+	resource   *proxy.PathTemplate
+	conditions []*condition
+}
+
+// Set é um conjunto imutável de políticas carregado dos arquivos
+type Set struct {
+	policies []*policy
+}
+
+// Len retorna o número de políticas do conjunto
+func (s *Set) Len() int {
+	return len(s.policies)
+}
+
+// Load lê e valida as políticas dos arquivos ou padrões glob informados
+func Load(patterns []string) (*Set, error) {
+	set := &Set{}
+	names := make(map[string]string)
+
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy file pattern %q: %w", pattern, err)
+		}
+		if len(files) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("policy file %s not found", pattern)
+		}
+
+		for _, file := range files {
+			rules, err := readFile(file)
+			if err != nil {
+				return nil, err
+			}
+			for i, rule := range rules {
+				p, err := compile(rule, file)
+				if err != nil {
+					return nil, fmt.Errorf("%s: policies[%d] %s: %w", file, i, rule.Name, err)
+				}
+				if other, ok := names[p.Name]; ok {
+					return nil, fmt.Errorf("%s: policy %q is already declared in %s", file, p.Name, other)
+				}
+				names[p.Name] = file
+				set.policies = append(set.policies, p)
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// readFile decodifica um arquivo de políticas, rejeitando campos desconhecidos
+func readFile(file string) ([]Rule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc document
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return doc.Policies, nil
+}
+
+// compile valida uma regra e prepara os caminhos e as condições para avaliação
+func compile(rule Rule, source string) (*policy, error) {
+	if rule.Name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	switch rule.Effect {
+	case "":
+		rule.Effect = Allow
+	case Allow, Deny:
+	default:
+		return nil, fmt.Errorf("unknown effect %q, expected allow or deny", rule.Effect)
+	}
+
+	if len(rule.Paths) == 0 {
+		return nil, errors.New("at least one path is required")
+	}
+	p := &policy{Rule: rule, source: source}
+	for _, raw := range rule.Paths {
+		path, err := proxy.ParsePathTemplate(raw)
+		if err != nil {
+			return nil, err
+		}
+		p.paths = append(p.paths, path)
+	}
+
+	for i, method := range p.Methods {
+		p.Methods[i] = strings.ToUpper(method)
+	}
+
+	if rule.Resource != nil {
+		rule.Resource.Service = strings.ToLower(rule.Resource.Service)
+		if !isService(rule.Resource.Service) {
+			return nil, fmt.Errorf("resource: unknown service %q", rule.Resource.Service)
+		}
+		resource, err := proxy.ParsePathTemplate(rule.Resource.Path)
+		if err != nil {
+			return nil, fmt.Errorf("resource: %w", err)
+		}
+		if err := p.requireParams(resource.Params()); err != nil {
+			return nil, fmt.Errorf("resource: %w", err)
+		}
+		p.resource = resource
+	}
+
+	for _, raw := range rule.When {
+		cond, err := parseCondition(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, attr := range cond.attributes() {
+			namespace, name, _ := strings.Cut(attr, ".")
+			switch {
+			case namespace == "resource" && p.resource == nil:
+				return nil, fmt.Errorf("condition %q uses resource attributes but the policy has no resource", raw)
+			case namespace == "param":
+				if err := p.requireParams([]string{name}); err != nil {
+					return nil, fmt.Errorf("condition %q: %w", raw, err)
+				}
+			}
+		}
+		p.conditions = append(p.conditions, cond)
+	}
+
+	return p, nil
+}
+
+// requireParams verifica se todos os caminhos da política definem os parâmetros
+func (p *policy) requireParams(names []string) error {
+	for _, path := range p.paths {
+		params := path.Params()
+		for _, name := range names {
+			if !contains(params, name) {
+				return fmt.Errorf("parameter %q is not defined in path %s", name, path)
+			}
+		}
+	}
+	return nil
+}
+
+// isService indica se o nome é de um serviço conhecido pelo gateway
+func isService(name string) bool {
+	return contains(config.ServiceNames, name)
+}
+
+// contains indica se value está na lista
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
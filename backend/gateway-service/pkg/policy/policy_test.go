@@ -0,0 +1,52 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	orderResource := &ResourceRef{Service: "order", Path: "/orders/:id"}
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr string
+	}{
+		{name: "valid", rule: Rule{Name: "own-orders", Paths: []string{"/api/orders/:id"}, Methods: []string{"get"},
+			Resource: orderResource, When: []string{"resource.userId == principal.id"}}},
+		{name: "missing name", rule: Rule{Paths: []string{"/api/orders"}}, wantErr: "name is required"},
+		{name: "unknown effect", rule: Rule{Name: "p", Effect: "audit", Paths: []string{"/api/orders"}}, wantErr: "unknown effect"},
+		{name: "missing paths", rule: Rule{Name: "p"}, wantErr: "at least one path"},
+		{name: "invalid path", rule: Rule{Name: "p", Paths: []string{"api/orders"}}, wantErr: "must start with"},
+		{name: "unknown service", rule: Rule{Name: "p", Paths: []string{"/api/orders/:id"},
+			Resource: &ResourceRef{Service: "billing", Path: "/orders/:id"}}, wantErr: "unknown service"},
+		{name: "resource parameter not in path", rule: Rule{Name: "p", Paths: []string{"/api/orders"},
+			Resource: orderResource}, wantErr: `parameter "id" is not defined`},
+		{name: "invalid condition", rule: Rule{Name: "p", Paths: []string{"/api/orders"},
+			When: []string{"principal.id"}}, wantErr: "invalid condition"},
+		{name: "resource condition without resource", rule: Rule{Name: "p", Paths: []string{"/api/orders/:id"},
+			When: []string{"resource.userId == principal.id"}}, wantErr: "has no resource"},
+		{name: "param not in every path", rule: Rule{Name: "p", Paths: []string{"/api/orders/:id", "/api/orders"},
+			When: []string{`param.id != "0"`}}, wantErr: `parameter "id" is not defined`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := compile(tt.rule, "test.yaml")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("compile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compile(): %v", err)
+			}
+			if p.Effect != Allow {
+				t.Errorf("Effect = %q, want %q", p.Effect, Allow)
+			}
+			if p.Methods[0] != "GET" {
+				t.Errorf("Methods = %v, want upper case", p.Methods)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var policyReloadsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "gateway_policy_reloads_total",
+		Help: "Total de recargas dos arquivos de políticas por resultado",
+	},
+	[]string{"result"},
+)
+
+// reloadDelay agrupa as várias notificações geradas por uma única gravação dos arquivos
+const reloadDelay = 200 * time.Millisecond
+
+// Store mantém o conjunto de políticas ativo. Com Watch, os arquivos são relidos quando
+// mudam; versões inválidas são rejeitadas e o conjunto anterior continua valendo.
+type Store struct {
+	files   []string
+	current atomic.Pointer[Set]
+
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+	timer   *time.Timer
+}
+
+// NewStore carrega as políticas dos arquivos configurados
+func NewStore(cfg config.PolicyConfig) (*Store, error) {
+	set, err := Load(cfg.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{files: cfg.Files}
+	s.current.Store(set)
+	if len(cfg.Files) > 0 {
+		logrus.WithField("policies", set.Len()).Info("Políticas de acesso carregadas")
+	}
+	return s, nil
+}
+
+// Policies retorna o conjunto de políticas ativo
+func (s *Store) Policies() *Set {
+	return s.current.Load()
+}
+
+// Reload relê os arquivos e troca o conjunto ativo se a nova versão for válida
+func (s *Store) Reload() error {
+	set, err := Load(s.files)
+	if err != nil {
+		policyReloadsTotal.WithLabelValues("rejected").Inc()
+		return err
+	}
+
+	s.current.Store(set)
+	policyReloadsTotal.WithLabelValues("success").Inc()
+	return nil
+}
+
+// Watch passa a observar os diretórios dos arquivos de políticas. Os diretórios, e não
+// os arquivos, são observados para acompanhar editores e volumes que substituem o arquivo.
+func (s *Store) Watch() error {
+	if len(s.files) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := make(map[string]bool)
+	for _, pattern := range s.files {
+		dir := filepath.Dir(pattern)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.watcher = watcher
+	s.mu.Unlock()
+
+	go s.watch(watcher)
+	return nil
+}
+
+// watch agenda uma recarga a cada alteração nos diretórios observados
+func (s *Store) watch(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			s.mu.Lock()
+			if s.timer != nil {
+				s.timer.Stop()
+			}
+			s.timer = time.AfterFunc(reloadDelay, s.reloadFromWatch)
+			s.mu.Unlock()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logrus.WithError(err).Warn("Erro ao observar os arquivos de políticas")
+		}
+	}
+}
+
+// reloadFromWatch aplica uma recarga disparada pela alteração dos arquivos
+func (s *Store) reloadFromWatch() {
+	if err := s.Reload(); err != nil {
+		logrus.WithError(err).Error("Políticas rejeitadas; mantendo as políticas atuais")
+		return
+	}
+	logrus.WithField("policies", s.Policies().Len()).Info("Políticas de acesso recarregadas")
+}
+
+// Close deixa de observar os arquivos
+func (s *Store) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if s.watcher != nil {
+		if err := s.watcher.Close(); err != nil {
+			logrus.WithError(err).Warn("Falha ao encerrar a observação das políticas")
+		}
+		s.watcher = nil
+	}
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+// Endpoint representa uma instância de um serviço remoto
+type Endpoint struct {
+	URL    *url.URL
+	Weight int
+
+	// inflight conta as requisições em andamento nesta instância
+	inflight atomic.Int64
+
+	health endpointHealth
+}
+
+// newEndpoint cria uma instância, considerada saudável até a primeira verificação
+func newEndpoint(u *url.URL, weight int) *Endpoint {
+	e := &Endpoint{URL: u, Weight: weight}
+	e.health.healthy = true
+	return e
+}
+
+// Inflight retorna o número de requisições em andamento na instância
+func (e *Endpoint) Inflight() int64 {
+	return e.inflight.Load()
+}
+
+// String retorna o endereço da instância
+func (e *Endpoint) String() string {
+	return e.URL.Host
+}
+
+// Balancer escolhe a instância que atende uma requisição
+type Balancer interface {
+	// Pick escolhe uma instância entre as candidatas; key é a chave de afinidade da requisição
+	Pick(candidates []*Endpoint, key string) *Endpoint
+}
+
+// newBalancer cria o balanceador para a estratégia configurada
+func newBalancer(strategy string) (Balancer, error) {
+	switch strategy {
+	case "", "round-robin":
+		return &roundRobin{}, nil
+	case "weighted":
+		return &weightedRoundRobin{current: make(map[*Endpoint]int)}, nil
+	case "least-requests":
+		return &leastRequests{}, nil
+	case "consistent-hash":
+		return &consistentHash{fallback: &roundRobin{}}, nil
+	}
+	return nil, fmt.Errorf("unknown load balancing strategy %q", strategy)
+}
+
+// roundRobin distribui as requisições em sequência entre as instâncias
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobin) Pick(candidates []*Endpoint, key string) *Endpoint {
+	if len(candidates) == 0 {
+		return nil
+	}
+	n := b.next.Add(1) - 1
+	return candidates[n%uint64(len(candidates))]
+}
+
+// weightedRoundRobin implementa o round-robin ponderado suave (mesmo algoritmo do nginx)
+type weightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[*Endpoint]int
+}
+
+func (b *weightedRoundRobin) Pick(candidates []*Endpoint, key string) *Endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var best *Endpoint
+	total := 0
+	for _, e := range candidates {
+		b.current[e] += e.Weight
+		total += e.Weight
+		if best == nil || b.current[e] > b.current[best] {
+			best = e
+		}
+	}
+	if best != nil {
+		b.current[best] -= total
+	}
+	return best
+}
+
+// leastRequests escolhe a instância com menos requisições em andamento, proporcionalmente ao peso
+type leastRequests struct {
+	offset atomic.Uint64
+}
+
+func (b *leastRequests) Pick(candidates []*Endpoint, key string) *Endpoint {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// O deslocamento evita que empates favoreçam sempre a primeira instância
+	start := int(b.offset.Add(1) % uint64(len(candidates)))
+
+	var best *Endpoint
+	bestLoad := math.MaxFloat64
+	for i := range candidates {
+		e := candidates[(start+i)%len(candidates)]
+		load := float64(e.Inflight()) / float64(e.Weight)
+		if load < bestLoad {
+			best, bestLoad = e, load
+		}
+	}
+	return best
+}
+
+// consistentHash mantém a afinidade entre uma chave e uma instância usando rendezvous hashing
+// ponderado: a remoção de uma instância só redistribui as chaves que ela atendia
+type consistentHash struct {
+	fallback Balancer
+}
+
+func (b *consistentHash) Pick(candidates []*Endpoint, key string) *Endpoint {
+	// Requisições sem chave (ex.: anônimas) são distribuídas normalmente
+	if key == "" {
+		return b.fallback.Pick(candidates, key)
+	}
+
+	var best *Endpoint
+	bestScore := math.Inf(-1)
+	for _, e := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(e.URL.Host))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+
+		// Normaliza o hash para (0, 1) e aplica o peso: score = -peso / ln(u)
+		u := (float64(h.Sum64()>>11) + 0.5) / float64(1<<53)
+		score := -float64(e.Weight) / math.Log(u)
+		if score > bestScore {
+			best, bestScore = e, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,409 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var (
+	upstreamEndpointHealthy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_upstream_endpoint_healthy",
+			Help: "Resultado da verificação ativa de saúde de cada instância (1 = saudável)",
+		},
+		[]string{"service", "endpoint"},
+	)
+
+	upstreamEndpointEjected = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_upstream_endpoint_ejected",
+			Help: "Instâncias ejetadas do balanceamento por falhas no tráfego real (1 = ejetada)",
+		},
+		[]string{"service", "endpoint"},
+	)
+
+	upstreamEjectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_ejections_total",
+			Help: "Total de ejeções de instâncias por falhas no tráfego real",
+		},
+		[]string{"service", "endpoint"},
+	)
+
+	upstreamHealthChecksTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_health_checks_total",
+			Help: "Total de verificações ativas de saúde por resultado",
+		},
+		[]string{"service", "endpoint", "result"},
+	)
+)
+
+// endpointHealth guarda o estado de saúde de uma instância
+type endpointHealth struct {
+	mu sync.Mutex
+
+	// Verificação ativa
+	healthy        bool
+	probeSuccesses int
+	probeFailures  int
+	lastCheck      time.Time
+	lastError      string
+
+	// Detecção passiva (tráfego real)
+	consecutiveFailures int
+	ejections           int
+	ejectedUntil        time.Time
+}
+
+// EndpointStatus é o retrato do estado de uma instância exposto em /health
+type EndpointStatus struct {
+	Address             string     `json:"address"`
+	Status              string     `json:"status"`
+	Healthy             bool       `json:"healthy"`
+	Ejected             bool       `json:"ejected"`
+	EjectedUntil        *time.Time `json:"ejectedUntil,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Inflight            int64      `json:"inflight"`
+	LastCheck           *time.Time `json:"lastCheck,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+// Available indica se a instância pode receber tráfego
+func (e *Endpoint) Available(now time.Time) bool {
+	e.health.mu.Lock()
+	defer e.health.mu.Unlock()
+	return e.health.healthy && !now.Before(e.health.ejectedUntil)
+}
+
+// Status retorna o estado atual da instância
+func (e *Endpoint) Status() EndpointStatus {
+	e.health.mu.Lock()
+	defer e.health.mu.Unlock()
+
+	now := time.Now()
+	status := EndpointStatus{
+		Address:             e.String(),
+		Healthy:             e.health.healthy,
+		Ejected:             now.Before(e.health.ejectedUntil),
+		ConsecutiveFailures: e.health.consecutiveFailures,
+		Inflight:            e.Inflight(),
+		LastError:           e.health.lastError,
+	}
+	if status.Ejected {
+		until := e.health.ejectedUntil
+		status.EjectedUntil = &until
+	}
+	if !e.health.lastCheck.IsZero() {
+		lastCheck := e.health.lastCheck
+		status.LastCheck = &lastCheck
+	}
+
+	status.Status = "UP"
+	if !status.Healthy || status.Ejected {
+		status.Status = "DOWN"
+	}
+	return status
+}
+
+// recordProbe registra o resultado de uma verificação ativa, retornando true quando o estado muda
+func (e *Endpoint) recordProbe(cfg config.HealthCheckConfig, err error) (changed bool) {
+	e.health.mu.Lock()
+	defer e.health.mu.Unlock()
+
+	e.health.lastCheck = time.Now()
+	if err == nil {
+		e.health.lastError = ""
+		e.health.probeFailures = 0
+		e.health.probeSuccesses++
+		if !e.health.healthy && e.health.probeSuccesses >= cfg.HealthyThreshold {
+			e.health.healthy = true
+			return true
+		}
+		return false
+	}
+
+	e.health.lastError = err.Error()
+	e.health.probeSuccesses = 0
+	e.health.probeFailures++
+	if e.health.healthy && e.health.probeFailures >= cfg.UnhealthyThreshold {
+		e.health.healthy = false
+		return true
+	}
+	return false
+}
+
+// withHealthDefaults completa a configuração de verificação ativa com os valores padrão
+func withHealthDefaults(cfg config.HealthCheckConfig) config.HealthCheckConfig {
+	if cfg.Type == "" {
+		cfg.Type = "none"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.HealthyThreshold <= 0 {
+		cfg.HealthyThreshold = 2
+	}
+	if cfg.UnhealthyThreshold <= 0 {
+		cfg.UnhealthyThreshold = 3
+	}
+	return cfg
+}
+
+// withOutlierDefaults completa a configuração de detecção passiva com os valores padrão
+func withOutlierDefaults(cfg config.OutlierDetectionConfig) config.OutlierDetectionConfig {
+	if cfg.BaseEjectionTime <= 0 {
+		cfg.BaseEjectionTime = 30 * time.Second
+	}
+	if cfg.MaxEjectionTime <= 0 {
+		cfg.MaxEjectionTime = 5 * time.Minute
+	}
+	if cfg.MaxEjectionPercent <= 0 {
+		cfg.MaxEjectionPercent = 50
+	}
+	return cfg
+}
+
+// recordOutcome registra o resultado de uma requisição real e ejeta a instância
+// quando ela acumula falhas consecutivas
+func (u *Upstream) recordOutcome(e *Endpoint, failed bool) {
+	if u.outlier.ConsecutiveFailures <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	e.health.mu.Lock()
+	if !failed {
+		e.health.consecutiveFailures = 0
+		// Após um período estável a instância deixa de ser tratada como reincidente
+		if e.health.ejections > 0 && now.After(e.health.ejectedUntil.Add(u.outlier.MaxEjectionTime)) {
+			e.health.ejections = 0
+		}
+		e.health.mu.Unlock()
+		return
+	}
+
+	e.health.consecutiveFailures++
+	shouldEject := e.health.consecutiveFailures >= u.outlier.ConsecutiveFailures && !now.Before(e.health.ejectedUntil)
+	e.health.mu.Unlock()
+
+	if !shouldEject || !u.canEject(now) {
+		return
+	}
+
+	e.health.mu.Lock()
+	e.health.ejections++
+	duration := u.outlier.BaseEjectionTime << (e.health.ejections - 1)
+	if duration <= 0 || duration > u.outlier.MaxEjectionTime {
+		duration = u.outlier.MaxEjectionTime
+	}
+	e.health.ejectedUntil = now.Add(duration)
+	e.health.consecutiveFailures = 0
+	e.health.mu.Unlock()
+
+	upstreamEjectionsTotal.WithLabelValues(u.name, e.String()).Inc()
+	upstreamEndpointEjected.WithLabelValues(u.name, e.String()).Set(1)
+	time.AfterFunc(duration, func() {
+		if !e.ejected(time.Now()) {
+			upstreamEndpointEjected.WithLabelValues(u.name, e.String()).Set(0)
+		}
+	})
+
+	logrus.WithFields(logrus.Fields{
+		"service":  u.name,
+		"endpoint": e.String(),
+		"duration": duration.String(),
+	}).Warn("Instância ejetada do balanceamento por falhas consecutivas")
+}
+
+// ejected indica se a instância está ejetada
+func (e *Endpoint) ejected(now time.Time) bool {
+	e.health.mu.Lock()
+	defer e.health.mu.Unlock()
+	return now.Before(e.health.ejectedUntil)
+}
+
+// canEject respeita o percentual máximo de instâncias ejetadas (ao menos uma pode ser ejetada)
+func (u *Upstream) canEject(now time.Time) bool {
+	ejected := 0
+	for _, e := range u.endpoints {
+		if e.ejected(now) {
+			ejected++
+		}
+	}
+	return ejected == 0 || (ejected+1)*100 <= u.outlier.MaxEjectionPercent*len(u.endpoints)
+}
+
+// healthChecker verifica periodicamente a saúde das instâncias de um serviço
+type healthChecker struct {
+	upstream *Upstream
+	cfg      config.HealthCheckConfig
+	client   *http.Client
+
+	mu    sync.Mutex
+	conns map[*Endpoint]*grpc.ClientConn
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newHealthChecker cria o verificador, ou nil quando a verificação ativa está desativada
+func newHealthChecker(u *Upstream, cfg config.HealthCheckConfig) *healthChecker {
+	if cfg.Type == "none" {
+		return nil
+	}
+	return &healthChecker{
+		upstream: u,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		conns:    make(map[*Endpoint]*grpc.ClientConn),
+		stop:     make(chan struct{}),
+	}
+}
+
+// start inicia uma goroutine de verificação por instância
+func (h *healthChecker) start() {
+	for _, e := range h.upstream.endpoints {
+		h.wg.Add(1)
+		go h.run(e)
+	}
+}
+
+// close interrompe as verificações e libera as conexões gRPC
+func (h *healthChecker) close() {
+	close(h.stop)
+	h.wg.Wait()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, conn := range h.conns {
+		conn.Close()
+	}
+}
+
+// run verifica uma instância a cada intervalo até o verificador ser encerrado
+func (h *healthChecker) run(e *Endpoint) {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(h.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		h.check(e)
+
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check executa uma verificação e atualiza o estado e as métricas da instância
+func (h *healthChecker) check(e *Endpoint) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Timeout)
+	defer cancel()
+
+	var err error
+	if h.cfg.Type == "grpc" {
+		err = h.checkGRPC(ctx, e)
+	} else {
+		err = h.checkHTTP(ctx, e)
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	upstreamHealthChecksTotal.WithLabelValues(h.upstream.name, e.String(), result).Inc()
+
+	if !e.recordProbe(h.cfg, err) {
+		return
+	}
+
+	entry := logrus.WithFields(logrus.Fields{"service": h.upstream.name, "endpoint": e.String()})
+	if err != nil {
+		upstreamEndpointHealthy.WithLabelValues(h.upstream.name, e.String()).Set(0)
+		entry.WithError(err).Warn("Instância marcada como indisponível pela verificação de saúde")
+	} else {
+		upstreamEndpointHealthy.WithLabelValues(h.upstream.name, e.String()).Set(1)
+		entry.Info("Instância voltou a ficar saudável")
+	}
+}
+
+// address retorna o endereço verificado, considerando a porta específica da verificação
+func (h *healthChecker) address(e *Endpoint) string {
+	if h.cfg.Port == "" {
+		return e.URL.Host
+	}
+	return net.JoinHostPort(e.URL.Hostname(), h.cfg.Port)
+}
+
+// checkHTTP considera a instância saudável quando ela responde com status < 500
+func (h *healthChecker) checkHTTP(ctx context.Context, e *Endpoint) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+h.address(e)+h.cfg.Path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// checkGRPC usa o protocolo padrão de health do gRPC (grpc.health.v1.Health/Check)
+func (h *healthChecker) checkGRPC(ctx context.Context, e *Endpoint) error {
+	conn, err := h.conn(e)
+	if err != nil {
+		return err
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: h.cfg.Service})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("grpc health status %s", resp.GetStatus())
+	}
+	return nil
+}
+
+// conn retorna a conexão gRPC reaproveitada entre as verificações da instância
+func (h *healthChecker) conn(e *Endpoint) (*grpc.ClientConn, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if conn, ok := h.conns[e]; ok {
+		return conn, nil
+	}
+
+	conn, err := grpc.Dial(h.address(e), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	h.conns[e] = conn
+	return conn, nil
+}
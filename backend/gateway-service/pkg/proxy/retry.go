@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ecommerce/gateway-service/pkg/resilience"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	upstreamRetriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_retries_total",
+			Help: "Total de repetições de chamadas aos serviços",
+		},
+		[]string{"service"},
+	)
+
+	upstreamRetryBudgetExhaustedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_retry_budget_exhausted_total",
+			Help: "Total de repetições descartadas por falta de orçamento",
+		},
+		[]string{"service"},
+	)
+)
+
+const (
+	// maxReplayBodyBytes é o maior corpo de requisição guardado em memória para repetição
+	maxReplayBodyBytes = 1 << 20
+
+	// maxDrainBytes é o máximo lido de uma resposta descartada para reaproveitar a conexão
+	maxDrainBytes = 64 << 10
+)
+
+// retryPolicyKey guarda no contexto a política de repetição da rota
+type retryPolicyKey struct{}
+
+// WithRetryPolicy associa ao contexto uma política de repetição que substitui a do serviço
+func WithRetryPolicy(ctx context.Context, policy *resilience.RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// retryPolicy retorna a política da rota, quando definida, ou a do serviço
+func (u *Upstream) retryPolicy(req *http.Request) *resilience.RetryPolicy {
+	if policy, ok := req.Context().Value(retryPolicyKey{}).(*resilience.RetryPolicy); ok {
+		return policy
+	}
+	return u.retry
+}
+
+// replayableBody prepara o corpo da requisição para ser enviado em várias tentativas.
+// Retorna nil quando a requisição não pode ser repetida.
+func replayableBody(req *http.Request, policy *resilience.RetryPolicy) (func() (io.ReadCloser, error), error) {
+	if policy.MaxAttempts() <= 1 || !resilience.Idempotent(req) {
+		return nil, nil
+	}
+
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+		return func() (io.ReadCloser, error) { return req.Body, nil }, nil
+
+	case req.GetBody != nil:
+		// A primeira tentativa usa o corpo original; as demais, uma cópia
+		first := req.Body
+		return func() (io.ReadCloser, error) {
+			if first != nil {
+				body := first
+				first = nil
+				return body, nil
+			}
+			return req.GetBody()
+		}, nil
+
+	case req.ContentLength > 0 && req.ContentLength <= maxReplayBodyBytes:
+		buf, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		return func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(buf)), nil }, nil
+	}
+
+	// Corpos grandes ou de tamanho desconhecido não são guardados
+	return nil, nil
+}
+
+// shouldRetry indica se o resultado de uma tentativa justifica uma nova tentativa
+func (u *Upstream) shouldRetry(req *http.Request, policy *resilience.RetryPolicy, resp *http.Response, err error) bool {
+	if err == nil {
+		return policy.RetryableStatus(resp.StatusCode)
+	}
+
+	// Circuito aberto, sobrecarga e ausência de instâncias não mudam até a próxima tentativa
+	var openErr *resilience.OpenError
+	var shedErr *resilience.ShedError
+	var noHealthy *NoHealthyInstancesError
+	if errors.As(err, &openErr) || errors.As(err, &shedErr) || errors.As(err, &noHealthy) {
+		return false
+	}
+	return req.Context().Err() == nil
+}
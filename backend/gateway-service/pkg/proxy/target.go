@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// segment representa um trecho de um template de caminho
+type segment struct {
+	literal  string
+	param    string
+	wildcard bool
+}
+
+// PathTemplate é um caminho de destino com parâmetros no formato do Gin (":id", "*rest")
+type PathTemplate struct {
+	raw           string
+	segments      []segment
+	trailingSlash bool
+}
+
+// ParsePathTemplate compila um template de caminho como "/admin/products/:id"
+func ParsePathTemplate(raw string) (*PathTemplate, error) {
+	if raw == "" {
+		raw = "/"
+	}
+	if !strings.HasPrefix(raw, "/") {
+		return nil, fmt.Errorf("path template must start with '/': %q", raw)
+	}
+
+	tmpl := &PathTemplate{raw: raw}
+	trimmed := strings.Trim(raw, "/")
+	if trimmed == "" {
+		return tmpl, nil
+	}
+	tmpl.trailingSlash = strings.HasSuffix(raw, "/")
+
+	seen := make(map[string]bool)
+	parts := strings.Split(trimmed, "/")
+	for i, part := range parts {
+		switch {
+		case part == "":
+			return nil, fmt.Errorf("path template has an empty segment: %q", raw)
+		case part[0] == ':' || part[0] == '*':
+			name := part[1:]
+			if !isParamName(name) {
+				return nil, fmt.Errorf("invalid parameter %q in path template %q", part, raw)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("duplicated parameter %q in path template %q", name, raw)
+			}
+			seen[name] = true
+
+			wildcard := part[0] == '*'
+			if wildcard && i != len(parts)-1 {
+				return nil, fmt.Errorf("wildcard %q must be the last segment of %q", part, raw)
+			}
+			tmpl.segments = append(tmpl.segments, segment{param: name, wildcard: wildcard})
+		default:
+			tmpl.segments = append(tmpl.segments, segment{literal: part})
+		}
+	}
+
+	return tmpl, nil
+}
+
+// String retorna o template original
+func (t *PathTemplate) String() string {
+	return t.raw
+}
+
+// Params retorna os nomes dos parâmetros usados pelo template
+func (t *PathTemplate) Params() []string {
+	var names []string
+	for _, s := range t.segments {
+		if s.param != "" {
+			names = append(names, s.param)
+		}
+	}
+	return names
+}
+
+// Match verifica se o caminho corresponde ao template e retorna os valores dos parâmetros,
+// no mesmo formato do Gin (wildcards incluem a barra inicial)
+func (t *PathTemplate) Match(path string) (gin.Params, bool) {
+	trimmed := strings.Trim(path, "/")
+	var parts []string
+	if trimmed != "" {
+		parts = strings.Split(trimmed, "/")
+	}
+
+	var params gin.Params
+	for i, s := range t.segments {
+		if s.wildcard {
+			params = append(params, gin.Param{Key: s.param, Value: "/" + strings.Join(parts[i:], "/")})
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch {
+		case s.param != "":
+			params = append(params, gin.Param{Key: s.param, Value: parts[i]})
+		case s.literal != parts[i]:
+			return nil, false
+		}
+	}
+	return params, len(parts) == len(t.segments)
+}
+
+// Expand substitui os parâmetros do template pelos valores da rota, retornando o caminho já escapado
+func (t *PathTemplate) Expand(params gin.Params) (string, error) {
+	var b strings.Builder
+	for _, s := range t.segments {
+		if s.param == "" {
+			b.WriteByte('/')
+			b.WriteString(s.literal)
+			continue
+		}
+
+		value, ok := params.Get(s.param)
+		if !ok {
+			return "", fmt.Errorf("missing route parameter %q for path template %q", s.param, t.raw)
+		}
+
+		if !s.wildcard {
+			if value == "" {
+				return "", fmt.Errorf("empty route parameter %q for path template %q", s.param, t.raw)
+			}
+			// O serviço normalizaria "." e ".." para outro caminho que não o autorizado pela rota
+			if value == "." || value == ".." {
+				return "", fmt.Errorf("route parameter %q contains a relative segment", s.param)
+			}
+			b.WriteByte('/')
+			b.WriteString(url.PathEscape(value))
+			continue
+		}
+
+		// Wildcards do Gin incluem a barra inicial; cada segmento é escapado individualmente
+		for _, part := range strings.Split(strings.Trim(value, "/"), "/") {
+			if part == "" {
+				continue
+			}
+			if part == "." || part == ".." {
+				return "", fmt.Errorf("route parameter %q contains a relative segment", s.param)
+			}
+			b.WriteByte('/')
+			b.WriteString(url.PathEscape(part))
+		}
+	}
+
+	if b.Len() == 0 || t.trailingSlash {
+		b.WriteByte('/')
+	}
+	return b.String(), nil
+}
+
+// QueryRewrite descreve como a query string original é repassada ao upstream
+type QueryRewrite struct {
+	// Drop descarta toda a query string original
+	Drop bool
+	// Allow, quando preenchido, limita os parâmetros repassados a esta lista
+	Allow []string
+	// Remove lista parâmetros que nunca são repassados
+	Remove []string
+	// Rename troca o nome de parâmetros (original -> upstream)
+	Rename map[string]string
+	// Set define parâmetros fixos; valores iniciados por ':' são lidos dos parâmetros da rota
+	Set map[string]string
+}
+
+// isZero indica se nenhuma reescrita foi configurada
+func (q QueryRewrite) isZero() bool {
+	return !q.Drop && len(q.Allow) == 0 && len(q.Remove) == 0 && len(q.Rename) == 0 && len(q.Set) == 0
+}
+
+// apply aplica a reescrita sobre a query string original
+func (q QueryRewrite) apply(rawQuery string, params gin.Params) (string, error) {
+	// Sem reescrita a query string é repassada exatamente como recebida
+	if q.isZero() {
+		return rawQuery, nil
+	}
+
+	values := url.Values{}
+	if !q.Drop {
+		parsed, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return "", fmt.Errorf("invalid query string: %w", err)
+		}
+		values = parsed
+	}
+
+	if len(q.Allow) > 0 {
+		allowed := make(url.Values, len(q.Allow))
+		for _, key := range q.Allow {
+			if v, ok := values[key]; ok {
+				allowed[key] = v
+			}
+		}
+		values = allowed
+	}
+
+	for _, key := range q.Remove {
+		values.Del(key)
+	}
+
+	for from, to := range q.Rename {
+		if v, ok := values[from]; ok {
+			values.Del(from)
+			values[to] = append(values[to], v...)
+		}
+	}
+
+	for key, value := range q.Set {
+		if strings.HasPrefix(value, ":") {
+			param, ok := params.Get(value[1:])
+			if !ok {
+				return "", fmt.Errorf("missing route parameter %q for query parameter %q", value[1:], key)
+			}
+			value = param
+		}
+		values.Set(key, value)
+	}
+
+	return values.Encode(), nil
+}
+
+// TargetOptions agrupa as opções de reescrita de um destino
+type TargetOptions struct {
+	// StripPrefix é removido do caminho original quando não há template de caminho
+	StripPrefix string
+	// AddPrefix é adicionado ao caminho original (após StripPrefix) quando não há template de caminho
+	AddPrefix string
+	// Query controla a reescrita da query string
+	Query QueryRewrite
+}
+
+// Target traduz o caminho e a query string de uma requisição para o serviço de destino
+type Target struct {
+	path        *PathTemplate
+	stripPrefix string
+	addPrefix   string
+	query       QueryRewrite
+}
+
+// NewTarget cria um destino. Com pathTemplate vazio o caminho original é repassado,
+// opcionalmente sem StripPrefix e com AddPrefix.
+func NewTarget(pathTemplate string, opts TargetOptions) (*Target, error) {
+	target := &Target{
+		stripPrefix: strings.TrimSuffix(opts.StripPrefix, "/"),
+		addPrefix:   strings.TrimSuffix(opts.AddPrefix, "/"),
+		query:       opts.Query,
+	}
+
+	if pathTemplate != "" {
+		if opts.StripPrefix != "" || opts.AddPrefix != "" {
+			return nil, fmt.Errorf("path template %q cannot be combined with prefix rewriting", pathTemplate)
+		}
+		tmpl, err := ParsePathTemplate(pathTemplate)
+		if err != nil {
+			return nil, err
+		}
+		target.path = tmpl
+	}
+
+	for _, prefix := range []string{target.stripPrefix, target.addPrefix} {
+		if prefix != "" && !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("path prefix must start with '/': %q", prefix)
+		}
+	}
+
+	return target, nil
+}
+
+// PathTemplate retorna o template de caminho do destino, ou nil quando o caminho original é repassado
+func (t *Target) PathTemplate() *PathTemplate {
+	return t.path
+}
+
+// Rewrite calcula a URL (caminho e query string) a ser enviada ao upstream
+func (t *Target) Rewrite(original *url.URL, params gin.Params) (*url.URL, error) {
+	var escapedPath string
+	var err error
+	if t.path != nil {
+		escapedPath, err = t.path.Expand(params)
+	} else {
+		escapedPath, err = t.rewritePath(original.EscapedPath())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rewritten, err := url.Parse(escapedPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream path %q: %w", escapedPath, err)
+	}
+
+	if rewritten.RawQuery, err = t.query.apply(original.RawQuery, params); err != nil {
+		return nil, err
+	}
+
+	return rewritten, nil
+}
+
+// rewritePath aplica a remoção e adição de prefixos ao caminho original
+func (t *Target) rewritePath(escaped string) (string, error) {
+	if t.stripPrefix != "" {
+		if escaped != t.stripPrefix && !strings.HasPrefix(escaped, t.stripPrefix+"/") {
+			return "", fmt.Errorf("path %q does not start with prefix %q", escaped, t.stripPrefix)
+		}
+		escaped = strings.TrimPrefix(escaped, t.stripPrefix)
+	}
+
+	escaped = t.addPrefix + escaped
+	if escaped == "" {
+		escaped = "/"
+	}
+	return escaped, nil
+}
+
+// isParamName valida o nome de um parâmetro de rota
+func isParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParsePathTemplate(t *testing.T) {
+	tests := []struct {
+		raw     string
+		params  []string
+		wantErr bool
+	}{
+		{raw: "", params: nil},
+		{raw: "/", params: nil},
+		{raw: "/products", params: nil},
+		{raw: "/products/", params: nil},
+		{raw: "/admin/products/:id", params: []string{"id"}},
+		{raw: "/users/:userId/orders/:orderId", params: []string{"userId", "orderId"}},
+		{raw: "/files/*rest", params: []string{"rest"}},
+		{raw: "/users/:id/*rest", params: []string{"id", "rest"}},
+		{raw: "products", wantErr: true},
+		{raw: "/products//items", wantErr: true},
+		{raw: "/products/:", wantErr: true},
+		{raw: "/products/:id.x", wantErr: true},
+		{raw: "/products/:product-id", params: []string{"product-id"}},
+		{raw: "/products/:id/items/:id", wantErr: true},
+		{raw: "/files/*rest/more", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			tmpl, err := ParsePathTemplate(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParsePathTemplate(%q) succeeded, want error", tt.raw)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePathTemplate(%q): %v", tt.raw, err)
+			}
+			if got := tmpl.Params(); !reflect.DeepEqual(got, tt.params) {
+				t.Errorf("Params() = %v, want %v", got, tt.params)
+			}
+		})
+	}
+}
+
+func TestPathTemplateMatch(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		params   gin.Params
+		ok       bool
+	}{
+		{"/", "/", nil, true},
+		{"/", "/products", nil, false},
+		{"/products", "/products", nil, true},
+		{"/products", "/products/", nil, true},
+		{"/products", "/product", nil, false},
+		{"/products", "/products/1", nil, false},
+		{"/products/:id", "/products/42", gin.Params{{Key: "id", Value: "42"}}, true},
+		{"/products/:id", "/products", nil, false},
+		{"/products/:id", "/products/42/reviews", nil, false},
+		{"/users/:userId/orders/:orderId", "/users/7/orders/9",
+			gin.Params{{Key: "userId", Value: "7"}, {Key: "orderId", Value: "9"}}, true},
+		{"/files/*rest", "/files/a/b/c", gin.Params{{Key: "rest", Value: "/a/b/c"}}, true},
+		{"/files/*rest", "/files", gin.Params{{Key: "rest", Value: "/"}}, true},
+		{"/files/*rest", "/other/a", nil, false},
+		{"/api/v1/products/categories", "/api/v1/products/categories", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template+" "+tt.path, func(t *testing.T) {
+			tmpl, err := ParsePathTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("ParsePathTemplate(%q): %v", tt.template, err)
+			}
+			params, ok := tmpl.Match(tt.path)
+			if ok != tt.ok {
+				t.Fatalf("Match(%q) ok = %v, want %v", tt.path, ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("Match(%q) params = %v, want %v", tt.path, params, tt.params)
+			}
+		})
+	}
+}
+
+func TestPathTemplateExpand(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		params   gin.Params
+		want     string
+		wantErr  bool
+	}{
+		{name: "root", template: "/", want: "/"},
+		{name: "literal", template: "/products", want: "/products"},
+		{name: "trailing slash", template: "/products/", want: "/products/"},
+		{name: "param", template: "/products/:id", params: gin.Params{{Key: "id", Value: "42"}}, want: "/products/42"},
+		{name: "param escaped", template: "/products/:id", params: gin.Params{{Key: "id", Value: "a/b c"}}, want: "/products/a%2Fb%20c"},
+		{name: "wildcard", template: "/files/*rest", params: gin.Params{{Key: "rest", Value: "/a/b"}}, want: "/files/a/b"},
+		{name: "wildcard empty", template: "/files/*rest", params: gin.Params{{Key: "rest", Value: "/"}}, want: "/files"},
+		{name: "wildcard escaped", template: "/files/*rest", params: gin.Params{{Key: "rest", Value: "/a b/c?d"}}, want: "/files/a%20b/c%3Fd"},
+		{name: "missing param", template: "/products/:id", wantErr: true},
+		{name: "empty param", template: "/products/:id", params: gin.Params{{Key: "id", Value: ""}}, wantErr: true},
+		{name: "param dot", template: "/products/:id", params: gin.Params{{Key: "id", Value: "."}}, wantErr: true},
+		{name: "param dot dot", template: "/users/addresses/:id", params: gin.Params{{Key: "id", Value: ".."}}, wantErr: true},
+		{name: "param with dots", template: "/products/:id", params: gin.Params{{Key: "id", Value: "..."}}, want: "/products/..."},
+		{name: "wildcard dot dot", template: "/files/*rest", params: gin.Params{{Key: "rest", Value: "/a/../admin"}}, wantErr: true},
+		{name: "wildcard dot", template: "/files/*rest", params: gin.Params{{Key: "rest", Value: "/./a"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParsePathTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("ParsePathTemplate(%q): %v", tt.template, err)
+			}
+			got, err := tmpl.Expand(tt.params)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expand(%v) = %q, want error", tt.params, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expand(%v): %v", tt.params, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expand(%v) = %q, want %q", tt.params, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeadlineHeader informa ao serviço quanto tempo, em milissegundos, resta para responder
+const DeadlineHeader = "X-Request-Deadline"
+
+// timeoutKey guarda no contexto o timeout da rota
+type timeoutKey struct{}
+
+// WithTimeout associa ao contexto um timeout que substitui o do serviço
+func WithTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+// requestTimeout retorna o timeout da rota, quando definido, ou o do serviço
+func (u *Upstream) requestTimeout(req *http.Request) time.Duration {
+	if timeout, ok := req.Context().Value(timeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	return u.timeout
+}
+
+// setDeadlineHeader repassa o prazo restante da requisição ao serviço. O valor recebido
+// do cliente nunca é repassado.
+func setDeadlineHeader(req *http.Request) {
+	req.Header.Del(DeadlineHeader)
+
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 1 {
+		remaining = 1
+	}
+	req.Header.Set(DeadlineHeader, strconv.FormatInt(remaining, 10))
+}
@@ -0,0 +1,492 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/resilience"
+	"github.com/sirupsen/logrus"
+)
+
+// userIDKey guarda no contexto o ID do usuário autenticado, usado pelo hash consistente
+type userIDKey struct{}
+
+// WithUserID associa ao contexto o ID do usuário autenticado da requisição
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// NoHealthyInstancesError é retornado quando nenhuma instância do serviço pode receber tráfego
+type NoHealthyInstancesError struct {
+	Service string
+}
+
+func (e *NoHealthyInstancesError) Error() string {
+	return fmt.Sprintf("no healthy instances available for service %s", e.Service)
+}
+
+// Upstream representa um serviço remoto com uma ou mais instâncias
+type Upstream struct {
+	name      string
+	cfg       config.ServiceConfig
+	endpoints []*Endpoint
+	balancer  Balancer
+	hashOn    string
+	outlier   config.OutlierDetectionConfig
+	checker   *healthChecker
+	breaker   *resilience.Breaker
+	limiter   *resilience.ConcurrencyLimiter
+	bulkhead  *resilience.Bulkhead
+	retry     *resilience.RetryPolicy
+	budget    *resilience.RetryBudget
+	timeout   time.Duration
+	transport http.RoundTripper
+	proxy     *httputil.ReverseProxy
+}
+
+// NewUpstream cria um serviço remoto a partir da sua configuração
+func NewUpstream(name string, cfg config.ServiceConfig) (*Upstream, error) {
+	balancer, err := newBalancer(cfg.LoadBalancing.Strategy)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", name, err)
+	}
+
+	u := &Upstream{
+		name:      name,
+		cfg:       cfg,
+		balancer:  balancer,
+		hashOn:    cfg.LoadBalancing.HashOn,
+		outlier:   withOutlierDefaults(cfg.OutlierDetection),
+		breaker:   resilience.NewBreaker(name, cfg.CircuitBreaker),
+		limiter:   resilience.NewConcurrencyLimiter(name, cfg.Concurrency),
+		bulkhead:  resilience.NewBulkhead(name, cfg.Bulkhead),
+		retry:     resilience.NewRetryPolicy(cfg.Retry),
+		budget:    resilience.NewRetryBudget(config.RetryBudgetConfig{}),
+		timeout:   cfg.Timeout,
+		transport: http.DefaultTransport.(*http.Transport).Clone(),
+	}
+
+	for _, instance := range cfg.Instances() {
+		endpointURL, err := url.Parse(fmt.Sprintf("http://%s:%s", instance.Host, instance.Port))
+		if err != nil {
+			return nil, fmt.Errorf("service %s: invalid endpoint %s:%s: %w", name, instance.Host, instance.Port, err)
+		}
+
+		weight := instance.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		u.endpoints = append(u.endpoints, newEndpoint(endpointURL, weight))
+	}
+
+	u.attach()
+	return u, nil
+}
+
+// renew cria o serviço da nova versão da configuração, que não mudou para ele, mantendo o
+// estado deste: a saúde das instâncias, o circuit breaker, o limite de concorrência, o
+// bulkhead e as conexões. Só a verificação de saúde e o orçamento de repetições são novos.
+func (u *Upstream) renew() *Upstream {
+	next := &Upstream{
+		name:      u.name,
+		cfg:       u.cfg,
+		endpoints: u.endpoints,
+		balancer:  u.balancer,
+		hashOn:    u.hashOn,
+		outlier:   u.outlier,
+		breaker:   u.breaker,
+		limiter:   u.limiter,
+		bulkhead:  u.bulkhead,
+		retry:     u.retry,
+		timeout:   u.timeout,
+		transport: u.transport,
+	}
+	next.attach()
+	return next
+}
+
+// attach cria a verificação de saúde e o proxy reverso do serviço
+func (u *Upstream) attach() {
+	u.checker = newHealthChecker(u, withHealthDefaults(u.cfg.HealthCheck))
+	u.proxy = &httputil.ReverseProxy{
+		Director:     u.direct,
+		Transport:    u,
+		ErrorHandler: u.handleError,
+	}
+}
+
+// Start inicia a verificação ativa de saúde das instâncias, quando configurada
+func (u *Upstream) Start() {
+	for _, e := range u.endpoints {
+		status := e.Status()
+		upstreamEndpointHealthy.WithLabelValues(u.name, e.String()).Set(boolGauge(status.Healthy))
+		upstreamEndpointEjected.WithLabelValues(u.name, e.String()).Set(boolGauge(status.Ejected))
+	}
+	if u.checker != nil {
+		u.checker.start()
+	}
+}
+
+// Close interrompe a verificação de saúde e remove as métricas das instâncias. As métricas das
+// instâncias que continuam em next, o serviço que o substitui na recarga, são mantidas.
+func (u *Upstream) Close(next *Upstream) {
+	if u.checker != nil {
+		u.checker.close()
+	}
+	for _, e := range u.endpoints {
+		if next.hasEndpoint(e.String()) {
+			continue
+		}
+		upstreamEndpointHealthy.DeleteLabelValues(u.name, e.String())
+		upstreamEndpointEjected.DeleteLabelValues(u.name, e.String())
+	}
+	// As conexões passam para o serviço que o substitui quando a configuração não mudou
+	if next == nil || next.transport != u.transport {
+		u.transport.(*http.Transport).CloseIdleConnections()
+	}
+}
+
+// boolGauge converte o estado de uma instância no valor das métricas
+func boolGauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// hasEndpoint indica se o serviço tem a instância; falso para u nil
+func (u *Upstream) hasEndpoint(address string) bool {
+	if u == nil {
+		return false
+	}
+	for _, e := range u.endpoints {
+		if e.String() == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Name retorna o nome do serviço
+func (u *Upstream) Name() string {
+	return u.name
+}
+
+// Endpoints retorna as instâncias do serviço
+func (u *Upstream) Endpoints() []*Endpoint {
+	return u.endpoints
+}
+
+// ServeHTTP encaminha a requisição, com o caminho já reescrito, para uma instância do serviço
+func (u *Upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.proxy.ServeHTTP(w, r)
+}
+
+// RoundTrip permite usar o serviço como http.RoundTripper, tanto no proxy quanto nos
+// clientes de pkg/service: o host da URL é substituído pela instância escolhida pelo
+// balanceador e as falhas transitórias são repetidas conforme a política de repetição,
+// dentro do timeout da rota ou do serviço. A requisição ocupa uma vaga do bulkhead do
+// serviço, com todas as tentativas, até o corpo da resposta ser fechado.
+func (u *Upstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if timeout := u.requestTimeout(req); timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), timeout)
+		req = req.WithContext(ctx)
+	}
+
+	// A espera na fila do bulkhead conta no prazo da requisição
+	leave, err := u.bulkhead.Enter(req.Context())
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp, err := u.roundTrip(req)
+	if err != nil {
+		leave()
+		cancel()
+		return nil, err
+	}
+
+	// O prazo e a vaga continuam valendo enquanto o corpo da resposta é lido
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: func() {
+		leave()
+		cancel()
+	}}
+	return resp, nil
+}
+
+// roundTrip envia a requisição, repetindo as tentativas que falharam
+func (u *Upstream) roundTrip(req *http.Request) (*http.Response, error) {
+	u.budget.Deposit()
+
+	policy := u.retryPolicy(req)
+	getBody, err := replayableBody(req, policy)
+	if err != nil {
+		return nil, err
+	}
+	if getBody == nil {
+		return u.try(req, req.Body)
+	}
+
+	for attempt := 1; ; attempt++ {
+		body, err := getBody()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := u.try(req, body)
+		if attempt >= policy.MaxAttempts() || !u.shouldRetry(req, policy, resp, err) {
+			return resp, err
+		}
+		if !u.budget.Withdraw() {
+			upstreamRetryBudgetExhaustedTotal.WithLabelValues(u.name).Inc()
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+			resp.Body.Close()
+		}
+
+		upstreamRetriesTotal.WithLabelValues(u.name).Inc()
+		logrus.WithFields(logrus.Fields{"service": u.name, "attempt": attempt + 1}).Debug("Repetindo chamada ao serviço")
+
+		timer := time.NewTimer(policy.Backoff(attempt + 1))
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// try envia uma tentativa da requisição, com o corpo informado, a uma instância do serviço
+func (u *Upstream) try(req *http.Request, body io.ReadCloser) (*http.Response, error) {
+	// Sob sobrecarga as requisições de menor prioridade são descartadas antes de chegar ao serviço
+	release, err := u.limiter.Acquire(resilience.PriorityFrom(req.Context()))
+	if err != nil {
+		return nil, err
+	}
+
+	// Com o circuito aberto a requisição falha imediatamente, sem ocupar o serviço
+	done, err := u.breaker.Allow()
+	if err != nil {
+		release(0, false)
+		return nil, err
+	}
+
+	endpoint := u.pick(req)
+	if endpoint == nil {
+		release(0, false)
+		done(true)
+		return nil, &NoHealthyInstancesError{Service: u.name}
+	}
+
+	out := req.Clone(req.Context())
+	out.Body = body
+	out.URL.Scheme = endpoint.URL.Scheme
+	out.URL.Host = endpoint.URL.Host
+	out.Host = ""
+	setDeadlineHeader(out)
+
+	endpoint.inflight.Add(1)
+	start := time.Now()
+	resp, err := u.transport.RoundTrip(out)
+	if err != nil {
+		endpoint.inflight.Add(-1)
+		// O cancelamento pelo cliente não diz nada sobre a capacidade do serviço
+		canceled := isCanceled(req, err)
+		if canceled {
+			release(0, false)
+		} else {
+			release(time.Since(start), true)
+		}
+		u.finish(endpoint, done, !canceled)
+		return nil, err
+	}
+	failed := resp.StatusCode >= http.StatusInternalServerError
+	release(time.Since(start), failed)
+	u.finish(endpoint, done, failed)
+
+	// A requisição só termina quando o corpo da resposta é fechado
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: func() { endpoint.inflight.Add(-1) }}
+	return resp, nil
+}
+
+// pick escolhe, entre as instâncias disponíveis, a que atende a requisição
+func (u *Upstream) pick(r *http.Request) *Endpoint {
+	now := time.Now()
+	candidates := make([]*Endpoint, 0, len(u.endpoints))
+	for _, e := range u.endpoints {
+		if e.Available(now) {
+			candidates = append(candidates, e)
+		}
+	}
+	return u.balancer.Pick(candidates, u.affinityKey(r))
+}
+
+// ConcurrencyLimit retorna o limite atual de requisições simultâneas ao serviço; zero
+// quando o controle de concorrência está desativado
+func (u *Upstream) ConcurrencyLimit() int {
+	if u.limiter == nil {
+		return 0
+	}
+	return u.limiter.Limit()
+}
+
+// Bulkhead retorna as requisições ocupando o bulkhead do serviço e as que aguardam vaga;
+// zero quando ele está desativado
+func (u *Upstream) Bulkhead() (inflight, queued int) {
+	return u.bulkhead.Inflight(), u.bulkhead.Queued()
+}
+
+// BreakerState retorna o estado do circuit breaker do serviço
+func (u *Upstream) BreakerState() resilience.State {
+	if u.breaker == nil {
+		return resilience.StateClosed
+	}
+	return u.breaker.State()
+}
+
+// Status retorna o estado de todas as instâncias do serviço
+func (u *Upstream) Status() []EndpointStatus {
+	statuses := make([]EndpointStatus, 0, len(u.endpoints))
+	for _, e := range u.endpoints {
+		statuses = append(statuses, e.Status())
+	}
+	return statuses
+}
+
+// affinityKey retorna a chave usada pelo hash consistente
+func (u *Upstream) affinityKey(r *http.Request) string {
+	switch {
+	case u.hashOn == "user":
+		userID, _ := r.Context().Value(userIDKey{}).(string)
+		return userID
+	case strings.HasPrefix(u.hashOn, "header:"):
+		return r.Header.Get(strings.TrimPrefix(u.hashOn, "header:"))
+	}
+	return ""
+}
+
+// finish registra o resultado de uma tentativa na detecção passiva e no circuit breaker
+func (u *Upstream) finish(endpoint *Endpoint, done func(failed bool), failed bool) {
+	u.recordOutcome(endpoint, failed)
+	done(failed)
+}
+
+// direct prepara a requisição do proxy; a instância é escolhida em RoundTrip
+func (u *Upstream) direct(req *http.Request) {
+	req.URL.Scheme = "http"
+	req.URL.Host = u.name
+
+	// Evitar que o Go envie o User-Agent padrão
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+// handleError responde às falhas de comunicação com o serviço
+func (u *Upstream) handleError(rw http.ResponseWriter, req *http.Request, err error) {
+	var openErr *resilience.OpenError
+	var shedErr *resilience.ShedError
+	var bulkheadErr *resilience.BulkheadError
+	var noHealthy *NoHealthyInstancesError
+	switch {
+	case errors.As(err, &openErr):
+		rw.Header().Set("Retry-After", strconv.Itoa(openErr.RetryAfterSeconds()))
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	case errors.As(err, &shedErr):
+		rw.Header().Set("Retry-After", strconv.Itoa(shedErr.RetryAfterSeconds()))
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	case errors.As(err, &bulkheadErr):
+		rw.Header().Set("Retry-After", strconv.Itoa(bulkheadErr.RetryAfterSeconds()))
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	case errors.As(err, &noHealthy):
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	case errors.Is(err, context.DeadlineExceeded):
+		logrus.WithError(err).Warnf("Proxy timeout: %s", u.name)
+		rw.WriteHeader(http.StatusGatewayTimeout)
+		io.WriteString(rw, fmt.Sprintf("Gateway timeout: %s did not respond in time", u.name))
+		return
+	default:
+		logrus.WithError(err).Errorf("Proxy error: %s", u.name)
+		rw.WriteHeader(http.StatusBadGateway)
+	}
+	io.WriteString(rw, fmt.Sprintf("Service unavailable: %s", err.Error()))
+}
+
+// isCanceled indica se a falha foi causada pelo cancelamento da requisição pelo cliente,
+// o que não deve ser atribuído à instância
+func isCanceled(req *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) || req.Context().Err() == context.Canceled
+}
+
+// releaseOnClose executa release uma única vez quando o corpo da resposta é fechado
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// Upstreams agrupa os serviços remotos pelo nome usado na configuração
+type Upstreams map[string]*Upstream
+
+// NewUpstreams cria todos os serviços remotos conhecidos pelo gateway. Os serviços de previous,
+// a versão anterior da configuração, cuja configuração não mudou mantêm o seu estado.
+func NewUpstreams(cfg *config.Config, previous Upstreams) (Upstreams, error) {
+	// O orçamento de repetições é compartilhado por todos os serviços
+	budget := resilience.NewRetryBudget(cfg.RetryBudget)
+
+	upstreams := make(Upstreams, len(config.ServiceNames))
+	for _, name := range config.ServiceNames {
+		serviceCfg, _ := cfg.Service(name)
+		if prev := previous[name]; prev != nil && reflect.DeepEqual(prev.cfg, serviceCfg) {
+			upstream := prev.renew()
+			upstream.budget = budget
+			upstreams[name] = upstream
+			continue
+		}
+		upstream, err := NewUpstream(name, serviceCfg)
+		if err != nil {
+			return nil, err
+		}
+		upstream.budget = budget
+		upstreams[name] = upstream
+	}
+	return upstreams, nil
+}
+
+// Start inicia a verificação de saúde de todos os serviços
+func (u Upstreams) Start() {
+	for _, upstream := range u {
+		upstream.Start()
+	}
+}
+
+// Close encerra a verificação de saúde de todos os serviços; next são os serviços que os
+// substituem na recarga, ou nil no encerramento do gateway
+func (u Upstreams) Close(next Upstreams) {
+	for name, upstream := range u {
+		upstream.Close(next[name])
+	}
+}
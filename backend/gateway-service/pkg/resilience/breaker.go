@@ -0,0 +1,268 @@
+package resilience
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	circuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_circuit_breaker_state",
+			Help: "Estado do circuit breaker por serviço (0 = fechado, 1 = meio-aberto, 2 = aberto)",
+		},
+		[]string{"service"},
+	)
+
+	circuitBreakerRejectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_circuit_breaker_rejections_total",
+			Help: "Total de requisições rejeitadas pelo circuit breaker aberto",
+		},
+		[]string{"service"},
+	)
+
+	circuitBreakerTransitionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_circuit_breaker_transitions_total",
+			Help: "Total de mudanças de estado do circuit breaker",
+		},
+		[]string{"service", "state"},
+	)
+)
+
+// State representa o estado de um circuit breaker
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+// String retorna o nome do estado
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// OpenError é retornado enquanto o circuit breaker está aberto
+type OpenError struct {
+	Service    string
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for service %s (retry after %s)", e.Service, e.RetryAfter)
+}
+
+// RetryAfterSeconds retorna o valor do cabeçalho Retry-After, com no mínimo 1 segundo
+func (e *OpenError) RetryAfterSeconds() int {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// breakerBuckets é o número de subdivisões da janela de observação
+const breakerBuckets = 10
+
+// bucket acumula os resultados de uma fração da janela
+type bucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+// Breaker é um circuit breaker fechado/aberto/meio-aberto baseado na proporção de falhas
+// observadas em uma janela deslizante
+type Breaker struct {
+	service string
+	cfg     config.CircuitBreakerConfig
+
+	mu       sync.Mutex
+	state    State
+	openedAt time.Time
+	buckets  [breakerBuckets]bucket
+
+	// generation muda a cada transição; resultados de gerações anteriores são descartados
+	generation uint64
+
+	// Controle do estado meio-aberto
+	halfOpenInflight  int
+	halfOpenSuccesses int
+}
+
+// NewBreaker cria o circuit breaker de um serviço, ou nil quando ele não está configurado
+func NewBreaker(service string, cfg config.CircuitBreakerConfig) *Breaker {
+	if cfg.FailureRatio <= 0 {
+		return nil
+	}
+
+	if cfg.MinimumRequests <= 0 {
+		cfg.MinimumRequests = 20
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 5
+	}
+
+	// O estado só é publicado nas transições: na recarga da configuração o breaker anterior
+	// pode continuar atendendo requisições com o mesmo rótulo
+	return &Breaker{service: service, cfg: cfg}
+}
+
+// State retorna o estado atual do circuit breaker
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(time.Now())
+	return b.state
+}
+
+// Allow verifica se uma requisição pode seguir para o serviço. Em caso positivo retorna
+// a função que deve ser chamada uma única vez com o resultado da requisição.
+// Um Breaker nil permite todas as requisições.
+func (b *Breaker) Allow() (done func(failed bool), err error) {
+	if b == nil {
+		return func(bool) {}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.advance(now)
+
+	switch b.state {
+	case StateOpen:
+		circuitBreakerRejectionsTotal.WithLabelValues(b.service).Inc()
+		return nil, &OpenError{Service: b.service, RetryAfter: b.openedAt.Add(b.cfg.CoolDown).Sub(now)}
+
+	case StateHalfOpen:
+		// Apenas algumas requisições de teste passam enquanto o serviço se recupera
+		if b.halfOpenInflight >= b.cfg.HalfOpenRequests {
+			circuitBreakerRejectionsTotal.WithLabelValues(b.service).Inc()
+			return nil, &OpenError{Service: b.service, RetryAfter: time.Second}
+		}
+		b.halfOpenInflight++
+	}
+
+	return b.doneFunc(b.generation), nil
+}
+
+// doneFunc registra o resultado de uma requisição admitida na geração informada
+func (b *Breaker) doneFunc(generation uint64) func(failed bool) {
+	var once sync.Once
+	return func(failed bool) {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if generation == b.generation {
+				b.record(failed, time.Now())
+			}
+		})
+	}
+}
+
+// record contabiliza o resultado e aplica as transições de estado
+func (b *Breaker) record(failed bool, now time.Time) {
+	if b.state == StateHalfOpen {
+		b.halfOpenInflight--
+		if failed {
+			b.transition(StateOpen, now)
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.cfg.HalfOpenRequests {
+			b.transition(StateClosed, now)
+		}
+		return
+	}
+
+	current := b.bucket(now)
+	if failed {
+		current.failures++
+	} else {
+		current.successes++
+	}
+
+	successes, failures := b.totals(now)
+	total := successes + failures
+	if total >= b.cfg.MinimumRequests && float64(failures)/float64(total) >= b.cfg.FailureRatio {
+		b.transition(StateOpen, now)
+	}
+}
+
+// advance move o breaker aberto para meio-aberto quando o tempo de espera termina
+func (b *Breaker) advance(now time.Time) {
+	if b.state == StateOpen && !now.Before(b.openedAt.Add(b.cfg.CoolDown)) {
+		b.transition(StateHalfOpen, now)
+	}
+}
+
+// transition muda o estado, reiniciando os contadores
+func (b *Breaker) transition(to State, now time.Time) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.halfOpenInflight = 0
+	b.halfOpenSuccesses = 0
+	b.buckets = [breakerBuckets]bucket{}
+	if to == StateOpen {
+		b.openedAt = now
+	}
+
+	circuitBreakerState.WithLabelValues(b.service).Set(float64(to))
+	circuitBreakerTransitionsTotal.WithLabelValues(b.service, to.String()).Inc()
+
+	entry := logrus.WithFields(logrus.Fields{"service": b.service, "from": from.String(), "to": to.String()})
+	if to == StateOpen {
+		entry.Warn("Circuit breaker aberto")
+	} else {
+		entry.Info("Circuit breaker mudou de estado")
+	}
+}
+
+// bucket retorna o bucket corrente da janela, reiniciando-o se pertencer a uma volta anterior
+func (b *Breaker) bucket(now time.Time) *bucket {
+	width := b.cfg.Window / breakerBuckets
+	start := now.Truncate(width)
+	current := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !current.start.Equal(start) {
+		*current = bucket{start: start}
+	}
+	return current
+}
+
+// totals soma os resultados dos buckets que ainda estão dentro da janela
+func (b *Breaker) totals(now time.Time) (successes, failures int) {
+	windowStart := now.Add(-b.cfg.Window)
+	for _, bk := range b.buckets {
+		if bk.start.After(windowStart) {
+			successes += bk.successes
+			failures += bk.failures
+		}
+	}
+	return successes, failures
+}
@@ -0,0 +1,182 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	bulkheadInflight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_bulkhead_inflight",
+			Help: "Requisições ocupando o bulkhead de cada serviço",
+		},
+		[]string{"service"},
+	)
+
+	bulkheadQueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_bulkhead_queue_depth",
+			Help: "Requisições aguardando vaga no bulkhead de cada serviço",
+		},
+		[]string{"service"},
+	)
+
+	bulkheadQueueWait = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gateway_bulkhead_queue_wait_seconds",
+			Help:    "Tempo de espera na fila do bulkhead até conseguir uma vaga",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		},
+		[]string{"service"},
+	)
+
+	bulkheadRejectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_bulkhead_rejections_total",
+			Help: "Total de requisições recusadas pelo bulkhead, por serviço e motivo (queue_full, queue_timeout)",
+		},
+		[]string{"service", "reason"},
+	)
+)
+
+// Motivos da recusa pelo bulkhead
+const (
+	BulkheadQueueFull    = "queue_full"
+	BulkheadQueueTimeout = "queue_timeout"
+)
+
+// BulkheadError é retornado quando o bulkhead do serviço não tem vaga para a requisição
+type BulkheadError struct {
+	Service string
+	Reason  string // BulkheadQueueFull ou BulkheadQueueTimeout
+}
+
+func (e *BulkheadError) Error() string {
+	if e.Reason == BulkheadQueueTimeout {
+		return fmt.Sprintf("bulkhead for service %s is full, timed out waiting in queue", e.Service)
+	}
+	return fmt.Sprintf("bulkhead for service %s is full, queue is full", e.Service)
+}
+
+// RetryAfterSeconds retorna o valor do cabeçalho Retry-After; as vagas costumam abrir logo
+func (e *BulkheadError) RetryAfterSeconds() int {
+	return 1
+}
+
+// Bulkhead isola a capacidade que o gateway dedica a um serviço: no máximo MaxInflight
+// requisições simultâneas e MaxQueue aguardando vaga, cada uma por até QueueTimeout. Assim um
+// serviço lento não prende as goroutines e conexões de que os demais precisam.
+type Bulkhead struct {
+	service string
+	slots   chan struct{}
+	timeout time.Duration
+
+	mu       sync.Mutex
+	waiting  int
+	maxQueue int
+}
+
+// NewBulkhead cria o bulkhead de um serviço, ou nil quando ele não está configurado
+func NewBulkhead(service string, cfg config.BulkheadConfig) *Bulkhead {
+	if cfg.MaxInflight <= 0 {
+		return nil
+	}
+
+	b := &Bulkhead{
+		service:  service,
+		slots:    make(chan struct{}, cfg.MaxInflight),
+		timeout:  cfg.QueueTimeout,
+		maxQueue: cfg.MaxQueue,
+	}
+	// As métricas são do serviço e não do bulkhead: não são zeradas aqui porque, na recarga da
+	// configuração, o bulkhead anterior ainda pode ter vagas ocupadas
+	if b.timeout <= 0 {
+		b.timeout = time.Second
+	}
+	return b
+}
+
+// Enter ocupa uma vaga do bulkhead, aguardando na fila quando todas estão ocupadas. Retorna
+// BulkheadError quando a fila está cheia ou a espera passa do tempo máximo, e o erro do
+// contexto quando ele termina antes. Em caso positivo retorna a função que libera a vaga,
+// que pode ser chamada mais de uma vez. Um Bulkhead nil permite todas as requisições.
+func (b *Bulkhead) Enter(ctx context.Context) (leave func(), err error) {
+	if b == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return b.entered(), nil
+	default:
+	}
+
+	b.mu.Lock()
+	if b.waiting >= b.maxQueue {
+		b.mu.Unlock()
+		bulkheadRejectionsTotal.WithLabelValues(b.service, BulkheadQueueFull).Inc()
+		return nil, &BulkheadError{Service: b.service, Reason: BulkheadQueueFull}
+	}
+	b.waiting++
+	bulkheadQueueDepth.WithLabelValues(b.service).Set(float64(b.waiting))
+	b.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(b.timeout)
+	defer func() {
+		timer.Stop()
+		b.mu.Lock()
+		b.waiting--
+		bulkheadQueueDepth.WithLabelValues(b.service).Set(float64(b.waiting))
+		b.mu.Unlock()
+	}()
+
+	select {
+	case b.slots <- struct{}{}:
+		bulkheadQueueWait.WithLabelValues(b.service).Observe(time.Since(start).Seconds())
+		return b.entered(), nil
+	case <-timer.C:
+		bulkheadRejectionsTotal.WithLabelValues(b.service, BulkheadQueueTimeout).Inc()
+		return nil, &BulkheadError{Service: b.service, Reason: BulkheadQueueTimeout}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// entered registra a vaga ocupada e retorna a função que a libera
+func (b *Bulkhead) entered() func() {
+	bulkheadInflight.WithLabelValues(b.service).Set(float64(len(b.slots)))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-b.slots
+			bulkheadInflight.WithLabelValues(b.service).Set(float64(len(b.slots)))
+		})
+	}
+}
+
+// Inflight retorna as requisições ocupando o bulkhead
+func (b *Bulkhead) Inflight() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.slots)
+}
+
+// Queued retorna as requisições aguardando vaga
+func (b *Bulkhead) Queued() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.waiting
+}
@@ -0,0 +1,281 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	concurrencyLimit = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_concurrency_limit",
+			Help: "Limite adaptativo de requisições simultâneas por serviço",
+		},
+		[]string{"service"},
+	)
+
+	concurrencyInflight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_concurrency_inflight",
+			Help: "Requisições em andamento por serviço",
+		},
+		[]string{"service"},
+	)
+
+	loadShedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_load_shed_total",
+			Help: "Total de requisições descartadas pelo limite de concorrência, por serviço e prioridade",
+		},
+		[]string{"service", "priority"},
+	)
+)
+
+// Priority é a classe de prioridade de uma requisição. Sob sobrecarga as classes mais
+// baixas são descartadas primeiro.
+type Priority int
+
+const (
+	PriorityLow      Priority = iota // relatórios e consultas administrativas
+	PriorityNormal                   // navegação no catálogo
+	PriorityHigh                     // carrinho
+	PriorityCritical                 // checkout e pagamentos
+)
+
+// String retorna o nome da prioridade
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// ParsePriority converte o nome usado na configuração; vazio é PriorityNormal
+func ParsePriority(name string) (Priority, error) {
+	switch name {
+	case "low":
+		return PriorityLow, nil
+	case "", "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	case "critical":
+		return PriorityCritical, nil
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority %q", name)
+}
+
+// priorityShares é a fração do limite que cada classe pode ocupar. Ao se aproximar do
+// limite, as classes baixas são descartadas enquanto a capacidade restante fica reservada
+// às mais altas.
+var priorityShares = map[Priority]float64{
+	PriorityLow:      0.5,
+	PriorityNormal:   0.75,
+	PriorityHigh:     0.9,
+	PriorityCritical: 1,
+}
+
+// priorityKey guarda no contexto a prioridade da requisição
+type priorityKey struct{}
+
+// WithPriority associa ao contexto a prioridade da requisição
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFrom retorna a prioridade da requisição; sem prioridade definida, PriorityNormal
+func PriorityFrom(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// baselineWindow é o tempo que a latência de referência do gradient leva para acompanhar
+// (cerca de 63% de) uma mudança duradoura da latência
+const baselineWindow = 10 * time.Minute
+
+// ShedError é retornado quando a requisição é descartada pelo limite de concorrência
+type ShedError struct {
+	Service  string
+	Priority Priority
+}
+
+func (e *ShedError) Error() string {
+	return fmt.Sprintf("service %s is overloaded, %s priority request shed", e.Service, e.Priority)
+}
+
+// RetryAfterSeconds retorna o valor do cabeçalho Retry-After; a sobrecarga costuma ser breve
+func (e *ShedError) RetryAfterSeconds() int {
+	return 1
+}
+
+// ConcurrencyLimiter limita as requisições simultâneas a um serviço com um limite que se
+// adapta à latência observada: cresce enquanto o serviço responde bem e cai quando a
+// latência sobe ou as chamadas falham, antes que as filas do serviço cresçam.
+type ConcurrencyLimiter struct {
+	service string
+	cfg     config.ConcurrencyConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	// gradient: latência de referência, uma média de longo prazo das amostras
+	baseline   float64
+	lastSample time.Time
+}
+
+// NewConcurrencyLimiter cria o limite de concorrência de um serviço, ou nil quando ele não
+// está configurado
+func NewConcurrencyLimiter(service string, cfg config.ConcurrencyConfig) *ConcurrencyLimiter {
+	if cfg.Algorithm == "" {
+		return nil
+	}
+
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 5
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 1000
+	}
+	if cfg.InitialLimit <= 0 {
+		cfg.InitialLimit = 20
+	}
+	if cfg.LatencyThreshold <= 0 {
+		cfg.LatencyThreshold = time.Second
+	}
+	if cfg.BackoffRatio <= 0 {
+		cfg.BackoffRatio = 0.9
+	}
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = 1.5
+	}
+	if cfg.Smoothing <= 0 {
+		cfg.Smoothing = 0.2
+	}
+
+	l := &ConcurrencyLimiter{service: service, cfg: cfg}
+	// As métricas não são zeradas aqui: na recarga da configuração o limite anterior ainda
+	// pode ter vagas ocupadas
+	l.limit = l.clamp(float64(cfg.InitialLimit))
+	return l
+}
+
+// Limit retorna o limite atual
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// Acquire reserva uma vaga para a requisição com a prioridade informada ou retorna
+// ShedError quando a classe já ocupa toda a sua fração do limite. Em caso positivo retorna
+// a função que deve ser chamada uma única vez quando o serviço responder, com a latência e
+// se a chamada indicou sobrecarga (erro ou 5xx); latência zero libera a vaga sem ajustar o
+// limite. Um ConcurrencyLimiter nil permite todas as requisições.
+func (l *ConcurrencyLimiter) Acquire(priority Priority) (done func(latency time.Duration, dropped bool), err error) {
+	if l == nil {
+		return func(time.Duration, bool) {}, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	share, ok := priorityShares[priority]
+	if !ok {
+		share = priorityShares[PriorityNormal]
+	}
+	// As requisições críticas sempre têm ao menos uma vaga
+	if float64(l.inflight) >= math.Max(1, math.Floor(l.limit*share)) {
+		loadShedTotal.WithLabelValues(l.service, priority.String()).Inc()
+		return nil, &ShedError{Service: l.service, Priority: priority}
+	}
+
+	l.inflight++
+	concurrencyInflight.WithLabelValues(l.service).Set(float64(l.inflight))
+
+	var once sync.Once
+	return func(latency time.Duration, dropped bool) {
+		once.Do(func() { l.release(latency, dropped) })
+	}, nil
+}
+
+// release libera a vaga e ajusta o limite com a amostra
+func (l *ConcurrencyLimiter) release(latency time.Duration, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inflight := l.inflight
+	l.inflight--
+	concurrencyInflight.WithLabelValues(l.service).Set(float64(l.inflight))
+	if latency <= 0 {
+		return
+	}
+
+	if l.cfg.Algorithm == "gradient" {
+		l.gradient(latency.Seconds(), dropped, inflight)
+	} else {
+		l.aimd(latency, dropped, inflight)
+	}
+	concurrencyLimit.WithLabelValues(l.service).Set(l.limit)
+}
+
+// aimd aumenta o limite em uma vaga a cada resposta rápida enquanto ele está em uso e o
+// reduz pelo fator de recuo a cada resposta lenta ou falha
+func (l *ConcurrencyLimiter) aimd(latency time.Duration, dropped bool, inflight int) {
+	switch {
+	case dropped || latency > l.cfg.LatencyThreshold:
+		l.limit = l.clamp(l.limit * l.cfg.BackoffRatio)
+	case float64(inflight)*2 >= l.limit:
+		// Com menos da metade do limite em uso a amostra não diz nada sobre a capacidade
+		l.limit = l.clamp(l.limit + 1)
+	}
+}
+
+// gradient ajusta o limite pela razão entre a latência de referência e a da amostra: com a
+// latência estável o limite cresce na raiz quadrada dele; com a latência subindo ele cai na
+// mesma proporção, até a metade a cada ajuste
+func (l *ConcurrencyLimiter) gradient(sample float64, dropped bool, inflight int) {
+	if l.baseline == 0 {
+		l.baseline = sample
+	}
+	// A referência acompanha a latência devagar, para que a degradação não vire o novo normal;
+	// quando o serviço volta a responder rápido ela cai de imediato
+	now := time.Now()
+	weight := 0.0
+	if !l.lastSample.IsZero() {
+		weight = math.Min(1, now.Sub(l.lastSample).Seconds()/baselineWindow.Seconds())
+	}
+	l.lastSample = now
+	l.baseline = math.Min(sample, l.baseline+(sample-l.baseline)*weight)
+
+	gradient := 0.5
+	if !dropped {
+		gradient = math.Max(0.5, math.Min(1, l.cfg.Tolerance*l.baseline/sample))
+	}
+	if gradient == 1 && float64(inflight)*2 < l.limit {
+		return
+	}
+
+	next := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.clamp(l.limit*(1-l.cfg.Smoothing) + next*l.cfg.Smoothing)
+}
+
+// clamp mantém o limite entre o mínimo e o máximo configurados
+func (l *ConcurrencyLimiter) clamp(limit float64) float64 {
+	return math.Max(float64(l.cfg.MinLimit), math.Min(float64(l.cfg.MaxLimit), limit))
+}
@@ -0,0 +1,160 @@
+package resilience
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+)
+
+// IdempotencyKeyHeader marca uma requisição não idempotente como segura para repetição
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryPolicy define quando e como uma chamada que falhou é repetida
+type RetryPolicy struct {
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	retryOn     map[int]bool
+}
+
+// NewRetryPolicy cria a política de repetição, ou nil quando ela não está configurada.
+// Uma política com uma única tentativa desativa as repetições.
+func NewRetryPolicy(cfg config.RetryConfig) *RetryPolicy {
+	if cfg.MaxAttempts <= 0 {
+		return nil
+	}
+
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = 25 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Second
+	}
+	if len(cfg.RetryOn) == 0 {
+		cfg.RetryOn = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+
+	p := &RetryPolicy{
+		maxAttempts: cfg.MaxAttempts,
+		baseBackoff: cfg.BaseBackoff,
+		maxBackoff:  cfg.MaxBackoff,
+		retryOn:     make(map[int]bool, len(cfg.RetryOn)),
+	}
+	for _, status := range cfg.RetryOn {
+		p.retryOn[status] = true
+	}
+	return p
+}
+
+// MaxAttempts retorna o total de tentativas permitidas; uma política nil permite apenas uma
+func (p *RetryPolicy) MaxAttempts() int {
+	if p == nil {
+		return 1
+	}
+	return p.maxAttempts
+}
+
+// RetryableStatus indica se uma resposta com o status informado deve ser repetida
+func (p *RetryPolicy) RetryableStatus(status int) bool {
+	return p != nil && p.retryOn[status]
+}
+
+// Backoff retorna a espera antes da tentativa informada (2 para a primeira repetição),
+// com jitter completo: um valor aleatório entre zero e o limite exponencial
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	ceiling := p.maxBackoff
+	if shift := attempt - 2; shift < 32 {
+		if d := p.baseBackoff << shift; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Idempotent indica se a requisição pode ser repetida sem efeitos duplicados
+func Idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// RetryBudget limita as repetições a uma fração das requisições recentes, para que
+// elas não multipliquem a carga sobre serviços que já estão falhando
+type RetryBudget struct {
+	cfg config.RetryBudgetConfig
+
+	mu      sync.Mutex
+	buckets [breakerBuckets]budgetBucket
+}
+
+// budgetBucket acumula requisições e repetições de uma fração da janela
+type budgetBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// NewRetryBudget cria o orçamento de repetições compartilhado pelos serviços
+func NewRetryBudget(cfg config.RetryBudgetConfig) *RetryBudget {
+	if cfg.Ratio <= 0 {
+		cfg.Ratio = 0.2
+	}
+	if cfg.MinRetriesPerSecond <= 0 {
+		cfg.MinRetriesPerSecond = 10
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	return &RetryBudget{cfg: cfg}
+}
+
+// Deposit contabiliza uma requisição original, que amplia o orçamento
+func (b *RetryBudget) Deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bucket(time.Now()).requests++
+}
+
+// Withdraw consome uma repetição do orçamento. Retorna false quando ele está esgotado.
+func (b *RetryBudget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	requests, retries := b.totals(now)
+	allowed := b.cfg.Ratio*float64(requests) + float64(b.cfg.MinRetriesPerSecond)*b.cfg.Window.Seconds()
+	if float64(retries) >= allowed {
+		return false
+	}
+
+	b.bucket(now).retries++
+	return true
+}
+
+// bucket retorna o bucket corrente da janela, reiniciando-o se pertencer a uma volta anterior
+func (b *RetryBudget) bucket(now time.Time) *budgetBucket {
+	width := b.cfg.Window / breakerBuckets
+	start := now.Truncate(width)
+	current := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !current.start.Equal(start) {
+		*current = budgetBucket{start: start}
+	}
+	return current
+}
+
+// totals soma os contadores dos buckets que ainda estão dentro da janela
+func (b *RetryBudget) totals(now time.Time) (requests, retries int) {
+	windowStart := now.Add(-b.cfg.Window)
+	for _, bk := range b.buckets {
+		if bk.start.After(windowStart) {
+			requests += bk.requests
+			retries += bk.retries
+		}
+	}
+	return requests, retries
+}
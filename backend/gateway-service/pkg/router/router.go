@@ -1,45 +1,95 @@
 package router
 
 import (
-	"github.com/ecommerce/gateway-service/pkg/config"
 	"github.com/ecommerce/gateway-service/pkg/handler"
+	"github.com/ecommerce/gateway-service/pkg/middleware"
 	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/middleware/cache"
+	"github.com/ecommerce/gateway-service/pkg/middleware/quota"
+	"github.com/ecommerce/gateway-service/pkg/middleware/ratelimit"
+	"github.com/ecommerce/gateway-service/pkg/policy"
+	"github.com/ecommerce/gateway-service/pkg/resilience"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// SetupRoutes configura todas as rotas da API
-func SetupRoutes(router *gin.Engine, handlers *handler.Handlers, cfg *config.Config) {
+// SetupRoutes configura todas as rotas da API. refresh é nil quando o refresh de sessões do
+// gateway está desativado e o refresh fica a cargo do serviço de autenticação; guard é nil
+// quando a proteção de login está desativada, limiter é nil quando os limites de requisições
+// estão desativados, quotas é nil quando as cotas estão desativadas e responses é nil quando o
+// cache de respostas está desativado.
+func SetupRoutes(router *gin.Engine, handlers *handler.Handlers, authenticator *auth.Authenticator, authorizer *auth.Authorizer, enforcer *policy.Enforcer,
+	refresh *auth.RefreshTokens, guard *auth.LoginGuard, limiter *ratelimit.Limiter, quotas *quota.Quotas, responses *cache.Cache) {
 	// Rota de healthcheck
 	router.GET("/health", handlers.HealthHandler.Check)
 
 	// Rota para métricas do Prometheus
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+	// Tokens OAuth2 de serviços (client_credentials)
+	if handlers.OAuthHandler != nil {
+		oauth := router.Group("/oauth", limiter.Limit())
+		{
+			oauth.POST("/token", handlers.OAuthHandler.Token)
+			oauth.POST("/introspect", handlers.OAuthHandler.Introspect)
+		}
+	}
+
 	// Grupo principal da API
 	api := router.Group("/api/v1")
 
-	// Rotas públicas (sem autenticação)
-	setupPublicRoutes(api, handlers)
+	// Rotas públicas (sem autenticação); os limites só podem usar o IP e os cabeçalhos
+	setupPublicRoutes(api.Group("", limiter.Limit()), handlers, authenticator, refresh, guard, responses)
 
-	// Rotas protegidas (requerem autenticação)
+	// Rotas protegidas (requerem autenticação); os limites vêm depois da autenticação, que
+	// identifica o usuário e a chave de API, e as cotas contam as chamadas aceitas
 	protected := api.Group("")
-	protected.Use(auth.JWT(cfg.Auth.JWTSecret))
-	setupProtectedRoutes(protected, handlers)
+	protected.Use(authenticator.RequireAuth(), limiter.Limit(), enforcer.Enforce())
+	setupProtectedRoutes(protected.Group("", quotas.Meter()), handlers, authorizer)
+
+	// Consumo das cotas do consumidor; a consulta não conta nas cotas
+	if handlers.UsageHandler != nil {
+		protected.GET("/usage", handlers.UsageHandler.Usage)
+	}
+
+	// Encerrar sessões também fica fora das cotas, para que o consumidor sem cota possa
+	// revogar os seus tokens
+	protected.POST("/auth/logout", handlers.SessionHandler.Logout)
+	if handlers.RefreshHandler != nil {
+		sessions := protected.Group("/users/me/sessions")
+		{
+			sessions.DELETE("", handlers.RefreshHandler.RevokeOtherSessions)
+			sessions.DELETE("/:id", handlers.RefreshHandler.RevokeSession)
+		}
+	}
+
+	// Impersonação de clientes pelo suporte, no espaço das rotas de administração de usuários
+	// da tabela de rotas; exige autenticação recente do administrador
+	if handlers.ImpersonationHandler != nil {
+		router.POST("/api/admin/users/:id/impersonate", authenticator.RequireAuth(), limiter.Limit(), enforcer.Enforce(),
+			authorizer.RequirePermissions("users:impersonate"), authorizer.RequireStepUp(), handlers.ImpersonationHandler.Impersonate)
+	}
 }
 
 // setupPublicRoutes configura rotas que não exigem autenticação
-func setupPublicRoutes(router *gin.RouterGroup, handlers *handler.Handlers) {
-	// Autenticação
+func setupPublicRoutes(router *gin.RouterGroup, handlers *handler.Handlers, authenticator *auth.Authenticator, refresh *auth.RefreshTokens, guard *auth.LoginGuard,
+	responses *cache.Cache) {
+	// Autenticação; o login é protegido contra força bruta, no modo de sessão grava os tokens
+	// em cookies e, com o refresh do gateway, abre uma sessão de refresh
 	auth := router.Group("/auth")
 	{
-		auth.POST("/login", handlers.AuthHandler.Login)
+		if refresh != nil {
+			auth.POST("/login", guard.Protect(false), authenticator.SessionLogin(), refresh.Login(authenticator), handlers.AuthHandler.Login)
+			auth.POST("/refresh", authenticator.SessionLogin(), handlers.RefreshHandler.Refresh)
+		} else {
+			auth.POST("/login", guard.Protect(false), authenticator.SessionLogin(), handlers.AuthHandler.Login)
+			auth.POST("/refresh", handlers.AuthHandler.RefreshToken)
+		}
 		auth.POST("/register", handlers.AuthHandler.Register)
-		auth.POST("/refresh", handlers.AuthHandler.RefreshToken)
 	}
 
-	// Produtos (apenas leitura)
-	products := router.Group("/products")
+	// Produtos (apenas leitura), com as respostas do catálogo em cache
+	products := router.Group("/products", responses.Cacheable())
 	{
 		products.GET("", handlers.ProductHandler.GetAll)
 		products.GET("/:id", handlers.ProductHandler.GetByID)
@@ -48,27 +98,53 @@ func setupPublicRoutes(router *gin.RouterGroup, handlers *handler.Handlers) {
 	}
 }
 
-// setupProtectedRoutes configura rotas que exigem autenticação
-func setupProtectedRoutes(router *gin.RouterGroup, handlers *handler.Handlers) {
-	// Usuários
+// setupProtectedRoutes configura rotas que exigem autenticação. Sob sobrecarga dos serviços o
+// checkout tem prioridade sobre o carrinho, o carrinho sobre a navegação e a navegação sobre
+// os relatórios.
+func setupProtectedRoutes(router *gin.RouterGroup, handlers *handler.Handlers, authorizer *auth.Authorizer) {
+	critical := middleware.Priority(resilience.PriorityCritical)
+
+	// Administração de sessões e políticas
+	admin := router.Group("/admin")
+	{
+		admin.POST("/users/:id/revoke-tokens", authorizer.RequirePermissions("users:manage"), handlers.SessionHandler.RevokeUserTokens)
+		admin.POST("/policies/evaluate", authorizer.RequirePermissions("policies:read"), handlers.PolicyHandler.Evaluate)
+	}
+
+	// Chaves de API de parceiros e integrações
+	apiKeys := router.Group("/admin/api-keys", authorizer.RequirePermissions("apikeys:manage"))
+	{
+		apiKeys.GET("", handlers.APIKeyHandler.List)
+		apiKeys.POST("", handlers.APIKeyHandler.Create)
+		apiKeys.POST("/:id/rotate", handlers.APIKeyHandler.Rotate)
+		apiKeys.DELETE("/:id", handlers.APIKeyHandler.Revoke)
+	}
+
+	// Usuários; alterar o perfil e os endereços exige autenticação recente (authorization.stepUp)
+	stepUp := authorizer.RequireStepUp()
 	users := router.Group("/users")
 	{
 		users.GET("/me", handlers.UserHandler.GetProfile)
-		users.PUT("/me", handlers.UserHandler.UpdateProfile)
+		users.PUT("/me", stepUp, handlers.UserHandler.UpdateProfile)
 		users.GET("/me/addresses", handlers.UserHandler.GetAddresses)
-		users.POST("/me/addresses", handlers.UserHandler.AddAddress)
-		users.PUT("/me/addresses/:id", handlers.UserHandler.UpdateAddress)
-		users.DELETE("/me/addresses/:id", handlers.UserHandler.DeleteAddress)
+		users.POST("/me/addresses", stepUp, handlers.UserHandler.AddAddress)
+		users.PUT("/me/addresses/:id", stepUp, handlers.UserHandler.UpdateAddress)
+		users.DELETE("/me/addresses/:id", stepUp, handlers.UserHandler.DeleteAddress)
+	}
+
+	// Sessões de refresh do usuário nos seus dispositivos; o encerramento fica fora das cotas
+	if handlers.RefreshHandler != nil {
+		router.GET("/users/me/sessions", handlers.RefreshHandler.ListSessions)
 	}
 
 	// Carrinho
-	cart := router.Group("/cart")
+	cart := router.Group("/cart", middleware.Priority(resilience.PriorityHigh))
 	{
 		cart.GET("", handlers.CartHandler.GetCart)
 		cart.POST("/items", handlers.CartHandler.AddItem)
 		cart.PUT("/items/:id", handlers.CartHandler.UpdateItem)
 		cart.DELETE("/items/:id", handlers.CartHandler.RemoveItem)
-		cart.POST("/checkout", handlers.CartHandler.Checkout)
+		cart.POST("/checkout", critical, handlers.CartHandler.Checkout)
 	}
 
 	// Pedidos
@@ -76,12 +152,12 @@ func setupProtectedRoutes(router *gin.RouterGroup, handlers *handler.Handlers) {
 	{
 		orders.GET("", handlers.OrderHandler.GetAll)
 		orders.GET("/:id", handlers.OrderHandler.GetByID)
-		orders.POST("", handlers.OrderHandler.Create)
+		orders.POST("", critical, handlers.OrderHandler.Create)
 		orders.PUT("/:id/cancel", handlers.OrderHandler.Cancel)
 	}
 
 	// Dashboard
-	dashboard := router.Group("/dashboard")
+	dashboard := router.Group("/dashboard", middleware.Priority(resilience.PriorityLow))
 	{
 		dashboard.GET("/stats", handlers.DashboardHandler.GetStats)
 		dashboard.GET("/recent-orders", handlers.DashboardHandler.GetRecentOrders)
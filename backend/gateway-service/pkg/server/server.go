@@ -0,0 +1,302 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ecommerce/gateway-service/pkg/api"
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/handler"
+	"github.com/ecommerce/gateway-service/pkg/middleware"
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/middleware/cache"
+	"github.com/ecommerce/gateway-service/pkg/middleware/quota"
+	"github.com/ecommerce/gateway-service/pkg/middleware/ratelimit"
+	"github.com/ecommerce/gateway-service/pkg/policy"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
+	"github.com/ecommerce/gateway-service/pkg/router"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	configReloadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_config_reloads_total",
+			Help: "Total de recargas de configuração por resultado",
+		},
+		[]string{"result"},
+	)
+
+	configLastReloadSuccess = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_config_last_reload_success_timestamp_seconds",
+			Help: "Momento da última recarga de configuração aplicada com sucesso",
+		},
+	)
+)
+
+// drainTimeout limita a espera pelas requisições da configuração anterior antes de fechar os
+// seus recursos, para que conexões longas não os prendam indefinidamente
+const drainTimeout = time.Minute
+
+// instance agrupa o engine e os recursos criados para uma versão da configuração
+type instance struct {
+	config    *config.Config
+	engine    *gin.Engine
+	upstreams proxy.Upstreams
+	state     *state
+
+	// Requisições em andamento, para que os recursos só sejam fechados quando terminarem
+	mu       sync.Mutex
+	active   int
+	draining bool
+	drained  chan struct{}
+}
+
+// build monta o engine Gin completo do gateway a partir de uma configuração,
+// reaproveitando os recursos com estado e os serviços da versão anterior que não mudaram
+func build(cfg *config.Config, previous *instance) (inst *instance, err error) {
+	var (
+		previousState     *state
+		previousUpstreams proxy.Upstreams
+	)
+	if previous != nil {
+		previousState, previousUpstreams = previous.state, previous.upstreams
+	}
+
+	st, err := previousState.derive(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			st.release(previousState)
+		}
+	}()
+
+	// Identidade assinada repassada aos serviços; a enviada pelo cliente é descartada na entrada
+	identity := auth.NewIdentitySigner(cfg.Identity)
+
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	engine.Use(middleware.Logger())
+	engine.Use(middleware.Cors(cfg))
+	engine.Use(middleware.Metrics())
+	engine.Use(identity.StripInbound())
+
+	// Serviços remotos, compartilhados entre o proxy e os clientes de pkg/service
+	upstreams, err := proxy.NewUpstreams(cfg, previousUpstreams)
+	if err != nil {
+		return nil, err
+	}
+
+	// Emissor dos tokens OAuth de serviços, dos tokens de acesso do refresh e dos tokens de
+	// impersonação, aceitos pela própria autenticação do gateway
+	var issuer *auth.TokenIssuer
+	if cfg.Auth.OAuth.Enabled || cfg.Auth.Refresh.Enabled || cfg.Auth.Impersonation.Enabled {
+		if issuer, err = auth.NewTokenIssuer(cfg.Auth.OAuth, cfg.Auth.JWTSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	// Autenticação e autorização compartilhadas pelas rotas da API e pela tabela de rotas
+	sessions := auth.NewSessions(cfg.Auth.Session, cfg.Cors.SessionOrigins)
+	impersonation, err := auth.NewImpersonation(cfg.Auth.Impersonation, issuer, st.audit)
+	if err != nil {
+		return nil, err
+	}
+	authenticator, err := auth.NewAuthenticator(cfg.Auth, st.revocations, st.apiKeys, issuer, sessions, impersonation)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh tokens rotativos; sem eles o refresh continua a cargo do serviço de autenticação
+	var refresh *auth.RefreshTokens
+	if cfg.Auth.Refresh.Enabled {
+		refresh = auth.NewRefreshTokens(cfg.Auth.Refresh, st.refreshSessions, issuer, st.revocations)
+	}
+
+	// Proteção contra força bruta das rotas de login e recuperação de senha
+	var guard *auth.LoginGuard
+	if cfg.Auth.LoginProtection.Enabled {
+		guard = auth.NewLoginGuard(cfg.Auth.LoginProtection, st.loginAttempts)
+	}
+
+	// Limites de requisições por IP, usuário, chave de API ou cabeçalho
+	limiter, err := ratelimit.NewLimiter(cfg.RateLimit, st.rateLimits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cotas diárias e mensais dos consumidores da API, por plano
+	quotas, err := quota.NewQuotas(cfg.Quotas, st.quotaUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cache das respostas das leituras do catálogo
+	responses, err := cache.NewCache(cfg.Cache, st.responses)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizer := auth.NewAuthorizer(cfg.Authorization)
+	enforcer := policy.NewEnforcer(st.policies, upstreams, identity)
+
+	// Configurar handlers
+	handlers := handler.NewHandlers(cfg, upstreams, authenticator, issuer, refresh, st.revocations, st.apiKeys, st.policies, quotas, responses)
+
+	// Configurar rotas
+	router.SetupRoutes(engine, handlers, authenticator, authorizer, enforcer, refresh, guard, limiter, quotas, responses)
+
+	// Registrar as rotas encaminhadas aos microserviços (tabela de rotas do config.yaml)
+	if err := api.RegisterRoutes(engine, cfg, upstreams, authenticator, authorizer, enforcer, identity, guard, limiter, quotas); err != nil {
+		return nil, err
+	}
+
+	return &instance{config: cfg, engine: engine, upstreams: upstreams, state: st, drained: make(chan struct{})}, nil
+}
+
+// acquire registra uma requisição na instância; falso quando ela já foi substituída
+func (i *instance) acquire() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.draining {
+		return false
+	}
+	i.active++
+	return true
+}
+
+// done registra o fim de uma requisição
+func (i *instance) done() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.active--
+	if i.draining && i.active == 0 {
+		close(i.drained)
+	}
+}
+
+// drain deixa de aceitar requisições e retorna um canal fechado quando as em andamento terminam
+func (i *instance) drain() <-chan struct{} {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.draining {
+		i.draining = true
+		if i.active == 0 {
+			close(i.drained)
+		}
+	}
+	return i.drained
+}
+
+// start inicia as tarefas em segundo plano da instância (verificação de saúde dos serviços)
+func (i *instance) start() {
+	i.upstreams.Start()
+}
+
+// close encerra as tarefas em segundo plano; requisições em andamento não são afetadas. next é
+// a instância que substitui esta na recarga, cujas métricas são preservadas.
+func (i *instance) close(next *instance) {
+	var upstreams proxy.Upstreams
+	if next != nil {
+		upstreams = next.upstreams
+	}
+	i.upstreams.Close(upstreams)
+}
+
+// Gateway é o http.Handler do servidor. Ele delega à instância da configuração ativa,
+// que pode ser trocada atomicamente; requisições em andamento terminam na instância antiga.
+type Gateway struct {
+	current atomic.Pointer[instance]
+
+	// reloadMu serializa recargas concorrentes
+	reloadMu sync.Mutex
+}
+
+// New cria o gateway com a configuração inicial
+func New(cfg *config.Config) (*Gateway, error) {
+	inst, err := build(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Gateway{}
+	g.current.Store(inst)
+	inst.start()
+	return g, nil
+}
+
+// ServeHTTP encaminha a requisição para o engine ativo
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for {
+		// Uma instância substituída entre Load e acquire não aceita mais requisições; a
+		// próxima leitura encontra a nova
+		inst := g.current.Load()
+		if inst.acquire() {
+			defer inst.done()
+			inst.engine.ServeHTTP(w, r)
+			return
+		}
+	}
+}
+
+// Config retorna a configuração ativa
+func (g *Gateway) Config() *config.Config {
+	return g.current.Load().config
+}
+
+// Close encerra as tarefas em segundo plano e os recursos da configuração ativa
+func (g *Gateway) Close() {
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+	current := g.current.Load()
+	current.close(nil)
+	current.state.release(nil)
+}
+
+// Reload aplica uma nova versão da configuração. Versões inválidas, ou que não
+// produzam uma tabela de rotas válida, são rejeitadas e a configuração atual é mantida.
+// A assinatura segue o callback de config.Watch.
+func (g *Gateway) Reload(cfg *config.Config, err error) {
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+
+	if err == nil {
+		previous := g.current.Load()
+		var inst *instance
+		if inst, err = build(cfg, previous); err == nil {
+			g.current.Store(inst)
+			previous.close(inst)
+			inst.start()
+
+			// As requisições em andamento terminam com os recursos da configuração anterior
+			go func() {
+				select {
+				case <-previous.drain():
+				case <-time.After(drainTimeout):
+					logrus.Warn("Requisições da configuração anterior ainda em andamento; fechando os seus recursos")
+				}
+				previous.state.release(inst.state)
+			}()
+
+			if previous.config.Server != cfg.Server {
+				logrus.Warn("Alterações em server (porta e timeouts) só têm efeito após reiniciar o gateway")
+			}
+
+			configReloadsTotal.WithLabelValues("success").Inc()
+			configLastReloadSuccess.Set(float64(time.Now().Unix()))
+			logrus.WithField("routes", len(cfg.Routes)).Info("Configuração recarregada com sucesso")
+			return
+		}
+	}
+
+	configReloadsTotal.WithLabelValues("rejected").Inc()
+	logrus.WithError(err).Error("Nova configuração rejeitada; mantendo a configuração atual")
+}
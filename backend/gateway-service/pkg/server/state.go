@@ -0,0 +1,168 @@
+package server
+
+import (
+	"reflect"
+
+	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/middleware/auth"
+	"github.com/ecommerce/gateway-service/pkg/middleware/cache"
+	"github.com/ecommerce/gateway-service/pkg/middleware/quota"
+	"github.com/ecommerce/gateway-service/pkg/middleware/ratelimit"
+	"github.com/ecommerce/gateway-service/pkg/policy"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// state agrupa os recursos com estado que sobrevivem às recargas de configuração enquanto
+// a configuração deles não muda: uma recarga não pode, por exemplo, descartar os tokens
+// revogados mantidos em memória
+type state struct {
+	redis    *redis.Client
+	redisCfg config.RedisConfig
+
+	revocations   auth.RevocationStore
+	revocationCfg config.RevocationConfig
+
+	// As sessões de refresh em memória não podem se perder em uma recarga
+	refreshSessions auth.SessionStore
+	refreshCfg      config.RefreshConfig
+
+	// As falhas de login em memória não podem ser zeradas por uma recarga
+	loginAttempts auth.LoginAttemptStore
+	loginCfg      config.LoginProtectionConfig
+
+	// Os limites de requisições em memória não podem ser zerados por uma recarga
+	rateLimits   ratelimit.Store
+	rateLimitCfg config.RateLimitConfig
+
+	// O consumo das cotas em memória não pode ser zerado por uma recarga
+	quotaUsage quota.Store
+	quotaCfg   config.QuotaConfig
+
+	// As respostas em memória continuam valendo depois de uma recarga
+	responses cache.Store
+	cacheCfg  config.CacheConfig
+
+	// Os limites de requisições das chaves de API vivem em memória
+	apiKeys   *auth.APIKeys
+	apiKeyCfg config.APIKeyConfig
+
+	// O arquivo da auditoria fica aberto enquanto não muda
+	audit     *auth.AuditLog
+	auditFile string
+
+	// As políticas recarregam sozinhas quando os arquivos mudam
+	policies  *policy.Store
+	policyCfg config.PolicyConfig
+}
+
+// derive cria o estado para cfg, reaproveitando os recursos de previous que não mudaram
+func (previous *state) derive(cfg *config.Config) (*state, error) {
+	next := &state{redisCfg: cfg.Redis, revocationCfg: cfg.Auth.Revocation, refreshCfg: cfg.Auth.Refresh, loginCfg: cfg.Auth.LoginProtection,
+		rateLimitCfg: cfg.RateLimit, quotaCfg: cfg.Quotas, cacheCfg: cfg.Cache, apiKeyCfg: cfg.Auth.APIKeys, policyCfg: cfg.Policies}
+
+	switch {
+	case previous != nil && previous.redisCfg == cfg.Redis:
+		next.redis = previous.redis
+	case cfg.Redis.Addr != "":
+		next.redis = redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+	}
+
+	if previous != nil && previous.revocationCfg == next.revocationCfg && previous.redis == next.redis {
+		next.revocations = previous.revocations
+	} else {
+		next.revocations = auth.NewRevocationStore(next.revocationCfg, next.redis)
+	}
+
+	if previous != nil && previous.refreshCfg.Store == next.refreshCfg.Store && previous.redis == next.redis {
+		next.refreshSessions = previous.refreshSessions
+	} else {
+		next.refreshSessions = auth.NewSessionStore(next.refreshCfg, next.redis)
+	}
+
+	if previous != nil && previous.loginCfg.Store == next.loginCfg.Store && previous.redis == next.redis {
+		next.loginAttempts = previous.loginAttempts
+	} else {
+		next.loginAttempts = auth.NewLoginAttemptStore(next.loginCfg, next.redis)
+	}
+
+	if previous != nil && previous.rateLimitCfg.Store == next.rateLimitCfg.Store && previous.redis == next.redis {
+		next.rateLimits = previous.rateLimits
+	} else {
+		next.rateLimits = ratelimit.NewStore(next.rateLimitCfg, next.redis)
+	}
+
+	if previous != nil && previous.quotaCfg.Store == next.quotaCfg.Store && previous.redis == next.redis {
+		next.quotaUsage = previous.quotaUsage
+	} else {
+		next.quotaUsage = quota.NewStore(next.quotaCfg, next.redis)
+	}
+
+	if previous != nil && previous.cacheCfg.Store == next.cacheCfg.Store && previous.cacheCfg.MaxBytes == next.cacheCfg.MaxBytes &&
+		previous.redis == next.redis {
+		next.responses = previous.responses
+	} else {
+		next.responses = cache.NewStore(next.cacheCfg, next.redis)
+	}
+
+	if previous != nil && previous.apiKeyCfg == next.apiKeyCfg {
+		next.apiKeys = previous.apiKeys
+	} else {
+		store, err := auth.NewFileAPIKeyStore(next.apiKeyCfg.File)
+		if err != nil {
+			next.release(previous)
+			return nil, err
+		}
+		next.apiKeys = auth.NewAPIKeys(next.apiKeyCfg, store)
+	}
+
+	// A auditoria só registra a impersonação; desativada, o arquivo não é aberto
+	if cfg.Auth.Impersonation.Enabled {
+		next.auditFile = cfg.Auth.Impersonation.AuditFile
+	}
+	if previous != nil && previous.auditFile == next.auditFile {
+		next.audit = previous.audit
+	} else {
+		audit, err := auth.NewAuditLog(next.auditFile)
+		if err != nil {
+			next.release(previous)
+			return nil, err
+		}
+		next.audit = audit
+	}
+
+	if previous != nil && reflect.DeepEqual(previous.policyCfg, next.policyCfg) {
+		next.policies = previous.policies
+	} else {
+		policies, err := policy.NewStore(next.policyCfg)
+		if err == nil {
+			err = policies.Watch()
+		}
+		if err != nil {
+			next.release(previous)
+			return nil, err
+		}
+		next.policies = policies
+	}
+
+	return next, nil
+}
+
+// release fecha os recursos de s que não foram reaproveitados por keep
+func (s *state) release(keep *state) {
+	if s.redis != nil && (keep == nil || keep.redis != s.redis) {
+		if err := s.redis.Close(); err != nil {
+			logrus.WithError(err).Warn("Falha ao fechar a conexão com o Redis")
+		}
+	}
+	if s.policies != nil && (keep == nil || keep.policies != s.policies) {
+		s.policies.Close()
+	}
+	if s.audit != nil && (keep == nil || keep.audit != s.audit) {
+		s.audit.Close()
+	}
+}
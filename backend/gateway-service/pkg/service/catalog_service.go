@@ -1,12 +1,14 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
-	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/middleware/cache"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
 	"github.com/sirupsen/logrus"
 )
 
@@ -39,12 +41,15 @@ type CatalogService struct {
 	client  *http.Client
 }
 
-// NewCatalogService cria uma nova instância do serviço de catálogo
-func NewCatalogService(cfg config.ServiceConfig) *CatalogService {
-	baseURL := fmt.Sprintf("http://%s:%s", cfg.Host, cfg.Port)
+// NewCatalogService cria uma nova instância do serviço de catálogo.
+// As requisições são distribuídas entre as instâncias do serviço pelo balanceador do upstream,
+// que também aplica o timeout configurado para o serviço. As leituras das rotas liberadas
+// pelo cache de respostas passam por ele.
+func NewCatalogService(upstream *proxy.Upstream, responses *cache.Cache) *CatalogService {
+	baseURL := fmt.Sprintf("http://%s", upstream.Name())
 
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Transport: responses.Transport(upstream.Name(), upstream),
 	}
 
 	return &CatalogService{
@@ -54,10 +59,10 @@ func NewCatalogService(cfg config.ServiceConfig) *CatalogService {
 }
 
 // GetAllProducts retorna todos os produtos do catálogo
-func (s *CatalogService) GetAllProducts(page, size int) ([]Product, int, error) {
+func (s *CatalogService) GetAllProducts(ctx context.Context, page, size int) ([]Product, int, error) {
 	url := fmt.Sprintf("%s/api/products?page=%d&size=%d", s.baseURL, page, size)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -89,10 +94,10 @@ func (s *CatalogService) GetAllProducts(page, size int) ([]Product, int, error)
 }
 
 // GetProductByID retorna um produto pelo seu ID
-func (s *CatalogService) GetProductByID(id string) (*Product, error) {
+func (s *CatalogService) GetProductByID(ctx context.Context, id string) (*Product, error) {
 	url := fmt.Sprintf("%s/api/products/%s", s.baseURL, id)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -124,10 +129,10 @@ func (s *CatalogService) GetProductByID(id string) (*Product, error) {
 }
 
 // GetCategories retorna todas as categorias
-func (s *CatalogService) GetCategories() ([]Category, error) {
+func (s *CatalogService) GetCategories(ctx context.Context) ([]Category, error) {
 	url := fmt.Sprintf("%s/api/categories", s.baseURL)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -155,10 +160,10 @@ func (s *CatalogService) GetCategories() ([]Category, error) {
 }
 
 // SearchProducts procura produtos por um termo de busca
-func (s *CatalogService) SearchProducts(query string, page, size int) ([]Product, int, error) {
+func (s *CatalogService) SearchProducts(ctx context.Context, query string, page, size int) ([]Product, int, error) {
 	url := fmt.Sprintf("%s/api/products/search?query=%s&page=%d&size=%d", s.baseURL, query, page, size)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, 0, err
 	}
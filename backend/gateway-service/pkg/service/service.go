@@ -2,6 +2,8 @@ package service
 
 import (
 	"github.com/ecommerce/gateway-service/pkg/config"
+	"github.com/ecommerce/gateway-service/pkg/middleware/cache"
+	"github.com/ecommerce/gateway-service/pkg/proxy"
 )
 
 // Services contém todas as instâncias de serviços para comunicação com microserviços
@@ -13,11 +15,12 @@ type Services struct {
 	UserService    *UserService
 }
 
-// NewServices inicializa todos os serviços com suas configurações
-func NewServices(cfg *config.Config) *Services {
+// NewServices inicializa todos os serviços com suas configurações; responses é nil quando o
+// cache de respostas está desativado
+func NewServices(cfg *config.Config, upstreams proxy.Upstreams, responses *cache.Cache) *Services {
 	return &Services{
 		AuthService:    NewAuthService(cfg.Services.User),
-		CatalogService: NewCatalogService(cfg.Services.Catalog),
+		CatalogService: NewCatalogService(upstreams["catalog"], responses),
 		CartService:    NewCartService(cfg.Services.Cart),
 		OrderService:   NewOrderService(cfg.Services.Order),
 		UserService:    NewUserService(cfg.Services.User),